@@ -7,9 +7,13 @@ use crate::config::{ArchimedesConfig, InternalConfig};
 use crate::error::FfiError;
 use crate::handler::HandlerRegistry;
 use crate::types::{ArchimedesError, ArchimedesHandlerFn};
+use crate::validation::ContractValidator;
+use archimedes_router::Router;
+use std::collections::HashMap;
 use std::ffi::{c_char, CStr, CString};
 use std::sync::atomic::{AtomicBool, Ordering};
-use std::sync::Arc;
+use std::sync::{Arc, OnceLock};
+use std::time::Duration;
 
 /// Opaque application handle for FFI
 ///
@@ -28,8 +32,22 @@ pub(crate) struct AppState {
     /// Running flag
     pub running: Arc<AtomicBool>,
     /// Contract JSON (stored for lifetime)
-    #[allow(dead_code)]
     pub contract_json: Option<String>,
+    /// Routes for the contract's operations, built on first dispatch
+    routes: OnceLock<Result<Router, String>>,
+    /// Request validator for the contract, built on first validation
+    validator: OnceLock<Result<ContractValidator, String>>,
+    /// Request limits overridden per operation ID
+    operation_limits: HashMap<String, OperationLimits>,
+}
+
+/// Request limits of an operation; zero keeps the app-wide setting
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq)]
+pub(crate) struct OperationLimits {
+    /// Maximum request body size in bytes
+    pub max_body_size: usize,
+    /// Request timeout
+    pub request_timeout: Duration,
 }
 
 impl AppState {
@@ -40,7 +58,43 @@ impl AppState {
             handlers: Arc::new(HandlerRegistry::new()),
             running: Arc::new(AtomicBool::new(false)),
             contract_json: None,
+            routes: OnceLock::new(),
+            validator: OnceLock::new(),
+            operation_limits: HashMap::new(),
+        }
+    }
+
+    /// Get the routes for the contract's operations
+    pub fn routes(&self) -> Result<&Router, String> {
+        self.routes
+            .get_or_init(|| crate::dispatch::contract_router(self))
+            .as_ref()
+            .map_err(Clone::clone)
+    }
+
+    /// Get the request validator for the contract
+    pub fn validator(&self) -> Result<&ContractValidator, String> {
+        self.validator
+            .get_or_init(|| ContractValidator::for_app(self))
+            .as_ref()
+            .map_err(Clone::clone)
+    }
+
+    /// Get the effective request limits of an operation: its overrides,
+    /// falling back to the app-wide config
+    pub fn limits(&self, operation_id: &str) -> OperationLimits {
+        let mut limits = self
+            .operation_limits
+            .get(operation_id)
+            .copied()
+            .unwrap_or_default();
+        if limits.max_body_size == 0 {
+            limits.max_body_size = self.config.max_body_size;
         }
+        if limits.request_timeout.is_zero() {
+            limits.request_timeout = Duration::from_secs(self.config.request_timeout_secs.into());
+        }
+        limits
     }
 
     /// Check if the app is running
@@ -145,6 +199,67 @@ pub unsafe extern "C" fn archimedes_register_handler(
     }
 }
 
+/// Unregister the handler for an operation
+///
+/// # Safety
+///
+/// - `app` must be a valid application pointer
+/// - `operation_id` must be a valid null-terminated UTF-8 string
+///
+/// Returns 0 on success, or `ARCHIMEDES_ERROR_INVALID_OPERATION` if no
+/// handler is registered for the operation.
+#[no_mangle]
+pub unsafe extern "C" fn archimedes_unregister_handler(
+    app: *mut ArchimedesApp,
+    operation_id: *const c_char,
+) -> ArchimedesError {
+    if app.is_null() {
+        crate::set_last_error(FfiError::NullPointer("app"));
+        return ArchimedesError::NullPointer;
+    }
+
+    if operation_id.is_null() {
+        crate::set_last_error(FfiError::NullPointer("operation_id"));
+        return ArchimedesError::NullPointer;
+    }
+
+    let state = &*(app as *mut AppState);
+
+    let op_id = match CStr::from_ptr(operation_id).to_str() {
+        Ok(s) => s,
+        Err(e) => {
+            crate::set_last_error(FfiError::InvalidUtf8(e.to_string()));
+            return ArchimedesError::InvalidUtf8;
+        }
+    };
+
+    if state.handlers.unregister(op_id) {
+        ArchimedesError::Ok
+    } else {
+        crate::set_last_error(FfiError::InvalidOperation(format!(
+            "No handler registered for operation '{op_id}'"
+        )));
+        ArchimedesError::InvalidOperation
+    }
+}
+
+/// Get the number of operations with a registered handler
+///
+/// # Safety
+///
+/// - `app` must be a valid application pointer
+///
+/// Returns 0 if `app` is null.
+#[no_mangle]
+pub unsafe extern "C" fn archimedes_handler_count(app: *const ArchimedesApp) -> usize {
+    if app.is_null() {
+        return 0;
+    }
+
+    let state = &*(app as *const AppState);
+    state.handlers.len()
+}
+
 /// Load a contract from JSON
 ///
 /// # Safety
@@ -181,6 +296,107 @@ pub unsafe extern "C" fn archimedes_load_contract(
     // TODO: Parse contract JSON and validate
     // For now, just store it
     state.contract_json = Some(json_str);
+    state.routes = OnceLock::new();
+    state.validator = OnceLock::new();
+
+    ArchimedesError::Ok
+}
+
+/// Override the request limits of one operation
+///
+/// # Safety
+///
+/// - `app` must be a valid application pointer
+/// - `operation_id` must be a valid null-terminated UTF-8 string
+///
+/// `max_body_size` (bytes) and `request_timeout_ms` replace the app-wide
+/// `max_body_size` and `request_timeout_secs` for the operation; zero keeps
+/// the app-wide value. A limit may be larger than the app-wide one. Returns
+/// 0 on success, or an error code on failure.
+#[no_mangle]
+pub unsafe extern "C" fn archimedes_configure_operation(
+    app: *mut ArchimedesApp,
+    operation_id: *const c_char,
+    max_body_size: usize,
+    request_timeout_ms: u64,
+) -> ArchimedesError {
+    if app.is_null() {
+        crate::set_last_error(FfiError::NullPointer("app"));
+        return ArchimedesError::NullPointer;
+    }
+
+    if operation_id.is_null() {
+        crate::set_last_error(FfiError::NullPointer("operation_id"));
+        return ArchimedesError::NullPointer;
+    }
+
+    let state = &mut *(app as *mut AppState);
+
+    let operation_id = match CStr::from_ptr(operation_id).to_str() {
+        Ok(s) => s.to_string(),
+        Err(e) => {
+            crate::set_last_error(FfiError::InvalidUtf8(e.to_string()));
+            return ArchimedesError::InvalidUtf8;
+        }
+    };
+
+    let limits = OperationLimits {
+        max_body_size,
+        request_timeout: Duration::from_millis(request_timeout_ms),
+    };
+    if limits == OperationLimits::default() {
+        state.operation_limits.remove(&operation_id);
+    } else {
+        state.operation_limits.insert(operation_id, limits);
+    }
+
+    ArchimedesError::Ok
+}
+
+/// Set the address and port the server listens on, overriding the config
+///
+/// # Safety
+///
+/// - `app` must be a valid application pointer
+/// - `listen_addr` must be a valid null-terminated UTF-8 string
+///
+/// Returns 0 on success, or an error code on failure. The address cannot
+/// be changed while the server is running.
+#[no_mangle]
+pub unsafe extern "C" fn archimedes_set_listen_addr(
+    app: *mut ArchimedesApp,
+    listen_addr: *const c_char,
+    listen_port: u16,
+) -> ArchimedesError {
+    if app.is_null() {
+        crate::set_last_error(FfiError::NullPointer("app"));
+        return ArchimedesError::NullPointer;
+    }
+
+    if listen_addr.is_null() {
+        crate::set_last_error(FfiError::NullPointer("listen_addr"));
+        return ArchimedesError::NullPointer;
+    }
+
+    let state = &mut *(app as *mut AppState);
+
+    if state.is_running() {
+        crate::set_last_error(FfiError::Internal(
+            "Cannot change the listen address while the server is running".to_string(),
+        ));
+        return ArchimedesError::Internal;
+    }
+
+    let addr = match CStr::from_ptr(listen_addr).to_str() {
+        Ok(s) => s.to_string(),
+        Err(e) => {
+            crate::set_last_error(FfiError::InvalidUtf8(e.to_string()));
+            return ArchimedesError::InvalidUtf8;
+        }
+    };
+
+    state.config.listen_addr = addr;
+    state.config.listen_port = listen_port;
 
     ArchimedesError::Ok
 }
@@ -220,11 +436,25 @@ pub unsafe extern "C" fn archimedes_run(app: *mut ArchimedesApp) -> ArchimedesEr
         // server.run().await
 
         // For now, just signal we're ready
-        tracing::info!(
-            "Archimedes FFI server would start on {}:{}",
-            state.config.listen_addr,
-            state.config.listen_port
-        );
+        let scheme = if state.config.tls.is_some() {
+            "https"
+        } else {
+            "http"
+        };
+        match &state.config.unix_socket_path {
+            Some(path) => tracing::info!(
+                "Archimedes FFI server would start on {}+unix://{} (mode {:o})",
+                scheme,
+                path,
+                state.config.unix_socket_mode
+            ),
+            None => tracing::info!(
+                "Archimedes FFI server would start on {}://{}:{}",
+                scheme,
+                state.config.listen_addr,
+                state.config.listen_port
+            ),
+        }
 
         Ok::<(), FfiError>(())
     });
@@ -329,6 +559,7 @@ mod tests {
             headers_count: 0,
             header_names: std::ptr::null(),
             header_values: std::ptr::null(),
+            headers_owned: false,
         }
     }
 
@@ -373,6 +604,44 @@ mod tests {
         }
     }
 
+    #[test]
+    fn test_unregister_handler() {
+        let (config, _contract_path) = create_test_config();
+        let op_id = CString::new("getUser").unwrap();
+
+        unsafe {
+            let app = archimedes_new(&config);
+            assert!(!app.is_null());
+
+            let result = archimedes_register_handler(
+                app,
+                op_id.as_ptr(),
+                test_handler,
+                std::ptr::null_mut(),
+            );
+            assert_eq!(result, ArchimedesError::Ok);
+
+            assert_eq!(archimedes_handler_count(app), 1);
+
+            let result = archimedes_unregister_handler(app, op_id.as_ptr());
+            assert_eq!(result, ArchimedesError::Ok);
+            assert_eq!(archimedes_handler_count(app), 0);
+
+            let result = archimedes_unregister_handler(app, op_id.as_ptr());
+            assert_eq!(result, ArchimedesError::InvalidOperation);
+
+            let result = archimedes_register_handler(
+                app,
+                op_id.as_ptr(),
+                test_handler,
+                std::ptr::null_mut(),
+            );
+            assert_eq!(result, ArchimedesError::Ok);
+
+            archimedes_free(app);
+        }
+    }
+
     #[test]
     fn test_register_handler_null_app() {
         let op_id = CString::new("getUser").unwrap();
@@ -424,6 +693,29 @@ mod tests {
         }
     }
 
+    #[test]
+    fn test_set_listen_addr() {
+        let (config, _contract_path) = create_test_config();
+        let addr = CString::new("127.0.0.1").unwrap();
+
+        unsafe {
+            let app = archimedes_new(&config);
+            assert!(!app.is_null());
+
+            let result = archimedes_set_listen_addr(app, addr.as_ptr(), 8003);
+            assert_eq!(result, ArchimedesError::Ok);
+
+            let state = &*(app as *const AppState);
+            assert_eq!(state.config.listen_addr, "127.0.0.1");
+            assert_eq!(state.config.listen_port, 8003);
+
+            let result = archimedes_set_listen_addr(app, std::ptr::null(), 8003);
+            assert_eq!(result, ArchimedesError::NullPointer);
+
+            archimedes_free(app);
+        }
+    }
+
     #[test]
     fn test_is_running_initially_false() {
         let (config, _contract_path) = create_test_config();
@@ -464,4 +756,29 @@ mod tests {
             archimedes_free(app);
         }
     }
+
+    #[test]
+    fn test_configure_operation_limits() {
+        let (config, _contract_path) = create_test_config();
+        let op_id = CString::new("uploadAvatar").unwrap();
+
+        unsafe {
+            let app = archimedes_new(&config);
+            assert!(!app.is_null());
+
+            let result = archimedes_configure_operation(app, op_id.as_ptr(), 10 << 20, 0);
+            assert_eq!(result, ArchimedesError::Ok);
+
+            let state = &*(app as *const AppState);
+            let limits = state.limits("uploadAvatar");
+            assert_eq!(limits.max_body_size, 10 << 20);
+            assert_eq!(limits.request_timeout, Duration::from_secs(30));
+            assert_eq!(state.limits("getUser").max_body_size, 1024 * 1024);
+
+            let result = archimedes_configure_operation(app, std::ptr::null(), 0, 0);
+            assert_eq!(result, ArchimedesError::NullPointer);
+
+            archimedes_free(app);
+        }
+    }
 }
@@ -0,0 +1,586 @@
+//! In-process request dispatch
+//!
+//! Routes a request by the operations of the application's contract and
+//! invokes the registered handler callback, without a network transport.
+//! The test client dispatches its requests through here.
+//!
+//! A request that asks for a WebSocket upgrade is registered for upgrade
+//! while its handler runs. There is no client connection to relay messages
+//! from, so the handler reads a close message at once; the messages it
+//! writes become the response body.
+
+use crate::app::AppState;
+use crate::handler::invoke_handler;
+use crate::request::RequestContextBuilder;
+use crate::response::{
+    extract_headers, maybe_free_response_body, maybe_free_response_headers, response_to_bytes,
+};
+use crate::stream::ResponseStream;
+use crate::ws::{
+    cancel_upgrade, is_upgrade_request, register_upgrade, WsFrame, WsPeer, ARCHIMEDES_WS_BINARY,
+    ARCHIMEDES_WS_TEXT,
+};
+use archimedes_router::{MethodRouter, Router};
+use http::Method;
+use serde_json::Value;
+
+/// A request to dispatch to an application
+pub(crate) struct DispatchRequest<'a> {
+    /// HTTP method (GET, POST, etc.)
+    pub method: &'a str,
+    /// Request path with an optional query string (e.g., "/users?limit=5")
+    pub target: &'a str,
+    /// Request headers
+    pub headers: &'a [(String, String)],
+    /// Request body
+    pub body: &'a [u8],
+    /// Network address of the peer as "ip:port" (empty if unknown)
+    pub remote_addr: &'a str,
+}
+
+/// Response produced by a dispatched request
+#[derive(Debug)]
+pub(crate) struct DispatchResponse {
+    /// HTTP status code
+    pub status_code: u16,
+    /// Response headers, including Content-Type
+    pub headers: Vec<(String, String)>,
+    /// Response body
+    pub body: Vec<u8>,
+    /// Number of chunks the body was streamed in (0 for a buffered response),
+    /// or of messages sent over an upgraded connection
+    pub chunks: usize,
+    /// Whether the handler sent a 100 Continue interim response
+    pub continued: bool,
+}
+
+impl DispatchResponse {
+    /// Create a JSON response carrying only an error code, as sent for
+    /// requests that reach no handler
+    fn code(status_code: u16, code: &str) -> Self {
+        Self {
+            status_code,
+            headers: vec![("Content-Type".to_string(), "application/json".to_string())],
+            body: serde_json::json!({ "code": code }).to_string().into_bytes(),
+            chunks: 0,
+            continued: false,
+        }
+    }
+}
+
+/// Parse the application's contract
+///
+/// The contract is the JSON loaded with `archimedes_load_contract`, or else
+/// the configured contract file.
+pub(crate) fn contract_document(state: &AppState) -> Result<Value, String> {
+    let json = match (&state.contract_json, &state.config.contract_path) {
+        (Some(json), _) => json.clone(),
+        (None, Some(path)) => std::fs::read_to_string(path)
+            .map_err(|e| format!("Failed to read contract '{path}': {e}"))?,
+        (None, None) => return Err("No contract loaded".to_string()),
+    };
+    serde_json::from_str(&json).map_err(|e| format!("Invalid contract: {e}"))
+}
+
+/// Build a router from the operations of the application's contract
+pub(crate) fn contract_router(state: &AppState) -> Result<Router, String> {
+    let contract = contract_document(state)?;
+
+    let mut router = Router::new();
+    let operations = contract.get("operations").and_then(Value::as_array);
+    for operation in operations.into_iter().flatten() {
+        let field = |name: &str| operation.get(name).and_then(Value::as_str);
+        let (Some(id), Some(method), Some(path)) = (field("id"), field("method"), field("path"))
+        else {
+            continue;
+        };
+        let Ok(method) = Method::from_bytes(method.to_ascii_uppercase().as_bytes()) else {
+            continue;
+        };
+        router.insert(path, MethodRouter::new().method(&method, id));
+    }
+    Ok(router)
+}
+
+/// Dispatch a request to the handler registered for its operation
+///
+/// Unknown paths get 404, known paths with another method 405,
+/// operations without a registered handler 501, and bodies over the
+/// operation's size limit 413. Fails only if the contract cannot be loaded
+/// or the method is invalid.
+pub(crate) fn dispatch(
+    state: &AppState,
+    request: &DispatchRequest<'_>,
+) -> Result<DispatchResponse, String> {
+    let router = state.routes()?;
+    let method = Method::from_bytes(request.method.as_bytes())
+        .map_err(|_| format!("Invalid method '{}'", request.method))?;
+    let (path, query) = request
+        .target
+        .split_once('?')
+        .unwrap_or((request.target, ""));
+
+    let Some(route) = router.match_route(&method, path) else {
+        if router.match_path(path).is_some() {
+            return Ok(DispatchResponse::code(405, "METHOD_NOT_ALLOWED"));
+        }
+        return Ok(DispatchResponse::code(404, "NOT_FOUND"));
+    };
+    let Some(handler) = state.handlers.get(route.operation_id) else {
+        return Ok(DispatchResponse::code(501, "NOT_IMPLEMENTED"));
+    };
+    let max_body_size = state.limits(route.operation_id).max_body_size;
+    if max_body_size > 0 && request.body.len() > max_body_size {
+        return Ok(DispatchResponse::code(413, "PAYLOAD_TOO_LARGE"));
+    }
+
+    let params: Vec<(String, String)> = route
+        .params
+        .iter()
+        .map(|(name, value)| (name.to_string(), value.to_string()))
+        .collect();
+    let request_id = uuid::Uuid::now_v7().to_string();
+    let mut stream = ResponseStream::default();
+    let mut builder = RequestContextBuilder::new(
+        &request_id,
+        route.operation_id,
+        request.method,
+        &percent_decode(path),
+    )
+    .with_query(query)
+    .with_raw_target(path, query)
+    .with_path_params(&params)
+    .with_headers(request.headers)
+    .with_response_stream(stream.as_handle());
+    if !request.remote_addr.is_empty() {
+        builder = builder.with_remote_addr(request.remote_addr);
+    }
+    let ctx = builder.build();
+
+    let upgrade = is_upgrade_request(request.headers).then(|| {
+        let WsPeer {
+            handshake,
+            to_handler,
+            from_handler,
+        } = register_upgrade(&request_id);
+        // No client messages will arrive
+        drop(to_handler);
+        (handshake, from_handler)
+    });
+    let response = invoke_handler(&handler, &ctx, request.body);
+    let (status_code, body, content_type) = response_to_bytes(&response);
+    let mut headers = extract_headers(&response);
+    if !response.content_type.is_null() || !body.is_empty() {
+        headers.push(("Content-Type".to_string(), content_type));
+    }
+    // SAFETY: handlers that set body_owned or headers_owned allocate that
+    // memory with malloc
+    unsafe {
+        maybe_free_response_body(&response);
+        maybe_free_response_headers(&response);
+    }
+
+    if let Some((handshake, from_handler)) = upgrade {
+        cancel_upgrade(&request_id);
+        if let Ok(accept_key) = handshake.try_recv() {
+            return Ok(upgraded_response(accept_key, from_handler.try_iter()));
+        }
+    }
+
+    // A started stream already carries the response
+    if let Some((status_code, headers)) = stream.head {
+        return Ok(DispatchResponse {
+            status_code,
+            headers,
+            body: stream.body,
+            chunks: stream.chunks,
+            continued: stream.continued,
+        });
+    }
+    Ok(DispatchResponse {
+        status_code,
+        headers,
+        body,
+        chunks: 0,
+        continued: stream.continued,
+    })
+}
+
+/// Decode the percent-encoded octets of a request path
+///
+/// Invalid escapes are kept as is, and invalid UTF-8 is replaced.
+fn percent_decode(path: &str) -> String {
+    let bytes = path.as_bytes();
+    let mut decoded = Vec::with_capacity(bytes.len());
+    let mut i = 0;
+    while i < bytes.len() {
+        let escape = bytes
+            .get(i + 1..i + 3)
+            .filter(|hex| hex.iter().all(u8::is_ascii_hexdigit))
+            .and_then(|hex| u8::from_str_radix(std::str::from_utf8(hex).ok()?, 16).ok());
+        match (bytes[i], escape) {
+            (b'%', Some(byte)) => {
+                decoded.push(byte);
+                i += 3;
+            }
+            (byte, _) => {
+                decoded.push(byte);
+                i += 1;
+            }
+        }
+    }
+    String::from_utf8_lossy(&decoded).into_owned()
+}
+
+/// Build the response of a request whose handler upgraded its connection,
+/// with the data messages it sent as the body
+fn upgraded_response(accept_key: String, sent: impl Iterator<Item = WsFrame>) -> DispatchResponse {
+    let mut body = Vec::new();
+    let mut chunks = 0;
+    for frame in sent {
+        if matches!(frame.msg_type, ARCHIMEDES_WS_TEXT | ARCHIMEDES_WS_BINARY) {
+            body.extend_from_slice(&frame.data);
+            chunks += 1;
+        }
+    }
+    DispatchResponse {
+        status_code: 101,
+        headers: vec![
+            ("Upgrade".to_string(), "websocket".to_string()),
+            ("Connection".to_string(), "Upgrade".to_string()),
+            ("Sec-WebSocket-Accept".to_string(), accept_key),
+        ],
+        body,
+        chunks,
+        continued: false,
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::app::{
+        archimedes_configure_operation, archimedes_free, archimedes_load_contract, archimedes_new,
+        archimedes_register_handler,
+    };
+    use crate::config::ArchimedesConfig;
+    use crate::stream::{archimedes_stream_start, archimedes_stream_write};
+    use crate::types::{ArchimedesRequestContext, ArchimedesResponseData};
+    use crate::ws::{
+        archimedes_ws_close, archimedes_ws_read, archimedes_ws_upgrade, archimedes_ws_write,
+        ARCHIMEDES_WS_CLOSE,
+    };
+    use std::ffi::{c_void, CStr, CString};
+
+    const CONTRACT: &str = r#"{"operations": [
+        {"id": "listUsers", "method": "GET", "path": "/users"},
+        {"id": "createUser", "method": "POST", "path": "/users"},
+        {"id": "getUser", "method": "GET", "path": "/users/{userId}"}
+    ]}"#;
+
+    // Echoes the userId path parameter and query string as the body
+    extern "C" fn get_user(
+        ctx: *const ArchimedesRequestContext,
+        _body: *const u8,
+        _body_len: usize,
+        _user_data: *mut c_void,
+    ) -> ArchimedesResponseData {
+        let ctx = unsafe { &*ctx };
+        let param = unsafe { CStr::from_ptr(*ctx.path_param_values) }
+            .to_str()
+            .unwrap();
+        let query = unsafe { CStr::from_ptr(ctx.query) }.to_str().unwrap();
+        let body = format!("{param}?{query}");
+        let len = body.len();
+
+        let ptr = unsafe { libc::malloc(len) }.cast::<u8>();
+        unsafe { std::ptr::copy_nonoverlapping(body.as_ptr(), ptr, len) };
+        ArchimedesResponseData {
+            status_code: 200,
+            body: ptr.cast(),
+            body_len: len,
+            body_owned: true,
+            content_type: b"text/plain\0".as_ptr().cast(),
+            ..Default::default()
+        }
+    }
+
+    // Echoes the decoded and raw request path and the peer address
+    extern "C" fn echo_path(
+        ctx: *const ArchimedesRequestContext,
+        _body: *const u8,
+        _body_len: usize,
+        _user_data: *mut c_void,
+    ) -> ArchimedesResponseData {
+        let ctx = unsafe { &*ctx };
+        let path = unsafe { CStr::from_ptr(ctx.path) }.to_str().unwrap();
+        let raw_path = unsafe { CStr::from_ptr(ctx.raw_path) }.to_str().unwrap();
+        let remote_addr = unsafe { CStr::from_ptr(ctx.remote_addr) }.to_str().unwrap();
+        let body = format!("{path} {raw_path} {remote_addr}");
+        let len = body.len();
+
+        let ptr = unsafe { libc::malloc(len) }.cast::<u8>();
+        unsafe { std::ptr::copy_nonoverlapping(body.as_ptr(), ptr, len) };
+        ArchimedesResponseData {
+            status_code: 200,
+            body: ptr.cast(),
+            body_len: len,
+            body_owned: true,
+            ..Default::default()
+        }
+    }
+
+    // Streams the userId path parameter in two chunks, then returns a body
+    // that is ignored
+    extern "C" fn stream_user(
+        ctx: *const ArchimedesRequestContext,
+        _body: *const u8,
+        _body_len: usize,
+        _user_data: *mut c_void,
+    ) -> ArchimedesResponseData {
+        let ctx = unsafe { &*ctx };
+        let head = ArchimedesResponseData {
+            status_code: 200,
+            content_type: b"text/plain\0".as_ptr().cast(),
+            ..Default::default()
+        };
+        unsafe {
+            archimedes_stream_start(ctx.response_stream, &head);
+            archimedes_stream_write(ctx.response_stream, b"user ".as_ptr(), 5);
+            let param = CStr::from_ptr(*ctx.path_param_values).to_bytes();
+            archimedes_stream_write(ctx.response_stream, param.as_ptr(), param.len());
+        }
+        ArchimedesResponseData {
+            status_code: 500,
+            body: b"ignored".as_ptr().cast(),
+            body_len: 7,
+            ..Default::default()
+        }
+    }
+
+    // Upgrades the connection, echoes the first message it reads (the
+    // client's close) and closes
+    extern "C" fn upgrade_user(
+        ctx: *const ArchimedesRequestContext,
+        _body: *const u8,
+        _body_len: usize,
+        _user_data: *mut c_void,
+    ) -> ArchimedesResponseData {
+        unsafe {
+            let ws = archimedes_ws_upgrade((*ctx).request_id, b"accept-key\0".as_ptr().cast());
+            let (mut data, mut len, mut msg_type) = (std::ptr::null_mut(), 0, 0);
+            archimedes_ws_read(ws, &mut data, &mut len, &mut msg_type);
+            let reply = format!("read {msg_type}");
+            archimedes_ws_write(ws, ARCHIMEDES_WS_TEXT, reply.as_ptr(), reply.len());
+            archimedes_ws_close(ws);
+        }
+        ArchimedesResponseData::default()
+    }
+
+    fn with_app(test: impl FnOnce(&AppState)) {
+        let contract_path = CString::new("contract.json").unwrap();
+        let config = ArchimedesConfig {
+            contract_path: contract_path.as_ptr(),
+            ..Default::default()
+        };
+        let contract = CString::new(CONTRACT).unwrap();
+        let op_id = CString::new("getUser").unwrap();
+
+        unsafe {
+            let app = archimedes_new(&config);
+            assert!(!app.is_null());
+            archimedes_load_contract(app, contract.as_ptr());
+            archimedes_register_handler(app, op_id.as_ptr(), get_user, std::ptr::null_mut());
+            test(&*(app as *const AppState));
+            archimedes_free(app);
+        }
+    }
+
+    fn request<'a>(method: &'a str, target: &'a str) -> DispatchRequest<'a> {
+        DispatchRequest {
+            method,
+            target,
+            headers: &[],
+            body: &[],
+            remote_addr: "",
+        }
+    }
+
+    #[test]
+    fn test_dispatch_invokes_handler() {
+        with_app(|state| {
+            let response = dispatch(state, &request("GET", "/users/42?expand=1")).unwrap();
+            assert_eq!(response.status_code, 200);
+            assert_eq!(response.body, b"42?expand=1");
+            assert_eq!(
+                response.headers,
+                vec![("Content-Type".to_string(), "text/plain".to_string())]
+            );
+        });
+    }
+
+    #[test]
+    fn test_dispatch_streamed_response() {
+        let contract_path = CString::new("contract.json").unwrap();
+        let config = ArchimedesConfig {
+            contract_path: contract_path.as_ptr(),
+            ..Default::default()
+        };
+        let contract = CString::new(CONTRACT).unwrap();
+        let op_id = CString::new("getUser").unwrap();
+
+        unsafe {
+            let app = archimedes_new(&config);
+            archimedes_load_contract(app, contract.as_ptr());
+            archimedes_register_handler(app, op_id.as_ptr(), stream_user, std::ptr::null_mut());
+
+            let state = &*(app as *const AppState);
+            let response = dispatch(state, &request("GET", "/users/42")).unwrap();
+            assert_eq!(response.status_code, 200);
+            assert_eq!(response.body, b"user 42");
+            assert_eq!(response.chunks, 2);
+            assert_eq!(
+                response.headers,
+                vec![("Content-Type".to_string(), "text/plain".to_string())]
+            );
+            archimedes_free(app);
+        }
+    }
+
+    #[test]
+    fn test_dispatch_websocket_upgrade() {
+        let contract_path = CString::new("contract.json").unwrap();
+        let config = ArchimedesConfig {
+            contract_path: contract_path.as_ptr(),
+            ..Default::default()
+        };
+        let contract = CString::new(CONTRACT).unwrap();
+        let op_id = CString::new("getUser").unwrap();
+        let headers = [("Upgrade".to_string(), "websocket".to_string())];
+
+        unsafe {
+            let app = archimedes_new(&config);
+            archimedes_load_contract(app, contract.as_ptr());
+            archimedes_register_handler(app, op_id.as_ptr(), upgrade_user, std::ptr::null_mut());
+
+            let state = &*(app as *const AppState);
+            let response = dispatch(
+                state,
+                &DispatchRequest {
+                    headers: &headers,
+                    ..request("GET", "/users/42")
+                },
+            )
+            .unwrap();
+            assert_eq!(response.status_code, 101);
+            assert!(response
+                .headers
+                .contains(&("Sec-WebSocket-Accept".to_string(), "accept-key".to_string())));
+            assert_eq!(
+                response.body,
+                format!("read {ARCHIMEDES_WS_CLOSE}").as_bytes()
+            );
+            assert_eq!(response.chunks, 1);
+            archimedes_free(app);
+        }
+    }
+
+    #[test]
+    fn test_dispatch_request_target_and_peer() {
+        let contract_path = CString::new("contract.json").unwrap();
+        let config = ArchimedesConfig {
+            contract_path: contract_path.as_ptr(),
+            ..Default::default()
+        };
+        let contract = CString::new(CONTRACT).unwrap();
+        let op_id = CString::new("getUser").unwrap();
+
+        unsafe {
+            let app = archimedes_new(&config);
+            archimedes_load_contract(app, contract.as_ptr());
+            archimedes_register_handler(app, op_id.as_ptr(), echo_path, std::ptr::null_mut());
+
+            let state = &*(app as *const AppState);
+            let response = dispatch(
+                state,
+                &DispatchRequest {
+                    remote_addr: "203.0.113.7:52100",
+                    ..request("GET", "/users/a%2Fb")
+                },
+            )
+            .unwrap();
+            assert_eq!(response.status_code, 200);
+            assert_eq!(response.body, b"/users/a/b /users/a%2Fb 203.0.113.7:52100");
+            archimedes_free(app);
+        }
+    }
+
+    #[test]
+    fn test_percent_decode() {
+        assert_eq!(percent_decode("/files/a%2Fb%20c.txt"), "/files/a/b c.txt");
+        assert_eq!(percent_decode("/caf%C3%A9"), "/café");
+        assert_eq!(percent_decode("/100%/%zz/%4"), "/100%/%zz/%4");
+    }
+
+    #[test]
+    fn test_dispatch_without_handler() {
+        with_app(|state| {
+            let not_found = dispatch(state, &request("GET", "/missing")).unwrap();
+            assert_eq!(not_found.status_code, 404);
+            assert_eq!(not_found.body, br#"{"code":"NOT_FOUND"}"#);
+
+            let not_allowed = dispatch(state, &request("DELETE", "/users")).unwrap();
+            assert_eq!(not_allowed.status_code, 405);
+
+            let not_implemented = dispatch(state, &request("GET", "/users")).unwrap();
+            assert_eq!(not_implemented.status_code, 501);
+        });
+    }
+
+    #[test]
+    fn test_dispatch_operation_body_limit() {
+        let config = ArchimedesConfig {
+            max_body_size: 4,
+            ..Default::default()
+        };
+        let contract = CString::new(CONTRACT).unwrap();
+        let op_id = CString::new("getUser").unwrap();
+        let body = b"12345678";
+        let request = DispatchRequest {
+            body,
+            ..request("GET", "/users/42")
+        };
+
+        unsafe {
+            let app = archimedes_new(&config);
+            archimedes_load_contract(app, contract.as_ptr());
+            archimedes_register_handler(app, op_id.as_ptr(), get_user, std::ptr::null_mut());
+
+            let too_large = dispatch(&*(app as *const AppState), &request).unwrap();
+            assert_eq!(too_large.status_code, 413);
+            assert_eq!(too_large.body, br#"{"code":"PAYLOAD_TOO_LARGE"}"#);
+
+            // A per-operation limit may exceed the app-wide one
+            archimedes_configure_operation(app, op_id.as_ptr(), 16, 0);
+            let response = dispatch(&*(app as *const AppState), &request).unwrap();
+            assert_eq!(response.status_code, 200);
+            archimedes_free(app);
+        }
+    }
+
+    #[test]
+    fn test_dispatch_contract_load_error() {
+        let contract_path = CString::new("/nonexistent/contract.json").unwrap();
+        let config = ArchimedesConfig {
+            contract_path: contract_path.as_ptr(),
+            ..Default::default()
+        };
+
+        unsafe {
+            let app = archimedes_new(&config);
+            let state = &*(app as *const AppState);
+            assert!(dispatch(state, &request("GET", "/users")).is_err());
+            archimedes_free(app);
+        }
+    }
+}
@@ -16,6 +16,8 @@ use std::ffi::{CStr, CString};
 use std::os::raw::c_char;
 use std::ptr;
 
+use crate::response::{malloc_array, malloc_bytes, malloc_string};
+
 // ============================================================================
 // Form Data
 // ============================================================================
@@ -960,11 +962,8 @@ pub unsafe extern "C" fn archimedes_file_response(
     };
 
     // Copy data
-    let mut body_data = Vec::with_capacity(data_len);
-    body_data.extend_from_slice(std::slice::from_raw_parts(data, data_len));
-    let body_ptr = body_data.as_ptr() as *const c_char;
-    let body_len = body_data.len();
-    std::mem::forget(body_data);
+    let body_ptr = malloc_bytes(std::slice::from_raw_parts(data, data_len));
+    let body_len = data_len;
 
     // Determine content type
     let mime_type = if content_type.is_null() {
@@ -975,9 +974,7 @@ pub unsafe extern "C" fn archimedes_file_response(
             .unwrap_or("application/octet-stream")
             .to_string()
     };
-    let content_type_ptr = CString::new(mime_type)
-        .map(|s| s.into_raw() as *const c_char)
-        .unwrap_or(ptr::null());
+    let content_type_ptr = malloc_string(&mime_type);
 
     // Build Content-Disposition header
     let disposition = if inline_disposition {
@@ -987,20 +984,8 @@ pub unsafe extern "C" fn archimedes_file_response(
     };
 
     // Create headers array
-    let header_name = CString::new("Content-Disposition")
-        .unwrap()
-        .into_raw() as *const c_char;
-    let header_value = CString::new(disposition)
-        .map(|s| s.into_raw() as *const c_char)
-        .unwrap_or(ptr::null());
-
-    let names = vec![header_name];
-    let values = vec![header_value];
-
-    let names_ptr = names.as_ptr() as *const *const c_char;
-    let values_ptr = values.as_ptr() as *const *const c_char;
-    std::mem::forget(names);
-    std::mem::forget(values);
+    let names = [malloc_string("Content-Disposition")];
+    let values = [malloc_string(&disposition)];
 
     ArchimedesResponseData {
         status_code: 200,
@@ -1009,8 +994,9 @@ pub unsafe extern "C" fn archimedes_file_response(
         body_owned: true,
         content_type: content_type_ptr,
         headers_count: 1,
-        header_names: names_ptr,
-        header_values: values_ptr,
+        header_names: malloc_array(&names),
+        header_values: malloc_array(&values),
+        headers_owned: true,
     }
 }
 
@@ -1036,20 +1022,8 @@ pub unsafe extern "C" fn archimedes_redirect(
 
     // Build Location header
     let location_str = CStr::from_ptr(location).to_str().unwrap_or("");
-    let header_name = CString::new("Location")
-        .unwrap()
-        .into_raw() as *const c_char;
-    let header_value = CString::new(location_str)
-        .map(|s| s.into_raw() as *const c_char)
-        .unwrap_or(ptr::null());
-
-    let names = vec![header_name];
-    let values = vec![header_value];
-
-    let names_ptr = names.as_ptr() as *const *const c_char;
-    let values_ptr = values.as_ptr() as *const *const c_char;
-    std::mem::forget(names);
-    std::mem::forget(values);
+    let names = [malloc_string("Location")];
+    let values = [malloc_string(location_str)];
 
     ArchimedesResponseData {
         status_code,
@@ -1058,8 +1032,9 @@ pub unsafe extern "C" fn archimedes_redirect(
         body_owned: false,
         content_type: ptr::null(),
         headers_count: 1,
-        header_names: names_ptr,
-        header_values: values_ptr,
+        header_names: malloc_array(&names),
+        header_values: malloc_array(&values),
+        headers_owned: true,
     }
 }
 
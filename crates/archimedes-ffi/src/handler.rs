@@ -64,6 +64,17 @@ impl HandlerRegistry {
         Ok(())
     }
 
+    /// Remove the handler for an operation
+    ///
+    /// Returns `true` if a handler was registered.
+    pub fn unregister(&self, operation_id: &str) -> bool {
+        let removed = self.handlers.write().remove(operation_id).is_some();
+        if removed {
+            tracing::debug!(operation_id, "Unregistered handler");
+        }
+        removed
+    }
+
     /// Get a handler for an operation
     pub fn get(&self, operation_id: &str) -> Option<RegisteredHandler> {
         self.handlers.read().get(operation_id).cloned()
@@ -170,6 +181,23 @@ mod tests {
         assert!(result.is_err());
     }
 
+    #[test]
+    fn test_registry_unregister() {
+        let registry = HandlerRegistry::new();
+        registry
+            .register("op", test_handler, std::ptr::null_mut())
+            .unwrap();
+
+        assert!(registry.unregister("op"));
+        assert!(!registry.has_handler("op"));
+        assert!(!registry.unregister("op"));
+
+        // The operation can be registered again
+        registry
+            .register("op", test_handler, std::ptr::null_mut())
+            .unwrap();
+    }
+
     #[test]
     fn test_registry_get() {
         let registry = HandlerRegistry::new();
@@ -207,6 +235,11 @@ mod tests {
             headers_count: 0,
             header_names: std::ptr::null(),
             header_values: std::ptr::null(),
+            tls_info_json: std::ptr::null(),
+            raw_path: std::ptr::null(),
+            raw_query: std::ptr::null(),
+            remote_addr: std::ptr::null(),
+            response_stream: std::ptr::null_mut(),
         };
 
         let response = invoke_handler(&handler, &ctx, &[]);
@@ -68,6 +68,7 @@
 
 mod app;
 mod config;
+mod dispatch;
 mod error;
 mod extractors;
 mod handler;
@@ -77,13 +78,18 @@ mod request;
 mod response;
 mod router;
 mod runtime;
+mod stream;
 mod test_client;
 mod types;
+mod validation;
+mod ws;
 
 // Public re-exports for FFI consumers
 pub use app::{
-    archimedes_free, archimedes_is_running, archimedes_load_contract, archimedes_new,
-    archimedes_register_handler, archimedes_run, archimedes_stop, archimedes_version,
+    archimedes_configure_operation, archimedes_free, archimedes_handler_count,
+    archimedes_is_running, archimedes_load_contract, archimedes_new, archimedes_register_handler,
+    archimedes_run, archimedes_set_listen_addr, archimedes_stop, archimedes_unregister_handler,
+    archimedes_version,
 };
 pub use config::ArchimedesConfig;
 pub use error::FfiError;
@@ -143,15 +149,22 @@ pub use extractors::{
     ArchimedesForm, ArchimedesMultipart, ArchimedesMultipartField, ArchimedesSameSite,
     ArchimedesSetCookie,
 };
+pub use stream::{
+    archimedes_stream_continue, archimedes_stream_flush, archimedes_stream_start,
+    archimedes_stream_write, ArchimedesResponseStream,
+};
 pub use test_client::{
-    archimedes_string_free, archimedes_test_client_delete, archimedes_test_client_free,
-    archimedes_test_client_get, archimedes_test_client_new, archimedes_test_client_patch,
-    archimedes_test_client_post, archimedes_test_client_put, archimedes_test_client_request,
-    archimedes_test_client_with_bearer_token, archimedes_test_client_with_header,
+    archimedes_string_free, archimedes_test_client_delete, archimedes_test_client_for_app,
+    archimedes_test_client_free, archimedes_test_client_get, archimedes_test_client_new,
+    archimedes_test_client_patch, archimedes_test_client_post, archimedes_test_client_put,
+    archimedes_test_client_request, archimedes_test_client_with_bearer_token,
+    archimedes_test_client_with_header, archimedes_test_client_with_remote_addr,
     archimedes_test_response_assert_body_contains, archimedes_test_response_assert_header,
     archimedes_test_response_assert_status, archimedes_test_response_assert_success,
-    archimedes_test_response_body, archimedes_test_response_free,
-    archimedes_test_response_get_header, archimedes_test_response_is_client_error,
+    archimedes_test_response_body, archimedes_test_response_chunk_count,
+    archimedes_test_response_continued, archimedes_test_response_free,
+    archimedes_test_response_get_header, archimedes_test_response_header_at,
+    archimedes_test_response_header_count, archimedes_test_response_is_client_error,
     archimedes_test_response_is_server_error, archimedes_test_response_is_success,
     archimedes_test_response_status_code, archimedes_test_response_text, ArchimedesTestClient,
     ArchimedesTestResponse,
@@ -160,6 +173,12 @@ pub use types::{
     ArchimedesAsyncCallback, ArchimedesError, ArchimedesHandlerFn, ArchimedesRequestContext,
     ArchimedesResponseData,
 };
+pub use validation::archimedes_validate_request;
+pub use ws::{
+    archimedes_ws_close, archimedes_ws_free_message, archimedes_ws_read, archimedes_ws_shutdown,
+    archimedes_ws_upgrade, archimedes_ws_write, ArchimedesWebSocket, ARCHIMEDES_WS_BINARY,
+    ARCHIMEDES_WS_CLOSE, ARCHIMEDES_WS_PING, ARCHIMEDES_WS_PONG, ARCHIMEDES_WS_TEXT,
+};
 
 use std::ffi::CStr;
 use std::os::raw::c_char;
@@ -2,6 +2,7 @@
 //!
 //! Converts internal Archimedes request types to FFI-safe structs.
 
+use crate::stream::ArchimedesResponseStream;
 use crate::types::ArchimedesRequestContext;
 use std::ffi::CString;
 use std::os::raw::c_char;
@@ -20,6 +21,11 @@ pub(crate) struct RequestContextBuilder {
     path: CString,
     query: CString,
     caller_identity_json: CString,
+    tls_info_json: Option<CString>,
+    raw_path: Option<CString>,
+    raw_query: Option<CString>,
+    remote_addr: Option<CString>,
+    response_stream: *mut ArchimedesResponseStream,
 
     // Path parameters
     path_param_names: Vec<CString>,
@@ -46,6 +52,11 @@ impl RequestContextBuilder {
             path: CString::new(path).unwrap_or_default(),
             query: CString::new("").unwrap_or_default(),
             caller_identity_json: CString::new("null").unwrap_or_default(),
+            tls_info_json: None,
+            raw_path: None,
+            raw_query: None,
+            remote_addr: None,
+            response_stream: std::ptr::null_mut(),
             path_param_names: Vec::new(),
             path_param_values: Vec::new(),
             path_param_name_ptrs: Vec::new(),
@@ -76,6 +87,31 @@ impl RequestContextBuilder {
         self
     }
 
+    /// Set TLS connection info as JSON (omit for plaintext connections)
+    pub fn with_tls_info(mut self, tls_info_json: &str) -> Self {
+        self.tls_info_json = CString::new(tls_info_json).ok();
+        self
+    }
+
+    /// Set the request target as received, before percent-decoding
+    pub fn with_raw_target(mut self, raw_path: &str, raw_query: &str) -> Self {
+        self.raw_path = CString::new(raw_path).ok();
+        self.raw_query = CString::new(raw_query).ok();
+        self
+    }
+
+    /// Set the client's network address
+    pub fn with_remote_addr(mut self, remote_addr: &str) -> Self {
+        self.remote_addr = CString::new(remote_addr).ok();
+        self
+    }
+
+    /// Set the stream the handler may send its response through
+    pub fn with_response_stream(mut self, stream: *mut ArchimedesResponseStream) -> Self {
+        self.response_stream = stream;
+        self
+    }
+
     /// Add path parameters
     pub fn with_path_params(mut self, params: &[(String, String)]) -> Self {
         self.path_param_names = params
@@ -146,6 +182,23 @@ impl RequestContextBuilder {
             } else {
                 self.header_value_ptrs.as_ptr()
             },
+            tls_info_json: self
+                .tls_info_json
+                .as_ref()
+                .map_or(std::ptr::null(), |s| s.as_ptr()),
+            raw_path: self
+                .raw_path
+                .as_ref()
+                .map_or(std::ptr::null(), |s| s.as_ptr()),
+            raw_query: self
+                .raw_query
+                .as_ref()
+                .map_or(std::ptr::null(), |s| s.as_ptr()),
+            remote_addr: self
+                .remote_addr
+                .as_ref()
+                .map_or(std::ptr::null(), |s| s.as_ptr()),
+            response_stream: self.response_stream,
         }
     }
 }
@@ -224,6 +277,50 @@ mod tests {
         assert!(!ctx.header_names.is_null());
     }
 
+    #[test]
+    fn test_builder_with_tls_info() {
+        let mut builder = RequestContextBuilder::new("req-1", "op", "GET", "/")
+            .with_tls_info(r#"{"version":"TLSv1.3"}"#);
+        let ctx = builder.build();
+
+        unsafe {
+            assert_eq!(
+                CStr::from_ptr(ctx.tls_info_json).to_str().unwrap(),
+                r#"{"version":"TLSv1.3"}"#
+            );
+        }
+    }
+
+    #[test]
+    fn test_builder_with_raw_target() {
+        let mut builder = RequestContextBuilder::new("req-1", "op", "GET", "/files/a/b")
+            .with_raw_target("/files//a/./b", "q=a%20b");
+        let ctx = builder.build();
+
+        unsafe {
+            assert_eq!(CStr::from_ptr(ctx.path).to_str().unwrap(), "/files/a/b");
+            assert_eq!(
+                CStr::from_ptr(ctx.raw_path).to_str().unwrap(),
+                "/files//a/./b"
+            );
+            assert_eq!(CStr::from_ptr(ctx.raw_query).to_str().unwrap(), "q=a%20b");
+        }
+    }
+
+    #[test]
+    fn test_builder_with_remote_addr() {
+        let mut builder = RequestContextBuilder::new("req-1", "op", "GET", "/")
+            .with_remote_addr("203.0.113.7:52100");
+        let ctx = builder.build();
+
+        unsafe {
+            assert_eq!(
+                CStr::from_ptr(ctx.remote_addr).to_str().unwrap(),
+                "203.0.113.7:52100"
+            );
+        }
+    }
+
     #[test]
     fn test_builder_empty_params() {
         let mut builder = RequestContextBuilder::new("req-1", "op", "GET", "/");
@@ -234,5 +331,9 @@ mod tests {
         assert!(ctx.path_param_values.is_null());
         assert_eq!(ctx.headers_count, 0);
         assert!(ctx.header_names.is_null());
+        assert!(ctx.tls_info_json.is_null());
+        assert!(ctx.raw_path.is_null());
+        assert!(ctx.raw_query.is_null());
+        assert!(ctx.remote_addr.is_null());
     }
 }
@@ -3,7 +3,7 @@
 //! Converts FFI response data to internal Archimedes types.
 
 use crate::types::ArchimedesResponseData;
-use std::ffi::CStr;
+use std::ffi::{c_char, CStr};
 
 /// Convert FFI response to HTTP response bytes
 ///
@@ -71,13 +71,72 @@ pub(crate) fn extract_headers(response: &ArchimedesResponseData) -> Vec<(String,
 ///
 /// # Safety
 ///
-/// Only call this if body_owned is true and body was allocated with archimedes_alloc.
+/// Only call this if body_owned is true and body was allocated with malloc.
 pub(crate) unsafe fn maybe_free_response_body(response: &ArchimedesResponseData) {
     if response.body_owned && !response.body.is_null() {
-        // The body was allocated with archimedes_alloc, free it
-        let ptr = response.body as *mut u8;
-        let layout = std::alloc::Layout::from_size_align_unchecked(response.body_len, 1);
-        std::alloc::dealloc(ptr, layout);
+        // The body was allocated by the handler with malloc, free it
+        libc::free(response.body as *mut libc::c_void);
+    }
+}
+
+/// Free the content type and header arrays if they were allocated by the
+/// handler
+///
+/// # Safety
+///
+/// If headers_owned is true, content_type, the header arrays and every
+/// string in them must have been allocated with malloc (or be null).
+pub(crate) unsafe fn maybe_free_response_headers(response: &ArchimedesResponseData) {
+    if !response.headers_owned {
+        return;
+    }
+    libc::free(response.content_type as *mut libc::c_void);
+    for array in [response.header_names, response.header_values] {
+        if array.is_null() {
+            continue;
+        }
+        for &s in std::slice::from_raw_parts(array, response.headers_count) {
+            libc::free(s as *mut libc::c_void);
+        }
+        libc::free(array as *mut libc::c_void);
+    }
+}
+
+/// Copy bytes into a buffer allocated with malloc, for response memory that
+/// Archimedes frees (null for an empty slice)
+pub(crate) fn malloc_bytes(bytes: &[u8]) -> *const c_char {
+    if bytes.is_empty() {
+        return std::ptr::null();
+    }
+    unsafe {
+        let ptr = libc::malloc(bytes.len()).cast::<u8>();
+        if !ptr.is_null() {
+            std::ptr::copy_nonoverlapping(bytes.as_ptr(), ptr, bytes.len());
+        }
+        ptr.cast()
+    }
+}
+
+/// Copy a string into a null-terminated C string allocated with malloc
+pub(crate) fn malloc_string(s: &str) -> *const c_char {
+    let mut bytes = Vec::with_capacity(s.len() + 1);
+    bytes.extend_from_slice(s.as_bytes());
+    bytes.push(0);
+    malloc_bytes(&bytes)
+}
+
+/// Copy string pointers into an array allocated with malloc
+pub(crate) fn malloc_array(ptrs: &[*const c_char]) -> *const *const c_char {
+    if ptrs.is_empty() {
+        return std::ptr::null();
+    }
+    unsafe {
+        let size = std::mem::size_of_val(ptrs);
+        let array = libc::malloc(size).cast::<*const c_char>();
+        if !array.is_null() {
+            std::ptr::copy_nonoverlapping(ptrs.as_ptr(), array, ptrs.len());
+        }
+        array.cast_const()
     }
 }
 
@@ -160,6 +219,32 @@ mod tests {
         assert_eq!(headers[1], ("X-Other".to_string(), "value2".to_string()));
     }
 
+    #[test]
+    fn test_free_owned_headers() {
+        let names = [malloc_string("X-Custom")];
+        let values = [malloc_string("value1")];
+        let response = ArchimedesResponseData {
+            body: malloc_bytes(b"{}"),
+            body_len: 2,
+            body_owned: true,
+            content_type: malloc_string("application/json"),
+            headers_count: 1,
+            header_names: malloc_array(&names),
+            header_values: malloc_array(&values),
+            headers_owned: true,
+            ..Default::default()
+        };
+
+        assert_eq!(
+            extract_headers(&response),
+            vec![("X-Custom".to_string(), "value1".to_string())]
+        );
+        unsafe {
+            maybe_free_response_body(&response);
+            maybe_free_response_headers(&response);
+        }
+    }
+
     #[test]
     fn test_invalid_status_code() {
         let response = ArchimedesResponseData {
@@ -0,0 +1,303 @@
+//! Streaming response FFI for C/C++ bindings.
+//!
+//! Lets a handler send its response incrementally, such as chunked output,
+//! server-sent events or a large file, instead of returning the whole body
+//! in its `archimedes_response_data`. The request context carries a
+//! `response_stream` handle. The handler passes the status and headers to
+//! `archimedes_stream_start`, then sends each chunk with
+//! `archimedes_stream_write` and pushes buffered chunks to the client with
+//! `archimedes_stream_flush`.
+//!
+//! A handler that reads a request sent with `Expect: 100-continue` itself
+//! calls `archimedes_stream_continue` to send the 100 Continue interim
+//! response before the stream starts.
+//!
+//! Once a stream has started, the status, body and headers of the response
+//! data the handler returns are ignored; owned memory in it is still freed.
+//!
+//! ## Example (C)
+//!
+//! ```c
+//! archimedes_response_data head = {0};
+//! head.status_code = 200;
+//! head.content_type = "text/event-stream";
+//! archimedes_stream_start(ctx->response_stream, &head);
+//!
+//! for (int i = 0; i < 3; i++) {
+//!     archimedes_stream_write(ctx->response_stream, (const uint8_t*)"data: tick\n\n", 12);
+//!     archimedes_stream_flush(ctx->response_stream);
+//! }
+//! return head;
+//! ```
+
+use crate::error::FfiError;
+use crate::response::{extract_headers, response_to_bytes};
+use crate::set_last_error;
+use crate::types::{ArchimedesError, ArchimedesResponseData};
+
+/// Opaque response stream handle for FFI
+#[repr(C)]
+pub struct ArchimedesResponseStream {
+    _opaque: [u8; 0],
+}
+
+/// Internal state behind `ArchimedesResponseStream`
+///
+/// The in-process dispatcher collects the stream into its response; chunks
+/// are appended to `body` as they are written.
+#[derive(Debug, Default)]
+pub(crate) struct ResponseStream {
+    /// Status code and headers, once the stream has started
+    pub head: Option<(u16, Vec<(String, String)>)>,
+    /// Body bytes written so far
+    pub body: Vec<u8>,
+    /// Number of chunks written
+    pub chunks: usize,
+    /// Whether a 100 Continue interim response was sent
+    pub continued: bool,
+}
+
+impl ResponseStream {
+    /// Handle to pass to the handler in its request context
+    pub fn as_handle(&mut self) -> *mut ArchimedesResponseStream {
+        (self as *mut Self).cast()
+    }
+
+    /// Whether the handler has started streaming the response
+    pub fn started(&self) -> bool {
+        self.head.is_some()
+    }
+}
+
+/// Get the stream behind a handle, setting the last error if it is null
+unsafe fn stream_state<'a>(
+    stream: *mut ArchimedesResponseStream,
+) -> Option<&'a mut ResponseStream> {
+    if stream.is_null() {
+        set_last_error(FfiError::NullPointer("stream"));
+        return None;
+    }
+    Some(&mut *stream.cast::<ResponseStream>())
+}
+
+/// Send a 100 Continue interim response
+///
+/// Tells a client that sent `Expect: 100-continue` to send the request
+/// body. Later calls do nothing.
+///
+/// # Safety
+///
+/// - `stream` must be the `response_stream` of the current request context
+///
+/// Returns an error if the stream has already started.
+#[no_mangle]
+pub unsafe extern "C" fn archimedes_stream_continue(
+    stream: *mut ArchimedesResponseStream,
+) -> ArchimedesError {
+    let Some(state) = stream_state(stream) else {
+        return ArchimedesError::NullPointer;
+    };
+    if state.started() {
+        set_last_error(FfiError::InvalidOperation(
+            "response stream already started".to_string(),
+        ));
+        return ArchimedesError::InvalidOperation;
+    }
+    state.continued = true;
+    ArchimedesError::Ok
+}
+
+/// Start a streamed response
+///
+/// Sends the status code, content type (if set) and headers of `head`. Its
+/// body, if any, is written as the first chunk. The stream does not take
+/// ownership of any memory in `head`.
+///
+/// # Safety
+///
+/// - `stream` must be the `response_stream` of the current request context
+/// - `head` must point to valid response data
+///
+/// Returns an error if the stream has already started.
+#[no_mangle]
+pub unsafe extern "C" fn archimedes_stream_start(
+    stream: *mut ArchimedesResponseStream,
+    head: *const ArchimedesResponseData,
+) -> ArchimedesError {
+    let Some(state) = stream_state(stream) else {
+        return ArchimedesError::NullPointer;
+    };
+    if head.is_null() {
+        set_last_error(FfiError::NullPointer("head"));
+        return ArchimedesError::NullPointer;
+    }
+    if state.started() {
+        set_last_error(FfiError::InvalidOperation(
+            "response stream already started".to_string(),
+        ));
+        return ArchimedesError::InvalidOperation;
+    }
+
+    let head = &*head;
+    let (status_code, body, content_type) = response_to_bytes(head);
+    let mut headers = extract_headers(head);
+    if !head.content_type.is_null() {
+        headers.push(("Content-Type".to_string(), content_type));
+    }
+    state.head = Some((status_code, headers));
+    if !body.is_empty() {
+        state.body.extend_from_slice(&body);
+        state.chunks += 1;
+    }
+    ArchimedesError::Ok
+}
+
+/// Write a chunk of a streamed response
+///
+/// # Safety
+///
+/// - `stream` must be the `response_stream` of the current request context
+/// - `data` must point to `len` bytes (may be null when `len` is 0)
+///
+/// Returns an error if the stream has not been started.
+#[no_mangle]
+pub unsafe extern "C" fn archimedes_stream_write(
+    stream: *mut ArchimedesResponseStream,
+    data: *const u8,
+    len: usize,
+) -> ArchimedesError {
+    let Some(state) = stream_state(stream) else {
+        return ArchimedesError::NullPointer;
+    };
+    if !state.started() {
+        set_last_error(FfiError::InvalidOperation(
+            "response stream not started".to_string(),
+        ));
+        return ArchimedesError::InvalidOperation;
+    }
+    if len == 0 {
+        return ArchimedesError::Ok;
+    }
+    if data.is_null() {
+        set_last_error(FfiError::NullPointer("data"));
+        return ArchimedesError::NullPointer;
+    }
+
+    state
+        .body
+        .extend_from_slice(std::slice::from_raw_parts(data, len));
+    state.chunks += 1;
+    ArchimedesError::Ok
+}
+
+/// Push the chunks written so far to the client
+///
+/// # Safety
+///
+/// - `stream` must be the `response_stream` of the current request context
+///
+/// Returns an error if the stream has not been started.
+#[no_mangle]
+pub unsafe extern "C" fn archimedes_stream_flush(
+    stream: *mut ArchimedesResponseStream,
+) -> ArchimedesError {
+    let Some(state) = stream_state(stream) else {
+        return ArchimedesError::NullPointer;
+    };
+    if !state.started() {
+        set_last_error(FfiError::InvalidOperation(
+            "response stream not started".to_string(),
+        ));
+        return ArchimedesError::InvalidOperation;
+    }
+    // Chunks reach the in-process dispatcher as they are written
+    ArchimedesError::Ok
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::ffi::CString;
+    use std::ptr;
+
+    #[test]
+    fn test_stream_start_and_write() {
+        let mut stream = ResponseStream::default();
+        let handle = stream.as_handle();
+        let content_type = CString::new("text/plain").unwrap();
+        let head = ArchimedesResponseData {
+            status_code: 201,
+            body: b"a".as_ptr().cast(),
+            body_len: 1,
+            content_type: content_type.as_ptr(),
+            ..Default::default()
+        };
+
+        unsafe {
+            assert_eq!(
+                archimedes_stream_write(handle, b"b".as_ptr(), 1),
+                ArchimedesError::InvalidOperation
+            );
+            assert_eq!(archimedes_stream_start(handle, &head), ArchimedesError::Ok);
+            assert_eq!(
+                archimedes_stream_start(handle, &head),
+                ArchimedesError::InvalidOperation
+            );
+            assert_eq!(
+                archimedes_stream_write(handle, b"bc".as_ptr(), 2),
+                ArchimedesError::Ok
+            );
+            assert_eq!(archimedes_stream_flush(handle), ArchimedesError::Ok);
+        }
+
+        assert_eq!(
+            stream.head,
+            Some((
+                201,
+                vec![("Content-Type".to_string(), "text/plain".to_string())]
+            ))
+        );
+        assert_eq!(stream.body, b"abc");
+        assert_eq!(stream.chunks, 2);
+    }
+
+    #[test]
+    fn test_stream_continue() {
+        let mut stream = ResponseStream::default();
+        let handle = stream.as_handle();
+        let head = ArchimedesResponseData::default();
+
+        unsafe {
+            assert_eq!(archimedes_stream_continue(handle), ArchimedesError::Ok);
+            assert_eq!(archimedes_stream_continue(handle), ArchimedesError::Ok);
+            assert_eq!(archimedes_stream_start(handle, &head), ArchimedesError::Ok);
+            assert_eq!(
+                archimedes_stream_continue(handle),
+                ArchimedesError::InvalidOperation
+            );
+        }
+        assert!(stream.continued);
+    }
+
+    #[test]
+    fn test_stream_null_safety() {
+        unsafe {
+            assert_eq!(
+                archimedes_stream_start(ptr::null_mut(), ptr::null()),
+                ArchimedesError::NullPointer
+            );
+            assert_eq!(
+                archimedes_stream_write(ptr::null_mut(), ptr::null(), 0),
+                ArchimedesError::NullPointer
+            );
+            assert_eq!(
+                archimedes_stream_flush(ptr::null_mut()),
+                ArchimedesError::NullPointer
+            );
+            assert_eq!(
+                archimedes_stream_continue(ptr::null_mut()),
+                ArchimedesError::NullPointer
+            );
+        }
+    }
+}
@@ -1,25 +1,40 @@
 //! C FFI bindings for Archimedes TestClient.
 //!
 //! This module provides C ABI functions for testing Archimedes applications
-//! without starting a real HTTP server.
+//! without starting a real HTTP server. A client created with
+//! `archimedes_test_client_for_app` dispatches its requests to the app's
+//! registered handlers; one created with `archimedes_test_client_new` echoes
+//! each request back.
 
+use crate::app::{AppState, ArchimedesApp};
+use crate::dispatch::{dispatch, DispatchRequest};
 use std::collections::HashMap;
 use std::ffi::{c_char, CStr, CString};
 use std::ptr;
 
 /// Opaque test client handle.
-#[repr(C)]
 pub struct ArchimedesTestClient {
     default_headers: HashMap<String, String>,
     base_url: String,
+    /// Application requests are dispatched to (null to echo requests)
+    app: *const AppState,
+    /// Peer address handlers see as "ip:port"
+    remote_addr: String,
 }
 
+/// Peer address of test client requests unless set with
+/// `archimedes_test_client_with_remote_addr`
+const DEFAULT_REMOTE_ADDR: &str = "192.0.2.1:1234";
+
 /// Opaque test response handle.
-#[repr(C)]
 pub struct ArchimedesTestResponse {
     status_code: u16,
-    headers: HashMap<String, String>,
+    headers: Vec<(String, String)>,
     body: Vec<u8>,
+    /// Number of chunks a streamed body arrived in (0 if buffered)
+    chunks: usize,
+    /// Whether a 100 Continue interim response preceded the response
+    continued: bool,
 }
 
 // ============================================================================
@@ -47,6 +62,34 @@ pub unsafe extern "C" fn archimedes_test_client_new(
     let client = Box::new(ArchimedesTestClient {
         default_headers: HashMap::new(),
         base_url,
+        app: ptr::null(),
+        remote_addr: DEFAULT_REMOTE_ADDR.to_string(),
+    });
+    Box::into_raw(client)
+}
+
+/// Creates a test client that dispatches requests to an application.
+///
+/// Requests are routed by the operations of the app's contract and passed
+/// to the registered handlers, which run on the calling thread.
+///
+/// # Safety
+/// - `app` must be a valid application pointer that outlives the client.
+/// - Caller must free the returned handle with `archimedes_test_client_free`.
+#[no_mangle]
+pub unsafe extern "C" fn archimedes_test_client_for_app(
+    app: *const ArchimedesApp,
+) -> *mut ArchimedesTestClient {
+    if app.is_null() {
+        crate::set_last_error(crate::error::FfiError::NullPointer("app"));
+        return ptr::null_mut();
+    }
+
+    let client = Box::new(ArchimedesTestClient {
+        default_headers: HashMap::new(),
+        base_url: "http://test".to_string(),
+        app: app.cast(),
+        remote_addr: DEFAULT_REMOTE_ADDR.to_string(),
     });
     Box::into_raw(client)
 }
@@ -91,6 +134,25 @@ pub unsafe extern "C" fn archimedes_test_client_with_header(
     client.default_headers.insert(name, value);
 }
 
+/// Sets the peer address requests appear to come from, as "ip:port".
+///
+/// # Safety
+/// - `client` must be a valid test client pointer.
+/// - `remote_addr` must be a valid null-terminated string.
+#[no_mangle]
+pub unsafe extern "C" fn archimedes_test_client_with_remote_addr(
+    client: *mut ArchimedesTestClient,
+    remote_addr: *const c_char,
+) {
+    if client.is_null() || remote_addr.is_null() {
+        return;
+    }
+
+    if let Ok(remote_addr) = CStr::from_ptr(remote_addr).to_str() {
+        (*client).remote_addr = remote_addr.to_string();
+    }
+}
+
 /// Sets a bearer token for all requests.
 ///
 /// # Safety
@@ -227,6 +289,10 @@ pub unsafe extern "C" fn archimedes_test_client_delete(
 
 /// Makes a request with a custom method.
 ///
+/// `path` may include a query string. Returns NULL and sets the last error
+/// if the request cannot be dispatched, e.g. because the app's contract
+/// cannot be loaded.
+///
 /// # Safety
 /// - `client` must be a valid test client pointer.
 /// - `method` and `path` must be valid null-terminated strings.
@@ -245,7 +311,7 @@ pub unsafe extern "C" fn archimedes_test_client_request(
     }
 
     let client = &*client;
-    let _method = match CStr::from_ptr(method).to_str() {
+    let method = match CStr::from_ptr(method).to_str() {
         Ok(s) => s.to_string(),
         Err(_) => return ptr::null_mut(),
     };
@@ -255,7 +321,7 @@ pub unsafe extern "C" fn archimedes_test_client_request(
     };
 
     // Build full URL
-    let _url = if path.starts_with("http://") || path.starts_with("https://") {
+    let url = if path.starts_with("http://") || path.starts_with("https://") {
         path
     } else {
         format!("{}{}", client.base_url, path)
@@ -263,18 +329,56 @@ pub unsafe extern "C" fn archimedes_test_client_request(
 
     // Get body bytes
     let body_bytes = if body.is_null() || body_len == 0 {
-        None
+        &[][..]
     } else {
-        Some(std::slice::from_raw_parts(body, body_len).to_vec())
+        std::slice::from_raw_parts(body, body_len)
     };
 
-    // For now, create a mock response
-    let response = Box::new(ArchimedesTestResponse {
-        status_code: 200,
-        headers: client.default_headers.clone(),
-        body: body_bytes.unwrap_or_default(),
-    });
-    Box::into_raw(response)
+    let headers: Vec<(String, String)> = client
+        .default_headers
+        .iter()
+        .map(|(name, value)| (name.clone(), value.clone()))
+        .collect();
+
+    // Without an app, echo the request
+    if client.app.is_null() {
+        return Box::into_raw(Box::new(ArchimedesTestResponse {
+            status_code: 200,
+            headers,
+            body: body_bytes.to_vec(),
+            chunks: 0,
+            continued: false,
+        }));
+    }
+
+    let request = DispatchRequest {
+        method: &method,
+        target: request_target(&url),
+        headers: &headers,
+        body: body_bytes,
+        remote_addr: &client.remote_addr,
+    };
+    match dispatch(&*client.app, &request) {
+        Ok(response) => Box::into_raw(Box::new(ArchimedesTestResponse {
+            status_code: response.status_code,
+            headers: response.headers,
+            body: response.body,
+            chunks: response.chunks,
+            continued: response.continued,
+        })),
+        Err(e) => {
+            crate::set_last_error(crate::error::FfiError::Internal(e));
+            ptr::null_mut()
+        }
+    }
+}
+
+/// Strips the scheme and authority from a URL, leaving the path and query
+fn request_target(url: &str) -> &str {
+    let Some((_, rest)) = url.split_once("://") else {
+        return url;
+    };
+    rest.find('/').map_or("/", |i| &rest[i..])
 }
 
 // ============================================================================
@@ -382,6 +486,85 @@ pub unsafe extern "C" fn archimedes_test_response_get_header(
     ptr::null_mut()
 }
 
+/// Gets the number of chunks a streamed response body arrived in.
+///
+/// Returns 0 for a response the handler returned in one piece.
+///
+/// # Safety
+/// - `response` must be a valid test response pointer.
+#[no_mangle]
+pub unsafe extern "C" fn archimedes_test_response_chunk_count(
+    response: *const ArchimedesTestResponse,
+) -> usize {
+    if response.is_null() {
+        return 0;
+    }
+    (*response).chunks
+}
+
+/// Checks whether a 100 Continue interim response preceded the response.
+///
+/// # Safety
+/// - `response` must be a valid test response pointer.
+#[no_mangle]
+pub unsafe extern "C" fn archimedes_test_response_continued(
+    response: *const ArchimedesTestResponse,
+) -> bool {
+    if response.is_null() {
+        return false;
+    }
+    (*response).continued
+}
+
+/// Gets the number of response headers.
+///
+/// # Safety
+/// - `response` must be a valid test response pointer.
+#[no_mangle]
+pub unsafe extern "C" fn archimedes_test_response_header_count(
+    response: *const ArchimedesTestResponse,
+) -> usize {
+    if response.is_null() {
+        return 0;
+    }
+    (*response).headers.len()
+}
+
+/// Gets the response header at `index` as name and value byte slices.
+///
+/// # Safety
+/// - `response` must be a valid test response pointer.
+/// - `name`, `name_len`, `value` and `value_len` must be valid pointers.
+/// - The returned slices are valid until the response is freed.
+/// - Returns false if `index` is out of range.
+#[no_mangle]
+pub unsafe extern "C" fn archimedes_test_response_header_at(
+    response: *const ArchimedesTestResponse,
+    index: usize,
+    name: *mut *const u8,
+    name_len: *mut usize,
+    value: *mut *const u8,
+    value_len: *mut usize,
+) -> bool {
+    if response.is_null()
+        || name.is_null()
+        || name_len.is_null()
+        || value.is_null()
+        || value_len.is_null()
+    {
+        return false;
+    }
+
+    let Some((k, v)) = (*response).headers.get(index) else {
+        return false;
+    };
+    *name = k.as_ptr();
+    *name_len = k.len();
+    *value = v.as_ptr();
+    *value_len = v.len();
+    true
+}
+
 /// Gets the response body as a pointer and length.
 ///
 /// # Safety
@@ -608,6 +791,18 @@ mod tests {
         }
     }
 
+    #[test]
+    fn test_test_client_with_remote_addr() {
+        unsafe {
+            let client = archimedes_test_client_new(ptr::null());
+            assert_eq!((*client).remote_addr, DEFAULT_REMOTE_ADDR);
+            let addr = CString::new("203.0.113.7:52100").unwrap();
+            archimedes_test_client_with_remote_addr(client, addr.as_ptr());
+            assert_eq!((*client).remote_addr, "203.0.113.7:52100");
+            archimedes_test_client_free(client);
+        }
+    }
+
     #[test]
     fn test_test_client_with_bearer_token() {
         unsafe {
@@ -636,6 +831,77 @@ mod tests {
         }
     }
 
+    #[test]
+    fn test_test_response_header_at() {
+        unsafe {
+            let client = archimedes_test_client_new(ptr::null());
+            let name = CString::new("X-Api-Key").unwrap();
+            let value = CString::new("secret123").unwrap();
+            archimedes_test_client_with_header(client, name.as_ptr(), value.as_ptr());
+            let path = CString::new("/test").unwrap();
+            let response = archimedes_test_client_get(client, path.as_ptr());
+            assert_eq!(archimedes_test_response_header_count(response), 1);
+
+            let (mut k, mut k_len) = (ptr::null(), 0);
+            let (mut v, mut v_len) = (ptr::null(), 0);
+            assert!(archimedes_test_response_header_at(
+                response, 0, &mut k, &mut k_len, &mut v, &mut v_len
+            ));
+            assert_eq!(std::slice::from_raw_parts(k, k_len), b"X-Api-Key");
+            assert_eq!(std::slice::from_raw_parts(v, v_len), b"secret123");
+            assert!(!archimedes_test_response_header_at(
+                response, 1, &mut k, &mut k_len, &mut v, &mut v_len
+            ));
+            archimedes_test_response_free(response);
+            archimedes_test_client_free(client);
+        }
+    }
+
+    #[test]
+    fn test_test_client_for_app() {
+        let contract_path = CString::new("contract.json").unwrap();
+        let config = crate::config::ArchimedesConfig {
+            contract_path: contract_path.as_ptr(),
+            ..Default::default()
+        };
+        let contract = CString::new(
+            r#"{"operations": [{"id": "listUsers", "method": "GET", "path": "/users"}]}"#,
+        )
+        .unwrap();
+
+        unsafe {
+            let app = crate::app::archimedes_new(&config);
+            crate::app::archimedes_load_contract(app, contract.as_ptr());
+            let client = archimedes_test_client_for_app(app);
+            assert!(!client.is_null());
+
+            // Known operation without a handler
+            let path = CString::new("http://test/users?limit=5").unwrap();
+            let response = archimedes_test_client_get(client, path.as_ptr());
+            assert!(!response.is_null());
+            assert_eq!(archimedes_test_response_status_code(response), 501);
+            archimedes_test_response_free(response);
+
+            let path = CString::new("/missing").unwrap();
+            let response = archimedes_test_client_get(client, path.as_ptr());
+            assert_eq!(archimedes_test_response_status_code(response), 404);
+            archimedes_test_response_free(response);
+
+            archimedes_test_client_free(client);
+            crate::app::archimedes_free(app);
+        }
+    }
+
+    #[test]
+    fn test_request_target() {
+        assert_eq!(
+            request_target("http://test/users?limit=5"),
+            "/users?limit=5"
+        );
+        assert_eq!(request_target("http://test"), "/");
+        assert_eq!(request_target("/users"), "/users");
+    }
+
     #[test]
     fn test_test_response_status_checks() {
         unsafe {
@@ -3,6 +3,7 @@
 //! All types in this module use `#[repr(C)]` to ensure stable ABI across
 //! different compilers and languages.
 
+use crate::stream::ArchimedesResponseStream;
 use std::os::raw::c_char;
 
 /// Error codes returned by Archimedes FFI functions
@@ -107,6 +108,16 @@ pub struct ArchimedesRequestContext {
     pub header_names: *const *const c_char,
     /// Header values (array of C strings)
     pub header_values: *const *const c_char,
+    /// JSON-encoded TLS connection info (null for plaintext connections)
+    pub tls_info_json: *const c_char,
+    /// Request path as received, before percent-decoding (null if unknown)
+    pub raw_path: *const c_char,
+    /// Query string as received (null if unknown)
+    pub raw_query: *const c_char,
+    /// Client's network address as "ip:port" (null if unknown)
+    pub remote_addr: *const c_char,
+    /// Stream for sending the response incrementally (see `stream`)
+    pub response_stream: *mut ArchimedesResponseStream,
 }
 
 /// Response data returned by handlers
@@ -114,7 +125,11 @@ pub struct ArchimedesRequestContext {
 /// The handler must populate this struct with response information.
 /// For `body`, the handler can either:
 /// - Return a static string (set `body_owned` to false)
-/// - Return memory allocated with `archimedes_alloc` (set `body_owned` to true)
+/// - Return memory allocated with `malloc` (set `body_owned` to true)
+///
+/// `content_type` and the header arrays follow the same rule with
+/// `headers_owned`: when it is true, Archimedes frees the content type, each
+/// header name and value, and both arrays.
 #[repr(C)]
 #[derive(Debug)]
 pub struct ArchimedesResponseData {
@@ -134,6 +149,8 @@ pub struct ArchimedesResponseData {
     pub header_names: *const *const c_char,
     /// Header values (array of C strings)
     pub header_values: *const *const c_char,
+    /// Whether Archimedes should free `content_type` and the header arrays
+    pub headers_owned: bool,
 }
 
 impl Default for ArchimedesResponseData {
@@ -147,6 +164,7 @@ impl Default for ArchimedesResponseData {
             headers_count: 0,
             header_names: std::ptr::null(),
             header_values: std::ptr::null(),
+            headers_owned: false,
         }
     }
 }
@@ -213,6 +231,7 @@ mod tests {
         assert!(response.body.is_null());
         assert_eq!(response.body_len, 0);
         assert!(!response.body_owned);
+        assert!(!response.headers_owned);
     }
 
     #[test]
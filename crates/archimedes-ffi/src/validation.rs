@@ -0,0 +1,532 @@
+//! Request body validation
+//!
+//! Validates request bodies against the request schemas of the
+//! application's contract. The validator is built once per contract and
+//! supports the JSON Schema keywords Themis contracts use: type, enum,
+//! required, properties, additionalProperties, items, minLength, maxLength,
+//! minimum, maximum, pattern and format (email, date-time).
+
+use std::collections::HashMap;
+use std::ffi::{CStr, CString};
+use std::os::raw::c_char;
+use std::ptr;
+use std::sync::OnceLock;
+
+use regex::Regex;
+use serde_json::{json, Map, Value};
+
+use crate::app::{AppState, ArchimedesApp};
+use crate::dispatch::contract_document;
+use crate::error::FfiError;
+use crate::types::ArchimedesError;
+
+/// Prefix of `$ref` values naming an entry of the contract's schemas
+const SCHEMA_REF_PREFIX: &str = "#/schemas/";
+
+/// A deliberately loose check for the "email" format
+fn email_pattern() -> &'static Regex {
+    static PATTERN: OnceLock<Regex> = OnceLock::new();
+    PATTERN.get_or_init(|| Regex::new(r"^[^@\s]+@[^@\s]+\.[^@\s]+$").expect("valid regex"))
+}
+
+/// A single field that failed validation
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub(crate) struct FieldError {
+    /// Location of the field, e.g. "address.city" or "tags[0]" (empty for
+    /// the body itself)
+    pub path: String,
+    /// Schema keyword that failed, e.g. "required" or "minLength"
+    pub rule: String,
+    /// Human-readable description of the failure
+    pub message: String,
+}
+
+/// Validates request bodies against a contract's request schemas
+pub(crate) struct ContractValidator {
+    /// Request schema of each operation, by operation ID
+    operations: HashMap<String, Option<Value>>,
+    /// Named schemas `#/schemas/Name` references resolve to
+    schemas: Map<String, Value>,
+    /// Compiled `pattern` keywords, by pattern
+    patterns: HashMap<String, Regex>,
+}
+
+impl ContractValidator {
+    /// Build a validator from a parsed contract
+    pub fn new(contract: &Value) -> Self {
+        let operations = contract
+            .get("operations")
+            .and_then(Value::as_array)
+            .into_iter()
+            .flatten()
+            .filter_map(|operation| {
+                let id = operation.get("id").and_then(Value::as_str)?;
+                let schema = operation
+                    .get("request_schema")
+                    .filter(|schema| !schema.is_null())
+                    .cloned();
+                Some((id.to_string(), schema))
+            })
+            .collect();
+
+        let mut patterns = HashMap::new();
+        collect_patterns(contract, &mut patterns);
+
+        Self {
+            operations,
+            schemas: contract
+                .get("schemas")
+                .and_then(Value::as_object)
+                .cloned()
+                .unwrap_or_default(),
+            patterns,
+        }
+    }
+
+    /// Build a validator from the application's contract
+    pub fn for_app(state: &AppState) -> Result<Self, String> {
+        contract_document(state).map(|contract| Self::new(&contract))
+    }
+
+    /// Validate a request body against an operation's request schema
+    ///
+    /// Returns every failing field, or `None` if the operation is not in
+    /// the contract. Operations without a request schema accept any body.
+    pub fn validate(&self, operation_id: &str, body: &Value) -> Option<Vec<FieldError>> {
+        let schema = self.operations.get(operation_id)?;
+        let mut errors = Vec::new();
+        if let Some(schema) = schema {
+            self.check(schema, body, "", &mut errors);
+        }
+        Some(errors)
+    }
+
+    /// Follow `#/schemas/Name` references; an unknown reference accepts
+    /// any value
+    fn resolve<'a>(&'a self, mut schema: &'a Value) -> &'a Value {
+        static ANY: Value = Value::Null;
+        // Bound the walk so a reference cycle cannot loop forever
+        for _ in 0..32 {
+            let Some(target) = schema.get("$ref").and_then(Value::as_str) else {
+                return schema;
+            };
+            let name = target.strip_prefix(SCHEMA_REF_PREFIX).unwrap_or(target);
+            match self.schemas.get(name) {
+                Some(resolved) => schema = resolved,
+                None => return &ANY,
+            }
+        }
+        schema
+    }
+
+    /// Check value against schema, appending failures to errors
+    fn check(&self, schema: &Value, value: &Value, path: &str, errors: &mut Vec<FieldError>) {
+        let schema = self.resolve(schema);
+        let name = if path.is_empty() { "body" } else { path };
+        let mut fail = |rule: &str, message: String| {
+            errors.push(FieldError {
+                path: path.to_string(),
+                rule: rule.to_string(),
+                message: format!("{name} {message}"),
+            });
+        };
+
+        if let Some(typ) = schema.get("type").and_then(Value::as_str) {
+            if !matches_type(typ, value) {
+                fail("type", format!("must be of type {typ}"));
+                return;
+            }
+        }
+
+        if let Some(allowed) = schema.get("enum").and_then(Value::as_array) {
+            if !allowed.iter().any(|allowed| json_eq(allowed, value)) {
+                fail("enum", "must be one of the allowed values".to_string());
+            }
+        }
+
+        match value {
+            Value::String(s) => {
+                let length = s.chars().count() as f64;
+                if let Some(min) = schema.get("minLength").and_then(Value::as_f64) {
+                    if length < min {
+                        fail("minLength", format!("must be at least {min} characters"));
+                    }
+                }
+                if let Some(max) = schema.get("maxLength").and_then(Value::as_f64) {
+                    if length > max {
+                        fail("maxLength", format!("must be at most {max} characters"));
+                    }
+                }
+                if let Some(pattern) = schema.get("pattern").and_then(Value::as_str) {
+                    if let Some(re) = self.patterns.get(pattern) {
+                        if !re.is_match(s) {
+                            fail("pattern", format!("must match pattern {pattern}"));
+                        }
+                    }
+                }
+                if let Some(format) = schema.get("format").and_then(Value::as_str) {
+                    if !matches_format(format, s) {
+                        fail("format", format!("must be a valid {format}"));
+                    }
+                }
+            }
+            Value::Number(n) => {
+                let n = n.as_f64().unwrap_or_default();
+                if let Some(min) = schema.get("minimum").and_then(Value::as_f64) {
+                    if n < min {
+                        fail("minimum", format!("must be at least {min}"));
+                    }
+                }
+                if let Some(max) = schema.get("maximum").and_then(Value::as_f64) {
+                    if n > max {
+                        fail("maximum", format!("must be at most {max}"));
+                    }
+                }
+            }
+            Value::Object(object) => {
+                let required = schema.get("required").and_then(Value::as_array);
+                for key in required.into_iter().flatten().filter_map(Value::as_str) {
+                    if !object.contains_key(key) {
+                        let path = join_path(path, key);
+                        errors.push(FieldError {
+                            message: format!("{path} is required"),
+                            path,
+                            rule: "required".to_string(),
+                        });
+                    }
+                }
+
+                let properties = schema.get("properties").and_then(Value::as_object);
+                let additional = schema.get("additionalProperties").and_then(Value::as_bool);
+                let mut keys: Vec<&String> = object.keys().collect();
+                keys.sort();
+                for key in keys {
+                    let path = join_path(path, key);
+                    match properties.and_then(|properties| properties.get(key)) {
+                        Some(property) if property.is_object() => {
+                            self.check(property, &object[key], &path, errors);
+                        }
+                        _ if additional == Some(false) => errors.push(FieldError {
+                            message: format!("{path} is not allowed"),
+                            path,
+                            rule: "additionalProperties".to_string(),
+                        }),
+                        _ => {}
+                    }
+                }
+            }
+            Value::Array(items) => {
+                if let Some(schema) = schema.get("items").filter(|items| items.is_object()) {
+                    for (i, item) in items.iter().enumerate() {
+                        self.check(schema, item, &format!("{path}[{i}]"), errors);
+                    }
+                }
+            }
+            Value::Bool(_) | Value::Null => {}
+        }
+    }
+}
+
+/// Compile every `pattern` keyword in the contract; invalid patterns are
+/// skipped
+fn collect_patterns(value: &Value, patterns: &mut HashMap<String, Regex>) {
+    match value {
+        Value::Object(object) => {
+            if let Some(pattern) = object.get("pattern").and_then(Value::as_str) {
+                if let Ok(re) = Regex::new(pattern) {
+                    patterns.insert(pattern.to_string(), re);
+                }
+            }
+            object
+                .values()
+                .for_each(|value| collect_patterns(value, patterns));
+        }
+        Value::Array(items) => items
+            .iter()
+            .for_each(|value| collect_patterns(value, patterns)),
+        _ => {}
+    }
+}
+
+/// Report whether value has the given JSON Schema type
+fn matches_type(typ: &str, value: &Value) -> bool {
+    match typ {
+        "object" => value.is_object(),
+        "array" => value.is_array(),
+        "string" => value.is_string(),
+        "number" => value.is_number(),
+        "integer" => value.as_f64().is_some_and(|n| n.fract() == 0.0),
+        "boolean" => value.is_boolean(),
+        "null" => value.is_null(),
+        _ => true,
+    }
+}
+
+/// Check the string formats used in contracts; unknown formats are accepted
+fn matches_format(format: &str, value: &str) -> bool {
+    match format {
+        "email" => email_pattern().is_match(value),
+        "date-time" => chrono::DateTime::parse_from_rfc3339(value).is_ok(),
+        _ => true,
+    }
+}
+
+/// Compare JSON values, treating numbers of equal value as equal
+fn json_eq(a: &Value, b: &Value) -> bool {
+    match (a.as_f64(), b.as_f64()) {
+        (Some(a), Some(b)) => a == b,
+        _ => a == b,
+    }
+}
+
+/// Append a property name to a field path
+fn join_path(path: &str, name: &str) -> String {
+    if path.is_empty() {
+        name.to_string()
+    } else {
+        format!("{path}.{name}")
+    }
+}
+
+/// Validate a request body with the application's cached validator
+fn validate_request(
+    state: &AppState,
+    operation_id: &str,
+    body: &[u8],
+) -> Result<Vec<FieldError>, FfiError> {
+    let validator = state.validator().map_err(FfiError::ContractLoad)?;
+    let body: Value = serde_json::from_slice(body)
+        .map_err(|e| FfiError::Validation(format!("invalid JSON body: {e}")))?;
+    validator.validate(operation_id, &body).ok_or_else(|| {
+        FfiError::InvalidOperation(format!("operation {operation_id} not found in contract"))
+    })
+}
+
+/// Validate a JSON request body against the contract's request schema for
+/// an operation
+///
+/// # Safety
+///
+/// - `app` must be a valid application pointer
+/// - `operation_id` must be a valid null-terminated UTF-8 string
+/// - `body` must point to `body_len` readable bytes (may be NULL if 0)
+/// - `out_errors` must be a valid pointer
+///
+/// On success `*out_errors` is a JSON array of `{"path", "rule",
+/// "message"}` objects, empty when the body is valid. The caller must free
+/// it with `archimedes_string_free`. Returns `InvalidOperation` if the
+/// operation is not in the contract, or another error code on failure.
+/// The contract is parsed once and reused until the next
+/// `archimedes_load_contract`.
+#[no_mangle]
+pub unsafe extern "C" fn archimedes_validate_request(
+    app: *const ArchimedesApp,
+    operation_id: *const c_char,
+    body: *const u8,
+    body_len: usize,
+    out_errors: *mut *mut c_char,
+) -> ArchimedesError {
+    if app.is_null() {
+        crate::set_last_error(FfiError::NullPointer("app"));
+        return ArchimedesError::NullPointer;
+    }
+    if operation_id.is_null() {
+        crate::set_last_error(FfiError::NullPointer("operation_id"));
+        return ArchimedesError::NullPointer;
+    }
+    if out_errors.is_null() {
+        crate::set_last_error(FfiError::NullPointer("out_errors"));
+        return ArchimedesError::NullPointer;
+    }
+    *out_errors = ptr::null_mut();
+
+    let state = &*(app as *const AppState);
+    let operation_id = match CStr::from_ptr(operation_id).to_str() {
+        Ok(s) => s,
+        Err(e) => {
+            crate::set_last_error(FfiError::InvalidUtf8(e.to_string()));
+            return ArchimedesError::InvalidUtf8;
+        }
+    };
+    let body = if body.is_null() || body_len == 0 {
+        &[][..]
+    } else {
+        std::slice::from_raw_parts(body, body_len)
+    };
+
+    match validate_request(state, operation_id, body) {
+        Ok(errors) => {
+            let errors: Vec<Value> = errors
+                .into_iter()
+                .map(|e| json!({ "path": e.path, "rule": e.rule, "message": e.message }))
+                .collect();
+            match CString::new(Value::Array(errors).to_string()) {
+                Ok(json) => {
+                    *out_errors = json.into_raw();
+                    ArchimedesError::Ok
+                }
+                Err(e) => {
+                    crate::set_last_error(FfiError::Internal(e.to_string()));
+                    ArchimedesError::Internal
+                }
+            }
+        }
+        Err(err) => {
+            let code = ArchimedesError::from(&err);
+            crate::set_last_error(err);
+            code
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::app::{archimedes_free, archimedes_load_contract, archimedes_new};
+    use crate::config::ArchimedesConfig;
+    use crate::test_client::archimedes_string_free;
+
+    const CONTRACT: &str = r##"{
+        "operations": [
+            {"id": "createUser", "method": "POST", "path": "/users",
+             "request_schema": {"$ref": "#/schemas/CreateUserRequest"}},
+            {"id": "listUsers", "method": "GET", "path": "/users", "request_schema": null}
+        ],
+        "schemas": {
+            "CreateUserRequest": {
+                "type": "object",
+                "required": ["name", "email"],
+                "properties": {
+                    "name": {"type": "string", "minLength": 1, "maxLength": 10},
+                    "email": {"type": "string", "format": "email"},
+                    "age": {"type": "integer", "minimum": 0},
+                    "role": {"type": "string", "enum": ["admin", "member"]},
+                    "code": {"type": "string", "pattern": "^[A-Z]{3}$"},
+                    "address": {"$ref": "#/schemas/Address"},
+                    "tags": {"type": "array", "items": {"type": "string"}}
+                }
+            },
+            "Address": {
+                "type": "object",
+                "required": ["city"],
+                "properties": {"city": {"type": "string"}},
+                "additionalProperties": false
+            }
+        }
+    }"##;
+
+    fn rules(body: &str) -> Vec<(String, String)> {
+        let contract: Value = serde_json::from_str(CONTRACT).unwrap();
+        let body: Value = serde_json::from_str(body).unwrap();
+        ContractValidator::new(&contract)
+            .validate("createUser", &body)
+            .unwrap()
+            .into_iter()
+            .map(|e| (e.path, e.rule))
+            .collect()
+    }
+
+    fn pair(path: &str, rule: &str) -> (String, String) {
+        (path.to_string(), rule.to_string())
+    }
+
+    #[test]
+    fn test_validator_accepts_valid_body() {
+        let body = r#"{"name": "Ada", "email": "ada@example.com", "age": 36,
+            "role": "admin", "code": "ABC", "address": {"city": "Oslo"}, "tags": ["x"]}"#;
+        assert!(rules(body).is_empty());
+    }
+
+    #[test]
+    fn test_validator_reports_every_field() {
+        let body = r#"{"name": "", "email": "not-an-email", "age": 1.5, "role": "guest",
+            "code": "abc", "address": {"zip": "0150"}, "tags": ["a", 2]}"#;
+        assert_eq!(
+            rules(body),
+            vec![
+                pair("address.city", "required"),
+                pair("address.zip", "additionalProperties"),
+                pair("age", "type"),
+                pair("code", "pattern"),
+                pair("email", "format"),
+                pair("name", "minLength"),
+                pair("role", "enum"),
+                pair("tags[1]", "type"),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_validator_body_type_and_required() {
+        assert_eq!(rules("[1, 2]"), vec![pair("", "type")]);
+        assert_eq!(
+            rules(r#"{"age": 3}"#),
+            vec![pair("name", "required"), pair("email", "required")]
+        );
+    }
+
+    #[test]
+    fn test_validator_messages() {
+        let contract: Value = serde_json::from_str(CONTRACT).unwrap();
+        let body = json!({"name": "Ada Lovelace Byron", "email": "ada@example.com"});
+        let errors = ContractValidator::new(&contract)
+            .validate("createUser", &body)
+            .unwrap();
+        assert_eq!(errors[0].message, "name must be at most 10 characters");
+    }
+
+    fn validate(operation_id: &str, body: &str) -> Result<Value, ArchimedesError> {
+        let config = ArchimedesConfig::default();
+        let app = unsafe { archimedes_new(&config) };
+        assert!(!app.is_null());
+        let contract = CString::new(CONTRACT).unwrap();
+        unsafe { archimedes_load_contract(app, contract.as_ptr()) };
+
+        let operation_id = CString::new(operation_id).unwrap();
+        let mut out = ptr::null_mut();
+        let err = unsafe {
+            archimedes_validate_request(
+                app,
+                operation_id.as_ptr(),
+                body.as_ptr(),
+                body.len(),
+                &mut out,
+            )
+        };
+        unsafe { archimedes_free(app) };
+        if err != ArchimedesError::Ok {
+            assert!(out.is_null());
+            return Err(err);
+        }
+
+        let json = unsafe { CStr::from_ptr(out) }.to_str().unwrap().to_string();
+        unsafe { archimedes_string_free(out) };
+        Ok(serde_json::from_str(&json).unwrap())
+    }
+
+    #[test]
+    fn test_validate_request_reports_fields() {
+        let errors = validate("createUser", r#"{"name": "Ada"}"#).unwrap();
+        assert_eq!(
+            errors,
+            json!([{"path": "email", "rule": "required", "message": "email is required"}])
+        );
+    }
+
+    #[test]
+    fn test_validate_request_without_schema() {
+        assert_eq!(validate("listUsers", "{}"), Ok(json!([])));
+    }
+
+    #[test]
+    fn test_validate_request_errors() {
+        assert_eq!(
+            validate("deleteUser", "{}"),
+            Err(ArchimedesError::InvalidOperation)
+        );
+        assert_eq!(
+            validate("createUser", "{"),
+            Err(ArchimedesError::ValidationError)
+        );
+    }
+}
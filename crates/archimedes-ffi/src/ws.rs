@@ -0,0 +1,515 @@
+//! WebSocket FFI for C/C++ bindings.
+//!
+//! Lets a handler take over its request's connection as a WebSocket. The
+//! handler validates the upgrade headers, computes the `Sec-WebSocket-Accept`
+//! key and calls `archimedes_ws_upgrade`, which sends the `101 Switching
+//! Protocols` response and returns a connection handle. Messages are then
+//! exchanged with `archimedes_ws_read` and `archimedes_ws_write` until
+//! `archimedes_ws_close`. To close a connection while another thread is
+//! blocked reading it, call `archimedes_ws_shutdown` first: the read returns
+//! a close message, after which the handle can be freed.
+//!
+//! The dispatcher registers each request that asks for a WebSocket upgrade
+//! with `register_upgrade`, keyed by request ID. Control messages are not
+//! answered automatically: pings, pongs and close messages reach the
+//! handler like any other message.
+//!
+//! ## Example (C)
+//!
+//! ```c
+//! archimedes_websocket* ws = archimedes_ws_upgrade(ctx->request_id, accept_key);
+//! if (ws == NULL) {
+//!     fprintf(stderr, "upgrade failed: %s\n", archimedes_last_error());
+//! }
+//!
+//! uint8_t* data;
+//! size_t len;
+//! int32_t msg_type;
+//! while (archimedes_ws_read(ws, &data, &len, &msg_type) == ARCHIMEDES_ERROR_OK
+//!        && msg_type != ARCHIMEDES_WS_CLOSE) {
+//!     archimedes_ws_write(ws, msg_type, data, len);
+//!     archimedes_ws_free_message(data, len);
+//! }
+//! archimedes_ws_close(ws);
+//! ```
+
+use std::collections::HashMap;
+use std::ffi::c_char;
+use std::ptr;
+use std::sync::atomic::{AtomicBool, Ordering};
+use std::sync::mpsc::{self, Receiver, RecvTimeoutError, Sender};
+use std::sync::OnceLock;
+use std::time::Duration;
+
+use parking_lot::Mutex;
+
+use crate::types::ArchimedesError;
+use crate::{c_str_to_str, set_last_error};
+
+/// Text message type (RFC 6455 opcode 0x1)
+pub const ARCHIMEDES_WS_TEXT: i32 = 1;
+/// Binary message type (RFC 6455 opcode 0x2)
+pub const ARCHIMEDES_WS_BINARY: i32 = 2;
+/// Close message type (RFC 6455 opcode 0x8)
+pub const ARCHIMEDES_WS_CLOSE: i32 = 8;
+/// Ping message type (RFC 6455 opcode 0x9)
+pub const ARCHIMEDES_WS_PING: i32 = 9;
+/// Pong message type (RFC 6455 opcode 0xA)
+pub const ARCHIMEDES_WS_PONG: i32 = 10;
+
+/// How often a blocked read checks whether the connection was shut down
+const SHUTDOWN_POLL_INTERVAL: Duration = Duration::from_millis(50);
+
+/// Opaque WebSocket connection handle for FFI
+#[repr(C)]
+pub struct ArchimedesWebSocket {
+    _opaque: [u8; 0],
+}
+
+/// A message exchanged between a handler and the transport
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub(crate) struct WsFrame {
+    /// Message type (one of the `ARCHIMEDES_WS_*` constants)
+    pub msg_type: i32,
+    /// Message payload
+    pub data: Vec<u8>,
+}
+
+/// Handler side of a connection awaiting upgrade
+struct PendingUpgrade {
+    handshake: Sender<String>,
+    incoming: Receiver<WsFrame>,
+    outgoing: Sender<WsFrame>,
+}
+
+/// Dispatcher side of a connection that may be upgraded
+pub(crate) struct WsPeer {
+    /// Receives the `Sec-WebSocket-Accept` key once the handler upgrades
+    pub handshake: Receiver<String>,
+    /// Delivers client messages to the handler
+    pub to_handler: Sender<WsFrame>,
+    /// Receives handler messages for the client
+    pub from_handler: Receiver<WsFrame>,
+}
+
+/// Internal connection state behind `ArchimedesWebSocket`
+///
+/// One thread may read while another writes, and `shutdown` may overlap
+/// both; none may overlap `close`.
+struct WebSocketState {
+    incoming: Receiver<WsFrame>,
+    outgoing: Sender<WsFrame>,
+    closed: AtomicBool,
+}
+
+/// Connections that may be upgraded, keyed by request ID
+fn pending() -> &'static Mutex<HashMap<String, PendingUpgrade>> {
+    static PENDING: OnceLock<Mutex<HashMap<String, PendingUpgrade>>> = OnceLock::new();
+    PENDING.get_or_init(|| Mutex::new(HashMap::new()))
+}
+
+/// Make a request's connection available for upgrade
+///
+/// Called by the dispatcher before invoking the handler of a request that
+/// carries WebSocket upgrade headers. The returned peer is used to complete
+/// the handshake and relay messages.
+pub(crate) fn register_upgrade(request_id: &str) -> WsPeer {
+    let (handshake_tx, handshake_rx) = mpsc::channel();
+    let (to_handler, incoming) = mpsc::channel();
+    let (outgoing, from_handler) = mpsc::channel();
+    pending().lock().insert(
+        request_id.to_string(),
+        PendingUpgrade {
+            handshake: handshake_tx,
+            incoming,
+            outgoing,
+        },
+    );
+    WsPeer {
+        handshake: handshake_rx,
+        to_handler,
+        from_handler,
+    }
+}
+
+/// Withdraw a connection that the handler did not upgrade
+pub(crate) fn cancel_upgrade(request_id: &str) {
+    pending().lock().remove(request_id);
+}
+
+/// Whether a request's headers ask for a WebSocket upgrade
+pub(crate) fn is_upgrade_request(headers: &[(String, String)]) -> bool {
+    headers.iter().any(|(name, value)| {
+        name.eq_ignore_ascii_case("upgrade")
+            && value
+                .split(',')
+                .any(|token| token.trim().eq_ignore_ascii_case("websocket"))
+    })
+}
+
+/// Upgrade a request's connection to a WebSocket
+///
+/// Sends the `101 Switching Protocols` response with the given
+/// `Sec-WebSocket-Accept` key. Returns null and sets the last error if the
+/// request's connection cannot be upgraded.
+///
+/// # Safety
+///
+/// - `request_id` and `accept_key` must be valid null-terminated strings
+/// - The returned handle must be freed with `archimedes_ws_close`
+#[no_mangle]
+pub unsafe extern "C" fn archimedes_ws_upgrade(
+    request_id: *const c_char,
+    accept_key: *const c_char,
+) -> *mut ArchimedesWebSocket {
+    let (Some(request_id), Some(accept_key)) = (c_str_to_str(request_id), c_str_to_str(accept_key))
+    else {
+        set_last_error("request_id and accept_key are required");
+        return ptr::null_mut();
+    };
+
+    let Some(upgrade) = pending().lock().remove(request_id) else {
+        set_last_error(format!("request {request_id} cannot be upgraded"));
+        return ptr::null_mut();
+    };
+    if upgrade.handshake.send(accept_key.to_string()).is_err() {
+        set_last_error("connection closed before upgrade");
+        return ptr::null_mut();
+    }
+
+    let state = Box::new(WebSocketState {
+        incoming: upgrade.incoming,
+        outgoing: upgrade.outgoing,
+        closed: AtomicBool::new(false),
+    });
+    Box::into_raw(state).cast()
+}
+
+/// Read the next message, blocking until one arrives
+///
+/// On success `*data` and `*len` hold the payload, which must be freed with
+/// `archimedes_ws_free_message`, and `*msg_type` its type. Once the client
+/// has closed the connection, or `archimedes_ws_shutdown` has been called, a
+/// message of type `ARCHIMEDES_WS_CLOSE` with an empty payload is returned.
+///
+/// # Safety
+///
+/// - `ws` must be a handle returned by `archimedes_ws_upgrade`
+/// - `data`, `len` and `msg_type` must be valid pointers
+#[no_mangle]
+pub unsafe extern "C" fn archimedes_ws_read(
+    ws: *mut ArchimedesWebSocket,
+    data: *mut *mut u8,
+    len: *mut usize,
+    msg_type: *mut i32,
+) -> ArchimedesError {
+    if ws.is_null() || data.is_null() || len.is_null() || msg_type.is_null() {
+        return ArchimedesError::NullPointer;
+    }
+    let state = &*ws.cast::<WebSocketState>();
+
+    let frame = loop {
+        if state.closed.load(Ordering::Acquire) {
+            break None;
+        }
+        match state.incoming.recv_timeout(SHUTDOWN_POLL_INTERVAL) {
+            Ok(frame) => break Some(frame),
+            Err(RecvTimeoutError::Timeout) => continue,
+            Err(RecvTimeoutError::Disconnected) => break None,
+        }
+    };
+    let frame = frame.unwrap_or(WsFrame {
+        msg_type: ARCHIMEDES_WS_CLOSE,
+        data: Vec::new(),
+    });
+    if frame.msg_type == ARCHIMEDES_WS_CLOSE {
+        state.closed.store(true, Ordering::Release);
+    }
+
+    let payload = frame.data.into_boxed_slice();
+    *len = payload.len();
+    *data = if payload.is_empty() {
+        ptr::null_mut()
+    } else {
+        Box::into_raw(payload).cast()
+    };
+    *msg_type = frame.msg_type;
+    ArchimedesError::Ok
+}
+
+/// Send a message
+///
+/// Returns `InvalidOperation` if the connection is closed or `msg_type` is
+/// not a known message type.
+///
+/// # Safety
+///
+/// - `ws` must be a handle returned by `archimedes_ws_upgrade`
+/// - `data` must point to `len` readable bytes (or be null if `len` is 0)
+#[no_mangle]
+pub unsafe extern "C" fn archimedes_ws_write(
+    ws: *mut ArchimedesWebSocket,
+    msg_type: i32,
+    data: *const u8,
+    len: usize,
+) -> ArchimedesError {
+    if ws.is_null() || (data.is_null() && len > 0) {
+        return ArchimedesError::NullPointer;
+    }
+    if !matches!(
+        msg_type,
+        ARCHIMEDES_WS_TEXT
+            | ARCHIMEDES_WS_BINARY
+            | ARCHIMEDES_WS_CLOSE
+            | ARCHIMEDES_WS_PING
+            | ARCHIMEDES_WS_PONG
+    ) {
+        set_last_error(format!("unknown WebSocket message type {msg_type}"));
+        return ArchimedesError::InvalidOperation;
+    }
+    let state = &*ws.cast::<WebSocketState>();
+
+    let payload = if len == 0 {
+        Vec::new()
+    } else {
+        std::slice::from_raw_parts(data, len).to_vec()
+    };
+    let frame = WsFrame {
+        msg_type,
+        data: payload,
+    };
+    if state.outgoing.send(frame).is_err() {
+        state.closed.store(true, Ordering::Release);
+        set_last_error("WebSocket connection closed");
+        return ArchimedesError::InvalidOperation;
+    }
+    ArchimedesError::Ok
+}
+
+/// Close the connection without freeing the handle
+///
+/// Sends a close message unless the connection is already closed. A read
+/// blocked in another thread returns a close message shortly after. The
+/// handle must still be freed with `archimedes_ws_close`.
+///
+/// # Safety
+///
+/// `ws` must be a handle returned by `archimedes_ws_upgrade`, or null.
+#[no_mangle]
+pub unsafe extern "C" fn archimedes_ws_shutdown(ws: *mut ArchimedesWebSocket) {
+    if ws.is_null() {
+        return;
+    }
+    shutdown(&*ws.cast::<WebSocketState>());
+}
+
+/// Close the connection and free the handle
+///
+/// Sends a close message unless the connection is already closed.
+///
+/// # Safety
+///
+/// `ws` must be a handle returned by `archimedes_ws_upgrade`, or null.
+/// It must not be used after this call.
+#[no_mangle]
+pub unsafe extern "C" fn archimedes_ws_close(ws: *mut ArchimedesWebSocket) {
+    if ws.is_null() {
+        return;
+    }
+    let state = Box::from_raw(ws.cast::<WebSocketState>());
+    shutdown(&state);
+}
+
+/// Mark the connection closed, sending a close message the first time
+fn shutdown(state: &WebSocketState) {
+    if !state.closed.swap(true, Ordering::AcqRel) {
+        let _ = state.outgoing.send(WsFrame {
+            msg_type: ARCHIMEDES_WS_CLOSE,
+            data: Vec::new(),
+        });
+    }
+}
+
+/// Free a message payload returned by `archimedes_ws_read`
+///
+/// # Safety
+///
+/// `data` and `len` must come from a single `archimedes_ws_read` call.
+#[no_mangle]
+pub unsafe extern "C" fn archimedes_ws_free_message(data: *mut u8, len: usize) {
+    if !data.is_null() {
+        drop(Box::from_raw(ptr::slice_from_raw_parts_mut(data, len)));
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::ffi::CString;
+
+    unsafe fn read(ws: *mut ArchimedesWebSocket) -> WsFrame {
+        let mut data = ptr::null_mut();
+        let mut len = 0;
+        let mut msg_type = 0;
+        assert_eq!(
+            archimedes_ws_read(ws, &mut data, &mut len, &mut msg_type),
+            ArchimedesError::Ok
+        );
+        let payload = if data.is_null() {
+            Vec::new()
+        } else {
+            std::slice::from_raw_parts(data, len).to_vec()
+        };
+        archimedes_ws_free_message(data, len);
+        WsFrame {
+            msg_type,
+            data: payload,
+        }
+    }
+
+    #[test]
+    fn test_upgrade_and_exchange_messages() {
+        let peer = register_upgrade("req-ws-1");
+        let request_id = CString::new("req-ws-1").unwrap();
+        let accept = CString::new("s3pPLMBiTxaQ9kYGzzhZRbK+xOo=").unwrap();
+
+        unsafe {
+            let ws = archimedes_ws_upgrade(request_id.as_ptr(), accept.as_ptr());
+            assert!(!ws.is_null());
+            assert_eq!(
+                peer.handshake.recv().unwrap(),
+                "s3pPLMBiTxaQ9kYGzzhZRbK+xOo="
+            );
+
+            peer.to_handler
+                .send(WsFrame {
+                    msg_type: ARCHIMEDES_WS_TEXT,
+                    data: b"hello".to_vec(),
+                })
+                .unwrap();
+            let frame = read(ws);
+            assert_eq!(frame.msg_type, ARCHIMEDES_WS_TEXT);
+            assert_eq!(frame.data, b"hello");
+
+            let reply = b"world";
+            assert_eq!(
+                archimedes_ws_write(ws, ARCHIMEDES_WS_BINARY, reply.as_ptr(), reply.len()),
+                ArchimedesError::Ok
+            );
+            let sent = peer.from_handler.recv().unwrap();
+            assert_eq!(sent.msg_type, ARCHIMEDES_WS_BINARY);
+            assert_eq!(sent.data, b"world");
+
+            archimedes_ws_close(ws);
+            let close = peer.from_handler.recv().unwrap();
+            assert_eq!(close.msg_type, ARCHIMEDES_WS_CLOSE);
+        }
+    }
+
+    #[test]
+    fn test_read_after_client_disconnect() {
+        let peer = register_upgrade("req-ws-2");
+        let request_id = CString::new("req-ws-2").unwrap();
+        let accept = CString::new("key").unwrap();
+
+        unsafe {
+            let ws = archimedes_ws_upgrade(request_id.as_ptr(), accept.as_ptr());
+            assert!(!ws.is_null());
+            drop(peer);
+
+            assert_eq!(read(ws).msg_type, ARCHIMEDES_WS_CLOSE);
+            assert_eq!(read(ws).msg_type, ARCHIMEDES_WS_CLOSE);
+            archimedes_ws_close(ws);
+        }
+    }
+
+    #[test]
+    fn test_shutdown_interrupts_read() {
+        let peer = register_upgrade("req-ws-5");
+        let request_id = CString::new("req-ws-5").unwrap();
+        let accept = CString::new("key").unwrap();
+
+        unsafe {
+            let ws = archimedes_ws_upgrade(request_id.as_ptr(), accept.as_ptr());
+            assert!(!ws.is_null());
+
+            // The client stays connected but sends nothing
+            let handle = ws as usize;
+            let reader = std::thread::spawn(move || read(handle as *mut ArchimedesWebSocket));
+            archimedes_ws_shutdown(ws);
+            assert_eq!(reader.join().unwrap().msg_type, ARCHIMEDES_WS_CLOSE);
+
+            archimedes_ws_close(ws);
+            let sent: Vec<_> = peer.from_handler.try_iter().collect();
+            assert_eq!(sent.len(), 1);
+            assert_eq!(sent[0].msg_type, ARCHIMEDES_WS_CLOSE);
+        }
+    }
+
+    #[test]
+    fn test_upgrade_unknown_request() {
+        let request_id = CString::new("req-ws-missing").unwrap();
+        let accept = CString::new("key").unwrap();
+        unsafe {
+            assert!(archimedes_ws_upgrade(request_id.as_ptr(), accept.as_ptr()).is_null());
+        }
+    }
+
+    #[test]
+    fn test_cancel_upgrade() {
+        let _peer = register_upgrade("req-ws-3");
+        cancel_upgrade("req-ws-3");
+        let request_id = CString::new("req-ws-3").unwrap();
+        let accept = CString::new("key").unwrap();
+        unsafe {
+            assert!(archimedes_ws_upgrade(request_id.as_ptr(), accept.as_ptr()).is_null());
+        }
+    }
+
+    #[test]
+    fn test_write_rejects_unknown_type() {
+        let _peer = register_upgrade("req-ws-4");
+        let request_id = CString::new("req-ws-4").unwrap();
+        let accept = CString::new("key").unwrap();
+        unsafe {
+            let ws = archimedes_ws_upgrade(request_id.as_ptr(), accept.as_ptr());
+            assert_eq!(
+                archimedes_ws_write(ws, 3, ptr::null(), 0),
+                ArchimedesError::InvalidOperation
+            );
+            archimedes_ws_close(ws);
+        }
+    }
+
+    #[test]
+    fn test_is_upgrade_request() {
+        let header = |name: &str, value: &str| vec![(name.to_string(), value.to_string())];
+        assert!(is_upgrade_request(&header("Upgrade", "websocket")));
+        assert!(is_upgrade_request(&header("upgrade", "h2c, WebSocket")));
+        assert!(!is_upgrade_request(&header("Upgrade", "h2c")));
+        assert!(!is_upgrade_request(&[]));
+    }
+
+    #[test]
+    fn test_null_safety() {
+        unsafe {
+            assert!(archimedes_ws_upgrade(ptr::null(), ptr::null()).is_null());
+            assert_eq!(
+                archimedes_ws_read(
+                    ptr::null_mut(),
+                    ptr::null_mut(),
+                    ptr::null_mut(),
+                    ptr::null_mut()
+                ),
+                ArchimedesError::NullPointer
+            );
+            assert_eq!(
+                archimedes_ws_write(ptr::null_mut(), ARCHIMEDES_WS_TEXT, ptr::null(), 0),
+                ArchimedesError::NullPointer
+            );
+            archimedes_ws_shutdown(ptr::null_mut());
+            archimedes_ws_close(ptr::null_mut());
+            archimedes_ws_free_message(ptr::null_mut(), 0);
+        }
+    }
+}
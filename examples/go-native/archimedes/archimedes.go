@@ -55,13 +55,56 @@ extern struct archimedes_response_data go_handler_callback(
 */
 import "C"
 import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/xml"
 	"errors"
 	"fmt"
+	"hash/fnv"
+	"html/template"
+	"io"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"math"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/textproto"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"regexp"
 	"runtime"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+	"unicode/utf8"
 	"unsafe"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+	"github.com/vmihailenco/msgpack/v5"
+	"gopkg.in/yaml.v3"
 )
 
 // =============================================================================
@@ -101,9 +144,15 @@ func (e *Error) Error() string {
 
 // Config holds Archimedes application configuration
 type Config struct {
-	// Contract is the path to the Themis contract JSON file (required)
+	// Contract is the path to the Themis contract JSON file. Exactly one of
+	// Contract and ContractBytes must be set.
 	Contract string
 
+	// ContractBytes is the Themis contract JSON itself, for environments
+	// without convenient filesystem access. Used instead of Contract when
+	// non-nil.
+	ContractBytes []byte
+
 	// PolicyBundle is the path to OPA policy bundle (optional)
 	PolicyBundle string
 
@@ -113,9 +162,26 @@ type Config struct {
 	// Port is the port to listen on (default: 8080)
 	Port uint16
 
+	// UnixSocket is a Unix domain socket path to listen on instead of TCP,
+	// for same-host callers such as a local proxy. When set, ListenAddr,
+	// Port and the address passed to Run are ignored, and setting Port to
+	// anything but its default is an ErrInvalidConfig. A stale socket file
+	// left by a previous run is removed before the server starts, and the
+	// socket file is removed when the server stops.
+	UnixSocket string
+
+	// UnixSocketMode is the permission bits of the socket file
+	// (default: 0600)
+	UnixSocketMode os.FileMode
+
 	// MetricsPort is the port for Prometheus metrics (default: 9090, 0 to disable)
 	MetricsPort uint16
 
+	// DisableBindMetrics stops Bind, BindValidate and BindValidateAll from
+	// counting failures in request_bind_errors_total (see
+	// App.SetMetricsRegistry)
+	DisableBindMetrics bool
+
 	// EnableValidation enables request validation (default: true)
 	EnableValidation bool
 
@@ -142,6 +208,77 @@ type Config struct {
 
 	// RequestTimeout is request timeout in seconds (default: 30, 0 for no timeout)
 	RequestTimeout uint32
+
+	// TrustedProxies are the IP addresses or CIDR ranges ("10.0.0.0/8") of
+	// reverse proxies whose X-Forwarded-For and X-Real-IP headers
+	// Context.ClientIP trusts. Forwarded headers from any other peer are
+	// ignored, since clients can set them freely. A malformed entry is an
+	// ErrInvalidConfig.
+	TrustedProxies []string
+
+	// TLSCertFile and TLSKeyFile are paths to the PEM certificate chain and
+	// private key. When set, the server only accepts TLS connections, which
+	// is enough to serve HTTPS in local development without a terminating
+	// proxy. Both must be set together, or New fails with ErrInvalidConfig.
+	// When neither these nor TLSCert and TLSKey are set (the default), the
+	// server speaks plain HTTP.
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// TLSCert and TLSKey are the PEM certificate chain and private key
+	// themselves, used instead of TLSCertFile and TLSKeyFile
+	TLSCert []byte
+	TLSKey  []byte
+
+	// TLSCACertFile is the path to a PEM CA bundle. When set, clients must
+	// present a certificate signed by it (mTLS).
+	TLSCACertFile string
+
+	// TLSMinVersion is the minimum TLS version, "1.2" or "1.3"
+	// (default: "1.2")
+	TLSMinVersion string
+
+	// HTTP2Enabled serves HTTP/2: negotiated via ALPN "h2" when TLS is
+	// configured, or as cleartext h2c otherwise (default: false)
+	HTTP2Enabled bool
+
+	// H2CEnabled accepts cleartext HTTP/2 (h2c) even when TLS is
+	// configured, e.g. behind a TLS-terminating proxy (default: false)
+	H2CEnabled bool
+
+	// MaxResponseSize is the largest response body in bytes a handler may
+	// send (default: 0, no limit). Larger buffered responses are replaced
+	// by a 500 and streamed responses are cut off, so a buggy handler
+	// cannot exhaust memory. Setting a limit well above the largest
+	// expected response, such as 64MB, is recommended.
+	MaxResponseSize uint64
+
+	// ResponseBufferLimit is the number of bytes written through Context.Write
+	// before the response switches to streaming (default: 0, no limit).
+	// Once streaming starts the status and headers have been sent, so later
+	// calls to SetHeader or AddCookie no longer affect the response.
+	ResponseBufferLimit int
+
+	// FileRoot is the directory Context.SendFile serves files from
+	// (default: the working directory). SendFile paths are relative to it
+	// and cannot leave it, even through symlinks.
+	FileRoot string
+
+	// EmitEmptyArrays makes the JSON response helpers encode nil slices as
+	// [] and nil maps as {} instead of null, for clients that expect a
+	// collection to always be present (default: false). The response value
+	// is copied with reflection before encoding, which roughly doubles the
+	// cost of JSON responses with deeply nested values.
+	EmitEmptyArrays bool
+
+	// StrictMode runs App.Validate before the server starts and refuses to
+	// start if it reports any issue (default: false)
+	StrictMode bool
+
+	// Logger receives the app's structured logs, such as lifecycle hook
+	// timings, and is the base of each request's Context.Logger
+	// (default: slog.Default())
+	Logger *slog.Logger
 }
 
 // =============================================================================
@@ -179,6 +316,72 @@ func (c *CallerIdentity) IsAnonymous() bool {
 	return c.Type == "anonymous"
 }
 
+// HasRole returns true if the caller has role. Roles are case-sensitive; a
+// nil caller has no roles.
+func (c *CallerIdentity) HasRole(role string) bool {
+	if c == nil {
+		return false
+	}
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// HasAnyRole returns true if the caller has at least one of roles
+func (c *CallerIdentity) HasAnyRole(roles ...string) bool {
+	for _, role := range roles {
+		if c.HasRole(role) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasAllRoles returns true if the caller has every one of roles
+func (c *CallerIdentity) HasAllRoles(roles ...string) bool {
+	for _, role := range roles {
+		if !c.HasRole(role) {
+			return false
+		}
+	}
+	return true
+}
+
+// =============================================================================
+// TLS Connection State
+// =============================================================================
+
+// TLSConnectionState describes the TLS connection a request arrived on
+type TLSConnectionState struct {
+	// Version is the negotiated TLS version (e.g. "TLSv1.3")
+	Version string `json:"version"`
+
+	// NegotiatedProtocol is the ALPN protocol (e.g. "h2"), if any
+	NegotiatedProtocol string `json:"negotiated_protocol,omitempty"`
+
+	// CipherSuite is the negotiated cipher suite name
+	CipherSuite string `json:"cipher_suite"`
+
+	// PeerSubject is the client certificate subject for mTLS connections
+	PeerSubject string `json:"peer_subject,omitempty"`
+}
+
+// parseTLSInfo decodes the TLS info JSON from the FFI request context.
+// Returns nil for plaintext connections or malformed input.
+func parseTLSInfo(tlsJSON string) *TLSConnectionState {
+	if tlsJSON == "" || tlsJSON == "null" {
+		return nil
+	}
+	var state TLSConnectionState
+	if err := json.Unmarshal([]byte(tlsJSON), &state); err != nil {
+		return nil
+	}
+	return &state
+}
+
 // =============================================================================
 // Context
 // =============================================================================
@@ -200,7 +403,7 @@ type Context struct {
 	// Method is the HTTP method
 	Method string
 
-	// Path is the request path
+	// Path is the percent-decoded request path
 	Path string
 
 	// Query is the query string (without leading ?)
@@ -209,20 +412,232 @@ type Context struct {
 	// PathParams contains path parameters
 	PathParams map[string]string
 
-	// Headers contains request headers
+	// Headers contains request headers, one value per name. For a header
+	// sent more than once, see HeaderValues.
 	Headers map[string]string
 
 	// Caller is the authenticated caller identity (may be nil for anonymous)
 	Caller *CallerIdentity
 
+	// RemoteAddr is the network address of the peer, as "ip:port" (empty
+	// when unknown). Behind a reverse proxy this is the proxy; see ClientIP.
+	RemoteAddr string
+
+	// ReceivedAt is when the request reached the Go side, before any
+	// handler or middleware ran
+	ReceivedAt time.Time
+
+	// tlsInfo is the TLS connection state (nil for plaintext connections)
+	tlsInfo *TLSConnectionState
+
+	// rawPath and rawQuery are the request target as received (empty when
+	// unknown)
+	rawPath  string
+	rawQuery string
+
+	// headersMulti holds every value of each request header, by lowercase
+	// name, in the order received
+	headersMulti map[string][]string
+
+	// app is the application that dispatched the request (nil in unit tests)
+	app *App
+
+	// invokeDepth is the number of Invoke calls leading to this context
+	invokeDepth int
+
 	// body is the raw request body
 	body []byte
 
+	// continueSent records that 100 Continue was sent for a request with
+	// Expect: 100-continue; continueSink sends it (nil when the transport
+	// cannot)
+	continueSent bool
+	continueSink func() error
+
 	// response fields
 	responseStatus  int
 	responseBody    []byte
 	responseHeaders map[string]string
+	cookieHeaders   []string
 	contentType     string
+
+	// chunkSink receives streamed response chunks. When nil, chunks are
+	// collected into responseBody.
+	chunkSink func(chunk []byte) error
+	streaming bool
+	stream    *StreamWriter
+
+	// sentBytes is the number of body bytes streamed so far
+	sentBytes uint64
+
+	// logger is the request-scoped logger, built on first use
+	logger *slog.Logger
+
+	// stdCtx carries the request deadline (nil means context.Background)
+	stdCtx context.Context
+}
+
+// Logger returns a structured logger tagged with the request's request_id,
+// trace_id, span_id and operation_id, so handler logs correlate without
+// formatting the IDs by hand. It is built on Config.Logger, or on
+// slog.Default when the context has no app.
+func (c *Context) Logger() *slog.Logger {
+	if c.logger == nil {
+		base := slog.Default()
+		if c.app != nil && c.app.config.Logger != nil {
+			base = c.app.config.Logger
+		}
+		c.logger = base.With(
+			slog.String("request_id", c.RequestID),
+			slog.String("trace_id", c.TraceID),
+			slog.String("span_id", c.SpanID),
+			slog.String("operation_id", c.OperationID),
+		)
+	}
+	return c.logger
+}
+
+// Elapsed returns the time since the request was received, for
+// Server-Timing headers and slow-request detection. It is zero when
+// ReceivedAt is unset.
+func (c *Context) Elapsed() time.Duration {
+	if c.ReceivedAt.IsZero() {
+		return 0
+	}
+	return time.Since(c.ReceivedAt)
+}
+
+// Context returns the context.Context for the request, for passing to
+// database calls and outgoing requests. Its deadline is the operation's
+// timeout (see ConfigureOperation) counted from ReceivedAt, and it is
+// canceled when the handler returns or App.ShutdownNow aborts the request.
+func (c *Context) Context() context.Context {
+	if c.stdCtx == nil {
+		return context.Background()
+	}
+	return c.stdCtx
+}
+
+// RequireAuth returns an ErrAuthorizationError, which handlers return as a
+// 403 response, when the caller is missing or anonymous. It is a Go-side
+// convenience for handlers and runs independently of the OPA authorization
+// middleware configured with Config.PolicyBundle.
+func (c *Context) RequireAuth() error {
+	if c.Caller == nil || c.Caller.IsAnonymous() {
+		return &Error{Code: ErrAuthorizationError, Message: "authentication required"}
+	}
+	return nil
+}
+
+// MustCaller returns the authenticated caller. It is meant to be called
+// after RequireAuth has succeeded and panics if there is no caller.
+func (c *Context) MustCaller() *CallerIdentity {
+	if c.Caller == nil {
+		panic("archimedes: MustCaller called without a caller; call RequireAuth first")
+	}
+	return c.Caller
+}
+
+// RequireRole returns an ErrAuthorizationError, which handlers return as a
+// 403 response, unless the caller has role
+//
+//	if err := ctx.RequireRole("admin"); err != nil {
+//	    return err
+//	}
+func (c *Context) RequireRole(role string) error {
+	if c.Caller.HasRole(role) {
+		return nil
+	}
+	return &Error{Code: ErrAuthorizationError, Message: fmt.Sprintf("caller lacks required role %q", role)}
+}
+
+// TLSInfo returns the TLS connection state, or nil for plaintext requests
+func (c *Context) TLSInfo() *TLSConnectionState {
+	return c.tlsInfo
+}
+
+// RawPath returns the request path exactly as the client sent it.
+//
+// Path is percent-decoded, so "/files/a%2Fb.txt" arrives as Path
+// "/files/a/b.txt". RawPath preserves the encoded form, which matters for
+// signature verification and proxying. It equals Path when the path has no
+// percent-encoding.
+func (c *Context) RawPath() string {
+	if c.rawPath != "" {
+		return c.rawPath
+	}
+	return c.Path
+}
+
+// ClientIP returns the IP address of the client that made the request.
+//
+// When the peer (RemoteAddr) is one of Config.TrustedProxies, the
+// forwarded headers are used instead: the left-most X-Forwarded-For entry,
+// which is the original client, else X-Real-IP. Otherwise, or when
+// neither header is set, it is the host part of RemoteAddr. It is empty
+// when the address is unknown.
+func (c *Context) ClientIP() string {
+	peer := c.RemoteAddr
+	if host, _, err := net.SplitHostPort(peer); err == nil {
+		peer = host
+	}
+	if c.app == nil || !c.app.isTrustedProxy(peer) {
+		return peer
+	}
+	if forwarded := c.requestHeader("X-Forwarded-For"); forwarded != "" {
+		first, _, _ := strings.Cut(forwarded, ",")
+		if first = strings.TrimSpace(first); first != "" {
+			return first
+		}
+	}
+	if realIP := strings.TrimSpace(c.requestHeader("X-Real-IP")); realIP != "" {
+		return realIP
+	}
+	return peer
+}
+
+// isTrustedProxy reports whether ip is in Config.TrustedProxies
+func (a *App) isTrustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range a.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTrustedProxies parses Config.TrustedProxies into address ranges; a
+// bare address is a single-address range
+func parseTrustedProxies(proxies []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+	for _, proxy := range proxies {
+		if prefix, err := netip.ParsePrefix(proxy); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(proxy)
+		if err != nil {
+			return nil, &Error{Code: ErrInvalidConfig, Message: fmt.Sprintf("invalid trusted proxy %q", proxy)}
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// RawQuery returns the query string (without leading ?) exactly as the client
+// sent it. Query is not decoded either, so the two are equal; decode the
+// parameters with BindQuery or url.ParseQuery.
+func (c *Context) RawQuery() string {
+	if c.rawQuery != "" {
+		return c.rawQuery
+	}
+	return c.Query
 }
 
 // Body returns the raw request body
@@ -235,11 +650,88 @@ func (c *Context) BodyString() string {
 	return string(c.body)
 }
 
-// Bind unmarshals the JSON body into the given struct
+// ShouldContinue reports whether the client sent Expect: 100-continue and
+// is still waiting for 100 Continue before sending the body.
+//
+// The framework sends 100 Continue itself when it reads the body, before
+// the handler runs, and answers 417 Expectation Failed instead when the
+// declared Content-Length exceeds the operation's body limit or the
+// expectation is not 100-continue. ShouldContinue is therefore only true
+// for handlers that drive the body themselves, which use SendContinue.
+func (c *Context) ShouldContinue() bool {
+	return !c.continueSent && strings.EqualFold(c.requestHeader("Expect"), "100-continue")
+}
+
+// SendContinue sends the 100 Continue interim response if the client is
+// waiting for it (see ShouldContinue). Later calls do nothing.
+func (c *Context) SendContinue() {
+	if !c.ShouldContinue() {
+		return
+	}
+	c.continueSent = true
+	if c.continueSink != nil {
+		if err := c.continueSink(); err != nil {
+			c.Logger().Warn("sending 100 Continue failed", "error", err)
+		}
+	}
+}
+
+// expectationFailed reports whether a request's Expect header cannot be
+// met: an expectation other than 100-continue, or a declared body larger
+// than maxBodySize (0 for no limit), which would be rejected once sent
+func expectationFailed(expect string, contentLength int64, maxBodySize uint64) bool {
+	if expect == "" {
+		return false
+	}
+	if !strings.EqualFold(expect, "100-continue") {
+		return true
+	}
+	return maxBodySize > 0 && contentLength > 0 && uint64(contentLength) > maxBodySize
+}
+
+// BindText returns the request body as a string, for operations that take a
+// raw text body such as a markdown document. It returns ErrInvalidUTF8 if
+// the body is not valid UTF-8.
+func (c *Context) BindText() (string, error) {
+	if !utf8.Valid(c.body) {
+		return "", c.countBindError(&Error{Code: ErrInvalidUTF8, Message: "request body is not valid UTF-8"})
+	}
+	return string(c.body), nil
+}
+
+// BindTextLossy returns the request body as a string, replacing invalid
+// UTF-8 sequences with the Unicode replacement character
+func (c *Context) BindTextLossy() string {
+	return strings.ToValidUTF8(string(c.body), string(utf8.RuneError))
+}
+
+// Bind decodes the request body into v using the decoder registered for the
+// request's Content-Type (see App.RegisterDecoder). Bodies without a
+// Content-Type, or with a "+json" structured suffix, are decoded as JSON.
+// Any other Content-Type without a decoder fails with an
+// *UnsupportedMediaTypeError, which the app answers with 415 (see
+// App.UnsupportedMediaType) when the handler returns it.
+//
+// Built-in decoders handle JSON, URL-encoded forms (see BindForm), XML and
+// MessagePack. Protobuf bodies require building with the protobuf build tag.
 func (c *Context) Bind(v any) error {
+	return c.countBindError(c.bind(v))
+}
+
+func (c *Context) bind(v any) error {
 	if len(c.body) == 0 {
 		return errors.New("empty request body")
 	}
+	mediaType := parseMediaType(c.requestHeader("Content-Type"))
+	if decode := c.decoder(mediaType); decode != nil {
+		return decode(c.body, v)
+	}
+	if isProtobufContentType(mediaType) {
+		return &Error{Code: ErrInvalidConfig, Message: "protobuf request bodies require building with -tags protobuf"}
+	}
+	if mediaType != "" && !strings.HasSuffix(mediaType, "+json") {
+		return &UnsupportedMediaTypeError{ContentType: mediaType}
+	}
 	return json.Unmarshal(c.body, v)
 }
 
@@ -248,14 +740,69 @@ func (c *Context) PathParam(name string) string {
 	return c.PathParams[name]
 }
 
-// Header returns a request header by name
+// wildcardParam is the path parameter holding a wildcard route's remainder
+const wildcardParam = "*"
+
+// Wildcard returns the part of the path after the prefix of the Wildcard
+// route serving the request, without a leading slash ("" for other
+// requests)
+func (c *Context) Wildcard() string {
+	return c.PathParams[wildcardParam]
+}
+
+// Header returns a request header by name. For a header sent more than
+// once it is the first value.
 func (c *Context) Header(name string) string {
 	return c.Headers[name]
 }
 
+// HeaderValues returns every value of a request header sent more than
+// once, such as repeated X-Forwarded-For or Cookie lines, in the order
+// received. The name is case-insensitive. Each value is one header line
+// as sent; comma-separated lists within a line are not split. Returns nil
+// if the header is absent.
+func (c *Context) HeaderValues(name string) []string {
+	if values, ok := c.headersMulti[strings.ToLower(name)]; ok {
+		return slices.Clone(values)
+	}
+	for key, value := range c.Headers {
+		if strings.EqualFold(key, name) {
+			return []string{value}
+		}
+	}
+	return nil
+}
+
+// addHeader records a request header line, keeping the first value in
+// Headers and every value for HeaderValues
+func (c *Context) addHeader(name, value string) {
+	if _, ok := c.Headers[name]; !ok {
+		c.Headers[name] = value
+	}
+	if c.headersMulti == nil {
+		c.headersMulti = make(map[string][]string)
+	}
+	key := strings.ToLower(name)
+	c.headersMulti[key] = append(c.headersMulti[key], value)
+}
+
+// requestHeader returns a request header by name, falling back to a
+// case-insensitive match
+func (c *Context) requestHeader(name string) string {
+	if value, ok := c.Headers[name]; ok {
+		return value
+	}
+	for key, value := range c.Headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
+
 // JSON sends a JSON response
 func (c *Context) JSON(status int, v any) error {
-	data, err := json.Marshal(v)
+	data, err := c.marshalJSON(v)
 	if err != nil {
 		return err
 	}
@@ -265,6 +812,270 @@ func (c *Context) JSON(status int, v any) error {
 	return nil
 }
 
+// marshalJSON encodes a JSON response body, honoring
+// Config.EmitEmptyArrays
+func (c *Context) marshalJSON(v any) ([]byte, error) {
+	if c.app == nil || !c.app.config.EmitEmptyArrays || v == nil {
+		return json.Marshal(v)
+	}
+	return json.Marshal(emptyCollections(reflect.ValueOf(v), 0).Interface())
+}
+
+// jsonMarshalerType is the reflect type of json.Marshaler
+var jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+// maxEmptyCollectionsDepth bounds emptyCollections on cyclic values, which
+// json.Marshal then reports as an error
+const maxEmptyCollectionsDepth = 1000
+
+// emptyCollections returns a copy of v with nil slices and maps replaced by
+// empty ones, so they encode as [] and {}. Types with their own MarshalJSON
+// and []byte (a base64 string in JSON) are left alone; v is not modified.
+func emptyCollections(v reflect.Value, depth int) reflect.Value {
+	if !v.IsValid() || depth > maxEmptyCollectionsDepth {
+		return v
+	}
+	t := v.Type()
+	if t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType) {
+		return v
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.New(t.Elem())
+		out.Elem().Set(emptyCollections(v.Elem(), depth+1))
+		return out
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.New(t).Elem()
+		out.Set(emptyCollections(v.Elem(), depth+1))
+		return out
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return v
+		}
+		if v.IsNil() {
+			return reflect.MakeSlice(t, 0, 0)
+		}
+		out := reflect.MakeSlice(t, v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(emptyCollections(v.Index(i), depth+1))
+		}
+		return out
+	case reflect.Array:
+		out := reflect.New(t).Elem()
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(emptyCollections(v.Index(i), depth+1))
+		}
+		return out
+	case reflect.Map:
+		if v.IsNil() {
+			return reflect.MakeMap(t)
+		}
+		out := reflect.MakeMapWithSize(t, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			out.SetMapIndex(iter.Key(), emptyCollections(iter.Value(), depth+1))
+		}
+		return out
+	case reflect.Struct:
+		out := reflect.New(t).Elem()
+		out.Set(v)
+		for i := 0; i < t.NumField(); i++ {
+			if out.Field(i).CanSet() {
+				out.Field(i).Set(emptyCollections(v.Field(i), depth+1))
+			}
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// XML sends an XML response, prefixed with the standard XML header
+func (c *Context) XML(status int, v any) error {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	c.responseStatus = status
+	c.responseBody = append([]byte(xml.Header), data...)
+	c.contentType = "application/xml"
+	return nil
+}
+
+// YAML sends a YAML response. Fields are named by their `yaml` struct tags,
+// or the lowercased field name without one.
+func (c *Context) YAML(status int, v any) error {
+	data, err := marshalYAML(v)
+	if err != nil {
+		return err
+	}
+	c.responseStatus = status
+	c.responseBody = data
+	c.contentType = "application/yaml"
+	return nil
+}
+
+// marshalYAML is yaml.Marshal, returning an error instead of panicking on
+// values that cannot be encoded, such as funcs and channels
+func marshalYAML(v any) (data []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("yaml: %v", r)
+		}
+	}()
+	return yaml.Marshal(v)
+}
+
+// Negotiate returns the offered media type that best matches the request's
+// Accept header, taking quality values and wildcards into account, or ""
+// if the client accepts none of them. Without an Accept header the first
+// offer is returned. Ties go to the earlier offer.
+//
+//	switch ctx.Negotiate("application/json", "application/xml") {
+//	case "application/xml":
+//	    return ctx.XML(200, user)
+//	default:
+//	    return ctx.JSON(200, user)
+//	}
+func (c *Context) Negotiate(offers ...string) string {
+	accept := c.requestHeader("Accept")
+	if accept == "" {
+		if len(offers) == 0 {
+			return ""
+		}
+		return offers[0]
+	}
+
+	type acceptRange struct {
+		mediaType string
+		q         float64
+	}
+	var ranges []acceptRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, _ := strings.Cut(part, ";")
+		r := acceptRange{mediaType: strings.ToLower(strings.TrimSpace(mediaType)), q: 1}
+		for _, param := range strings.Split(params, ";") {
+			name, value, _ := strings.Cut(param, "=")
+			if strings.TrimSpace(name) == "q" {
+				if q, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+					r.q = q
+				}
+			}
+		}
+		if r.mediaType != "" {
+			ranges = append(ranges, r)
+		}
+	}
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		offerType := parseMediaType(offer)
+		// The most specific matching range decides the offer's quality
+		q, specificity := 0.0, -1
+		for _, r := range ranges {
+			s := mediaRangeSpecificity(r.mediaType, offerType)
+			if s > specificity {
+				q, specificity = r.q, s
+			}
+		}
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// AcceptsLanguages returns the language tags of the request's
+// Accept-Language header, most preferred first, e.g. ["de-DE", "de", "en"]
+// for "en;q=0.5, de-DE, de;q=0.8". Tags with a zero quality and the "*"
+// wildcard are left out; ties keep the header's order.
+func (c *Context) AcceptsLanguages() []string {
+	type language struct {
+		tag string
+		q   float64
+	}
+	var languages []language
+	for _, part := range strings.Split(c.requestHeader("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		l := language{tag: strings.TrimSpace(tag), q: 1}
+		for _, param := range strings.Split(params, ";") {
+			name, value, _ := strings.Cut(param, "=")
+			if strings.TrimSpace(name) == "q" {
+				if q, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+					l.q = q
+				}
+			}
+		}
+		if l.tag != "" && l.tag != "*" && l.q > 0 {
+			languages = append(languages, l)
+		}
+	}
+	sort.SliceStable(languages, func(i, j int) bool {
+		return languages[i].q > languages[j].q
+	})
+
+	tags := make([]string, len(languages))
+	for i, l := range languages {
+		tags[i] = l.tag
+	}
+	return tags
+}
+
+// mediaRangeSpecificity returns how specifically an Accept media range
+// matches mediaType: 2 for an exact match, 1 for "type/*", 0 for "*/*",
+// and -1 for no match
+func mediaRangeSpecificity(mediaRange, mediaType string) int {
+	switch {
+	case mediaRange == mediaType:
+		return 2
+	case mediaRange == "*/*":
+		return 0
+	case strings.HasSuffix(mediaRange, "/*"):
+		if strings.HasPrefix(mediaType, strings.TrimSuffix(mediaRange, "*")) {
+			return 1
+		}
+	}
+	return -1
+}
+
+// JSONCached sends a JSON response like JSON, but serializes v only the first
+// time it is called with key and reuses the bytes afterwards. Use it for
+// immutable responses returned frequently, such as static health or
+// metadata bodies; v is ignored on cache hits. Each response gets its own
+// copy of the cached bytes, so changing one does not change the cache. Use
+// App.InvalidateCache to drop a stale entry. Without an app the response
+// is not cached.
+func (c *Context) JSONCached(status int, key string, v any) error {
+	if c.app == nil {
+		return c.JSON(status, v)
+	}
+
+	c.app.responseCacheMu.RLock()
+	data, ok := c.app.responseCache[key]
+	c.app.responseCacheMu.RUnlock()
+	if !ok {
+		var err error
+		data, err = c.marshalJSON(v)
+		if err != nil {
+			return err
+		}
+		c.app.responseCacheMu.Lock()
+		if c.app.responseCache == nil {
+			c.app.responseCache = make(map[string][]byte)
+		}
+		c.app.responseCache[key] = data
+		c.app.responseCacheMu.Unlock()
+	}
+	return c.Blob(status, "application/json", bytes.Clone(data))
+}
+
 // String sends a string response
 func (c *Context) String(status int, s string) error {
 	c.responseStatus = status
@@ -288,6 +1099,30 @@ func (c *Context) NoContent() error {
 	return nil
 }
 
+// ErrorResponse is the standard error response body
+type ErrorResponse struct {
+	Code      string       `json:"code"`
+	Message   string       `json:"message"`
+	RequestID string       `json:"request_id,omitempty"`
+	Fields    []FieldError `json:"fields,omitempty"`
+}
+
+// Error sends a JSON ErrorResponse with the request ID filled in.
+//
+//	return ctx.Error(404, "USER_NOT_FOUND", "User not found")
+func (c *Context) Error(status int, code, message string) error {
+	return c.JSON(status, ErrorResponse{
+		Code:      code,
+		Message:   message,
+		RequestID: c.RequestID,
+	})
+}
+
+// Errorf is like Error but formats the message
+func (c *Context) Errorf(status int, code, format string, args ...any) error {
+	return c.Error(status, code, fmt.Sprintf(format, args...))
+}
+
 // SetHeader sets a response header
 func (c *Context) SetHeader(name, value string) {
 	if c.responseHeaders == nil {
@@ -296,686 +1131,4517 @@ func (c *Context) SetHeader(name, value string) {
 	c.responseHeaders[name] = value
 }
 
+// addVary adds name to the Vary response header unless it is already listed
+func (c *Context) addVary(name string) {
+	vary := c.responseHeaders["Vary"]
+	for _, field := range strings.Split(vary, ",") {
+		if strings.EqualFold(strings.TrimSpace(field), name) {
+			return
+		}
+	}
+	if vary != "" {
+		name = vary + ", " + name
+	}
+	c.SetHeader("Vary", name)
+}
+
 // =============================================================================
-// Handler
+// Content-Type Decoders
 // =============================================================================
 
-// Handler is the function signature for operation handlers
-type Handler func(ctx *Context) error
+// Decoder decodes a request body into v
+type Decoder func(data []byte, v any) error
 
-// =============================================================================
-// Application
-// =============================================================================
+// defaultDecoders are the built-in decoders used by Bind, keyed by media type
+var defaultDecoders = map[string]Decoder{
+	"application/json":                  json.Unmarshal,
+	"application/x-www-form-urlencoded": decodeForm,
+	"application/xml":                   xml.Unmarshal,
+	"text/xml":                          xml.Unmarshal,
+	"application/msgpack":               decodeMsgpack,
+	"application/x-msgpack":             decodeMsgpack,
+}
 
-// App represents an Archimedes application instance
-type App struct {
-	handle    *C.struct_archimedes_app
-	config    Config
-	handlers  map[string]Handler
-	lifecycle *Lifecycle
-	mu        sync.RWMutex
+// UnsupportedMediaTypeError is returned by Bind when no decoder handles the
+// request's Content-Type
+type UnsupportedMediaTypeError struct {
+	ContentType string
 }
 
-// Handler registry for callbacks
-var (
-	handlerRegistry   = make(map[uintptr]Handler)
+func (e *UnsupportedMediaTypeError) Error() string {
+	return fmt.Sprintf("unsupported content type: %s", e.ContentType)
+}
+
+// defaultUnsupportedMediaType renders the default 415 response
+func defaultUnsupportedMediaType(ctx *Context) error {
+	return ctx.JSON(415, map[string]string{"code": "UNSUPPORTED_MEDIA_TYPE"})
+}
+
+// UnsupportedMediaType sets the handler that renders the response when a
+// handler fails with an *UnsupportedMediaTypeError, so services can use
+// their standard error envelope. The response status is preset to 415.
+// A nil handler restores the default {"code":"UNSUPPORTED_MEDIA_TYPE"} body.
+func (a *App) UnsupportedMediaType(h Handler) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.unsupportedMediaType = h
+}
+
+// RegisterDecoder registers a decoder used by Context.Bind for requests with
+// the given Content-Type, e.g. "text/csv". It replaces any built-in decoder
+// for that type. Media type parameters such as charset are ignored.
+func (a *App) RegisterDecoder(contentType string, fn func(data []byte, v any) error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.decoders == nil {
+		a.decoders = make(map[string]Decoder)
+	}
+	a.decoders[parseMediaType(contentType)] = fn
+}
+
+// decoder returns the decoder for a media type, preferring decoders
+// registered on the app
+func (c *Context) decoder(mediaType string) Decoder {
+	if c.app != nil {
+		c.app.mu.RLock()
+		decode, ok := c.app.decoders[mediaType]
+		c.app.mu.RUnlock()
+		if ok {
+			return decode
+		}
+	}
+	return defaultDecoders[mediaType]
+}
+
+// parseMediaType returns the lowercased media type of a Content-Type value,
+// without parameters
+func parseMediaType(contentType string) string {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	return strings.ToLower(strings.TrimSpace(mediaType))
+}
+
+// BindAuto decodes the request body into v according to its Content-Type:
+// JSON (also used when the header is absent), URL-encoded forms via
+// BindForm, and multipart/form-data text fields using the same form tag
+// rules as BindForm. Unlike Bind, it ignores decoders registered on the app.
+// Any other Content-Type fails with an *UnsupportedMediaTypeError.
+func (c *Context) BindAuto(v any) error {
+	return c.countBindError(c.bindAuto(v))
+}
+
+func (c *Context) bindAuto(v any) error {
+	mediaType := parseMediaType(c.requestHeader("Content-Type"))
+	switch {
+	case mediaType == "", mediaType == "application/json", strings.HasSuffix(mediaType, "+json"):
+		if len(c.body) == 0 {
+			return errors.New("empty request body")
+		}
+		return json.Unmarshal(c.body, v)
+	case mediaType == "application/x-www-form-urlencoded":
+		return c.bindForm(v)
+	case mediaType == "multipart/form-data":
+		multipart, err := c.ParseMultipart()
+		if err != nil {
+			return err
+		}
+		values := make(map[string][]string, len(multipart.Fields))
+		for _, field := range multipart.Fields {
+			if !field.IsFile {
+				values[field.Name] = append(values[field.Name], field.Value)
+			}
+		}
+		return bindValues(values, v, "form")
+	default:
+		return &UnsupportedMediaTypeError{ContentType: mediaType}
+	}
+}
+
+// isProtobufContentType reports whether a media type denotes Protobuf
+func isProtobufContentType(mediaType string) bool {
+	return mediaType == "application/protobuf" || mediaType == "application/x-protobuf"
+}
+
+// decodeForm decodes URL-encoded form data into a struct, like BindForm
+func decodeForm(data []byte, v any) error {
+	return bindValues(parseFormData(data).values(), v, "form")
+}
+
+// decodeMsgpack decodes MessagePack, matching struct fields by their json
+// tags so the same models serve JSON and MessagePack
+func decodeMsgpack(data []byte, v any) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+// =============================================================================
+// Bind Metrics
+// =============================================================================
+
+// MetricsRegistry receives metrics recorded by the Go layer, for bridging
+// into Prometheus or another metrics library. It must be safe for
+// concurrent use.
+type MetricsRegistry interface {
+	// IncCounter adds one to the counter name with the given labels
+	IncCounter(name string, labels map[string]string)
+}
+
+// bindErrorsMetric counts failed Bind* calls, labeled by operation
+const bindErrorsMetric = "request_bind_errors_total"
+
+// SetMetricsRegistry sets the registry that receives the app's Go-side
+// metrics. Once set, every failed Bind* call, such as Bind, BindValid or
+// BindQuery, increments request_bind_errors_total labeled with the
+// operation, which surfaces clients sending bad payloads that otherwise
+// hide in 400 responses. Set Config.DisableBindMetrics to opt out.
+func (a *App) SetMetricsRegistry(r MetricsRegistry) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.metrics = r
+}
+
+// countBindError records err in request_bind_errors_total, if it is not
+// nil, and returns it
+func (c *Context) countBindError(err error) error {
+	if err == nil || c.app == nil || c.app.config.DisableBindMetrics {
+		return err
+	}
+	c.app.mu.RLock()
+	metrics := c.app.metrics
+	c.app.mu.RUnlock()
+	if metrics != nil {
+		metrics.IncCounter(bindErrorsMetric, map[string]string{"operation": c.OperationID})
+	}
+	return err
+}
+
+// =============================================================================
+// Bind Validation
+// =============================================================================
+
+// BindValidate unmarshals the JSON body into the given struct after checking
+// that the body does not set any field tagged `archimedes:"readonly"`.
+//
+// Read-only fields guard against mass assignment when request structs reuse
+// response models (e.g. ID, CreatedAt). Unlike `json:"-"`, which silently
+// drops the value, a read-only field present in the body is rejected with an
+// ErrValidationError, which the handler callback maps to 400 Bad Request.
+//
+// Fields tagged `validate:"required"` must be present in the body. The
+// check is on presence, not value: a body that omits the field, or sets it
+// to null, is rejected with an ErrValidationError, while an explicit empty
+// value such as "" or 0 is accepted. Fields without the tag may be omitted
+// and keep their zero value, so for them absent and empty look the same.
+//
+// BindValidate fails fast: it reports only the first problem found. Use
+// BindValidateAll to report every invalid field at once, e.g. for forms.
+func (c *Context) BindValidate(v any) error {
+	return c.countBindError(c.bindValidate(v))
+}
+
+func (c *Context) bindValidate(v any) error {
+	if len(c.body) == 0 {
+		return errors.New("empty request body")
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(c.body, &fields); err == nil {
+		if names := readonlyFields(reflect.TypeOf(v), fields, ""); len(names) > 0 {
+			return &Error{
+				Code:    ErrValidationError,
+				Message: fmt.Sprintf("field %q is read-only", names[0]),
+			}
+		}
+		if names := missingRequiredFields(reflect.TypeOf(v), fields, ""); len(names) > 0 {
+			return &Error{
+				Code:    ErrValidationError,
+				Message: fmt.Sprintf("field %q is required", names[0]),
+			}
+		}
+	}
+
+	return json.Unmarshal(c.body, v)
+}
+
+// BindValidateAll is like BindValidate but checks every field before
+// returning, so a client can show all form errors from one response. It
+// returns a *ValidationError whose Fields list each read-only field set by
+// the body (rule "readonly"), each required field missing from it (rule
+// "required") and each field whose value has the wrong JSON type (rule
+// "type"). v is only bound if no field is invalid.
+func (c *Context) BindValidateAll(v any) error {
+	return c.countBindError(c.bindValidateAll(v))
+}
+
+func (c *Context) bindValidateAll(v any) error {
+	if len(c.body) == 0 {
+		return errors.New("empty request body")
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(c.body, &fields); err != nil {
+		return json.Unmarshal(c.body, v)
+	}
+
+	var invalid []FieldError
+	for _, name := range readonlyFields(reflect.TypeOf(v), fields, "") {
+		invalid = append(invalid, FieldError{
+			Path:    name,
+			Rule:    "readonly",
+			Message: fmt.Sprintf("field %q is read-only", name),
+		})
+	}
+	for _, name := range missingRequiredFields(reflect.TypeOf(v), fields, "") {
+		invalid = append(invalid, FieldError{
+			Path:    name,
+			Rule:    "required",
+			Message: fmt.Sprintf("field %q is required", name),
+		})
+	}
+
+	// encoding/json stops reporting type errors after the first one, so
+	// each top-level field is decoded on its own
+	if t := reflect.TypeOf(v); t != nil && t.Kind() == reflect.Pointer {
+		for _, key := range slices.Sorted(maps.Keys(fields)) {
+			single, err := json.Marshal(map[string]json.RawMessage{key: fields[key]})
+			if err != nil {
+				return err
+			}
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(json.Unmarshal(single, reflect.New(t.Elem()).Interface()), &typeErr) {
+				path := typeErr.Field
+				if path == "" {
+					path = key
+				}
+				invalid = append(invalid, FieldError{
+					Path:    path,
+					Rule:    "type",
+					Message: fmt.Sprintf("field %q must be %s, not %s", path, typeErr.Type, typeErr.Value),
+				})
+			}
+		}
+	}
+
+	if len(invalid) > 0 {
+		return NewValidationError("request body has invalid fields", invalid...)
+	}
+	return json.Unmarshal(c.body, v)
+}
+
+// BindAllowed unmarshals only the named top-level JSON fields from the body
+// into v, silently dropping any others. This prevents over-posting on APIs
+// where the request struct has more fields than the client may set.
+func (c *Context) BindAllowed(v any, fields ...string) error {
+	return c.countBindError(c.bindAllowed(v, fields, false))
+}
+
+// BindAllowedStrict is like BindAllowed but rejects a body containing any
+// field that is not in the allowlist with an ErrValidationError.
+func (c *Context) BindAllowedStrict(v any, fields ...string) error {
+	return c.countBindError(c.bindAllowed(v, fields, true))
+}
+
+func (c *Context) bindAllowed(v any, fields []string, strict bool) error {
+	if len(c.body) == 0 {
+		return errors.New("empty request body")
+	}
+
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(c.body, &body); err != nil {
+		return err
+	}
+
+	allowed := make(map[string]json.RawMessage, len(fields))
+	for key, raw := range body {
+		if isAllowedField(key, fields) {
+			allowed[key] = raw
+		} else if strict {
+			return &Error{
+				Code:    ErrValidationError,
+				Message: fmt.Sprintf("field %q is not allowed", key),
+			}
+		}
+	}
+
+	filtered, err := json.Marshal(allowed)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(filtered, v)
+}
+
+// BindLenientArrays unmarshals the JSON body into v like Bind, but tolerates
+// clients that wrap values in arrays inconsistently: a scalar bound into a
+// slice field becomes a single-element slice, and a single-element array
+// bound into a scalar field is unwrapped. Arrays with more than one element
+// still fail to bind into scalars. Strict consumers should keep using Bind.
+func (c *Context) BindLenientArrays(v any) error {
+	return c.countBindError(c.bindLenientArrays(v))
+}
+
+func (c *Context) bindLenientArrays(v any) error {
+	if len(c.body) == 0 {
+		return errors.New("empty request body")
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(c.body))
+	decoder.UseNumber()
+	var doc any
+	if err := decoder.Decode(&doc); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(coerceArrays(doc, reflect.TypeOf(v)))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// jsonUnmarshalerType is the reflect type of json.Unmarshaler
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// coerceArrays reshapes a decoded JSON value so that array-ness matches the
+// Go type t it will be bound into. Types with their own UnmarshalJSON are
+// left alone.
+func coerceArrays(value any, t reflect.Type) any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if reflect.PointerTo(t).Implements(jsonUnmarshalerType) {
+		return value
+	}
+
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		// []byte is a base64 string in JSON
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return value
+		}
+		if value == nil {
+			return nil
+		}
+		items, ok := value.([]any)
+		if !ok {
+			items = []any{value}
+		}
+		for i := range items {
+			items[i] = coerceArrays(items[i], t.Elem())
+		}
+		return items
+	case reflect.Struct:
+		if obj, ok := value.(map[string]any); ok {
+			coerceStructFields(obj, t)
+		}
+		return value
+	case reflect.Map:
+		if obj, ok := value.(map[string]any); ok {
+			for key, item := range obj {
+				obj[key] = coerceArrays(item, t.Elem())
+			}
+		}
+		return value
+	case reflect.Interface:
+		return value
+	default:
+		if items, ok := value.([]any); ok && len(items) == 1 {
+			return coerceArrays(items[0], t)
+		}
+		return value
+	}
+}
+
+// coerceStructFields applies coerceArrays to each member of obj that binds
+// to a field of struct type t, matching keys like encoding/json
+func coerceStructFields(obj map[string]any, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, skip := jsonFieldName(field)
+		if skip {
+			continue
+		}
+
+		// Embedded structs without a JSON name share the parent object
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			for embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				coerceStructFields(obj, embedded)
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		key, ok := name, false
+		if _, ok = obj[name]; !ok {
+			for candidate := range obj {
+				if strings.EqualFold(candidate, name) {
+					key, ok = candidate, true
+					break
+				}
+			}
+		}
+		if ok {
+			obj[key] = coerceArrays(obj[key], field.Type)
+		}
+	}
+}
+
+// isAllowedField reports whether key matches one of the allowlisted field
+// names, case-insensitively like encoding/json
+func isAllowedField(key string, fields []string) bool {
+	for _, field := range fields {
+		if strings.EqualFold(key, field) {
+			return true
+		}
+	}
+	return false
+}
+
+// readonlyFields returns the JSON paths of the read-only fields of t that
+// are present in fields, in field order.
+func readonlyFields(t reflect.Type, fields map[string]json.RawMessage, prefix string) []string {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var found []string
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, skip := jsonFieldName(field)
+		if skip {
+			continue
+		}
+
+		// Embedded structs without a JSON name share the parent object
+		if field.Anonymous && name == "" {
+			found = append(found, readonlyFields(field.Type, fields, prefix)...)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		raw, ok := lookupJSONField(fields, name)
+		if !ok {
+			continue
+		}
+		if hasArchimedesOption(field, "readonly") {
+			found = append(found, prefix+name)
+			continue
+		}
+
+		// Recurse into nested objects
+		var nested map[string]json.RawMessage
+		if json.Unmarshal(raw, &nested) == nil {
+			found = append(found, readonlyFields(field.Type, nested, prefix+name+".")...)
+		}
+	}
+	return found
+}
+
+// missingRequiredFields returns the JSON paths of the fields of t tagged
+// `validate:"required"` that are absent or null in fields, in field order.
+// Required fields of a nested object are only checked when the object
+// itself is present.
+func missingRequiredFields(t reflect.Type, fields map[string]json.RawMessage, prefix string) []string {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var missing []string
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, skip := jsonFieldName(field)
+		if skip {
+			continue
+		}
+
+		// Embedded structs without a JSON name share the parent object
+		if field.Anonymous && name == "" {
+			missing = append(missing, missingRequiredFields(field.Type, fields, prefix)...)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		raw, ok := lookupJSONField(fields, name)
+		if !ok || string(raw) == "null" {
+			if hasValidateRule(field, "required") {
+				missing = append(missing, prefix+name)
+			}
+			continue
+		}
+
+		// Recurse into nested objects
+		var nested map[string]json.RawMessage
+		if json.Unmarshal(raw, &nested) == nil {
+			missing = append(missing, missingRequiredFields(field.Type, nested, prefix+name+".")...)
+		}
+	}
+	return missing
+}
+
+// jsonFieldName returns the name from a field's json tag and whether the
+// field is excluded from JSON entirely.
+func jsonFieldName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", true
+	}
+	name, _, _ := strings.Cut(tag, ",")
+	return name, false
+}
+
+// lookupJSONField finds a key the way encoding/json matches fields: exact
+// match first, then case-insensitive.
+func lookupJSONField(fields map[string]json.RawMessage, name string) (json.RawMessage, bool) {
+	if raw, ok := fields[name]; ok {
+		return raw, true
+	}
+	for key, raw := range fields {
+		if strings.EqualFold(key, name) {
+			return raw, true
+		}
+	}
+	return nil, false
+}
+
+// hasArchimedesOption reports whether the field's `archimedes` tag contains
+// the given option.
+func hasArchimedesOption(field reflect.StructField, option string) bool {
+	for _, opt := range strings.Split(field.Tag.Get("archimedes"), ",") {
+		if strings.TrimSpace(opt) == option {
+			return true
+		}
+	}
+	return false
+}
+
+// hasValidateRule reports whether the field's `validate` tag contains the
+// given rule.
+func hasValidateRule(field reflect.StructField, rule string) bool {
+	for _, r := range strings.Split(field.Tag.Get("validate"), ",") {
+		if strings.TrimSpace(r) == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// =============================================================================
+// Contract Schema Validation
+// =============================================================================
+
+// FieldError describes a single field that failed validation
+type FieldError struct {
+	// Path is the location of the field, e.g. "address.city" or "tags[0]"
+	// (empty for the body itself)
+	Path string `json:"path"`
+
+	// Rule is the schema keyword that failed, e.g. "required" or "minLength"
+	Rule string `json:"rule"`
+
+	// Message is a human-readable description of the failure
+	Message string `json:"message"`
+}
+
+// ValidationError is returned when a request does not match the contract.
+// Fields lists every failing field.
+//
+// Handlers can inspect it with errors.As; it also matches *Error with code
+// ErrValidationError, so code that only checks error codes keeps working.
+// Returned from a handler it is rendered as 422 Unprocessable Entity.
+type ValidationError struct {
+	Code    int
+	Message string
+	Fields  []FieldError
+}
+
+// NewValidationError creates a ValidationError with code ErrValidationError
+func NewValidationError(message string, fields ...FieldError) *ValidationError {
+	return &ValidationError{Code: ErrValidationError, Message: message, Fields: fields}
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Fields) == 0 {
+		return e.Message
+	}
+	parts := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		parts[i] = f.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Message, strings.Join(parts, "; "))
+}
+
+// As lets errors.As match a ValidationError against *Error
+func (e *ValidationError) As(target any) bool {
+	if archErr, ok := target.(**Error); ok {
+		*archErr = &Error{Code: e.Code, Message: e.Error()}
+		return true
+	}
+	return false
+}
+
+// BindValid unmarshals the JSON body into v and validates the body against
+// the contract's request schema for the current OperationID, using the
+// native core's contract validator. It supports type, enum, required,
+// properties, additionalProperties, items, minLength, maxLength, minimum,
+// maximum, pattern and format (email, date-time), including nested
+// objects and array items.
+//
+// Returns a *ValidationError listing every failing field if the body does
+// not match the schema. Operations without a request schema are only bound.
+func (c *Context) BindValid(v any) error {
+	return c.countBindError(c.bindValid(v))
+}
+
+func (c *Context) bindValid(v any) error {
+	if err := c.bind(v); err != nil {
+		return err
+	}
+	if c.app == nil {
+		return &Error{Code: ErrInvalidOperation, Message: "context is not attached to an app"}
+	}
+
+	fields, err := c.app.validateRequest(c.OperationID, c.body)
+	if err != nil {
+		return err
+	}
+	if len(fields) > 0 {
+		return NewValidationError("request body does not match schema", fields...)
+	}
+	return nil
+}
+
+// validateRequest validates body against the request schema of the
+// operation in the native core
+func (a *App) validateRequest(operationID string, body []byte) ([]FieldError, error) {
+	cOpID := C.CString(operationID)
+	defer C.free(unsafe.Pointer(cOpID))
+	var cBody *C.uint8_t
+	if len(body) > 0 {
+		cBody = (*C.uint8_t)(C.CBytes(body))
+		defer C.free(unsafe.Pointer(cBody))
+	}
+
+	var cErrors *C.char
+	if err := C.archimedes_validate_request(a.handle, cOpID, cBody, C.size_t(len(body)), &cErrors); err != C.ARCHIMEDES_ERROR_OK {
+		return nil, &Error{Code: int(err), Message: C.GoString(C.archimedes_last_error())}
+	}
+	defer C.archimedes_string_free(cErrors)
+
+	var fields []FieldError
+	if err := json.Unmarshal([]byte(C.GoString(cErrors)), &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// contractSpec is the subset of a Themis contract used for routing
+type contractSpec struct {
+	operations map[string]contractOperation
+	schemas    map[string]any
+
+	// refPrefix is the prefix of $ref values naming an entry of schemas
+	// ("#/schemas/" when empty)
+	refPrefix string
+}
+
+// contractOperation is a single contract operation
+type contractOperation struct {
+	id     string
+	method string
+	path   string
+	tags   []string
+}
+
+// loadContract parses Config.ContractBytes, or reads and parses
+// Config.Contract, once, caching the result
+func (a *App) loadContract() (*contractSpec, error) {
+	a.contractOnce.Do(func() {
+		if a.config.ContractBytes != nil {
+			a.contract, a.contractErr = parseContract(a.config.ContractBytes)
+			return
+		}
+		data, err := os.ReadFile(a.config.Contract)
+		if err != nil {
+			a.contractErr = &Error{Code: ErrContractLoadError, Message: err.Error()}
+			return
+		}
+		a.contract, a.contractErr = parseContract(data)
+	})
+	return a.contract, a.contractErr
+}
+
+// parseContract parses contract JSON
+func parseContract(data []byte) (*contractSpec, error) {
+	var raw struct {
+		Operations []struct {
+			ID     string   `json:"id"`
+			Method string   `json:"method"`
+			Path   string   `json:"path"`
+			Tags   []string `json:"tags"`
+		} `json:"operations"`
+		Schemas map[string]any `json:"schemas"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, &Error{Code: ErrContractLoadError, Message: fmt.Sprintf("invalid contract: %v", err)}
+	}
+
+	spec := &contractSpec{
+		operations: make(map[string]contractOperation, len(raw.Operations)),
+		schemas:    raw.Schemas,
+	}
+	for _, op := range raw.Operations {
+		spec.operations[op.ID] = contractOperation{
+			id:     op.ID,
+			method: op.Method,
+			path:   op.Path,
+			tags:   op.Tags,
+		}
+	}
+	return spec, nil
+}
+
+// operation returns the contract operation with the given ID
+func (s *contractSpec) operation(id string) (contractOperation, bool) {
+	op, ok := s.operations[id]
+	return op, ok
+}
+
+// route returns the operation serving method and path together with its
+// path parameters. Literal segments take precedence over parameters.
+// pathMatched reports whether any operation matched the path, so callers
+// can tell 405 from 404 when ok is false.
+func (s *contractSpec) route(method, path string) (op contractOperation, params map[string]string, pathMatched, ok bool) {
+	ids := make([]string, 0, len(s.operations))
+	for id := range s.operations {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		candidate := s.operations[id]
+		candidateParams, matched := matchPath(candidate.path, path)
+		if !matched {
+			continue
+		}
+		pathMatched = true
+		if !strings.EqualFold(candidate.method, method) {
+			continue
+		}
+		if !ok || len(candidateParams) < len(params) {
+			op, params, ok = candidate, candidateParams, true
+		}
+	}
+	return op, params, pathMatched, ok
+}
+
+// matchPath matches a request path against a contract path template such
+// as "/users/{userId}"
+func matchPath(template, path string) (map[string]string, bool) {
+	templateSegments := strings.Split(strings.Trim(template, "/"), "/")
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(templateSegments) != len(pathSegments) {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+	for i, segment := range templateSegments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			if pathSegments[i] == "" {
+				return nil, false
+			}
+			params[segment[1:len(segment)-1]] = pathSegments[i]
+			continue
+		}
+		if segment != pathSegments[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// resolve follows a "#/schemas/Name" reference
+func (s *contractSpec) resolve(schema map[string]any) map[string]any {
+	prefix := s.refPrefix
+	if prefix == "" {
+		prefix = "#/schemas/"
+	}
+	for i := 0; i < 32; i++ {
+		ref, ok := schema["$ref"].(string)
+		if !ok {
+			return schema
+		}
+		name := strings.TrimPrefix(ref, prefix)
+		target, _ := s.schemas[name].(map[string]any)
+		if target == nil {
+			return map[string]any{}
+		}
+		schema = target
+	}
+	return schema
+}
+
+// emailPattern is a deliberately loose check for the "email" format
+var emailPattern = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+
+// validate checks value against schema, appending failures to fields.
+// It supports the JSON Schema keywords used by Themis contracts: type,
+// required, properties, additionalProperties, items, enum, minLength,
+// maxLength, minimum, maximum, pattern and format (email, date-time).
+func (s *contractSpec) validate(schema map[string]any, value any, path string, fields *[]FieldError) {
+	schema = s.resolve(schema)
+	fail := func(rule, message string) {
+		name := path
+		if name == "" {
+			name = "body"
+		}
+		*fields = append(*fields, FieldError{Path: path, Rule: rule, Message: name + " " + message})
+	}
+
+	if typ, ok := schema["type"].(string); ok && !matchesSchemaType(typ, value) {
+		fail("type", "must be of type "+typ)
+		return
+	}
+
+	if enum, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, allowed := range enum {
+			if reflect.DeepEqual(allowed, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("enum", "must be one of the allowed values")
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		props, _ := schema["properties"].(map[string]any)
+		if required, ok := schema["required"].([]any); ok {
+			for _, name := range required {
+				key, _ := name.(string)
+				if _, present := v[key]; !present {
+					*fields = append(*fields, FieldError{
+						Path:    joinFieldPath(path, key),
+						Rule:    "required",
+						Message: joinFieldPath(path, key) + " is required",
+					})
+				}
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if propSchema, ok := props[key].(map[string]any); ok {
+				s.validate(propSchema, v[key], joinFieldPath(path, key), fields)
+			} else if allowed, ok := schema["additionalProperties"].(bool); ok && !allowed {
+				*fields = append(*fields, FieldError{
+					Path:    joinFieldPath(path, key),
+					Rule:    "additionalProperties",
+					Message: joinFieldPath(path, key) + " is not allowed",
+				})
+			}
+		}
+
+	case []any:
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range v {
+				s.validate(items, item, fmt.Sprintf("%s[%d]", path, i), fields)
+			}
+		}
+
+	case string:
+		length := len([]rune(v))
+		if min, ok := schema["minLength"].(float64); ok && float64(length) < min {
+			fail("minLength", fmt.Sprintf("must be at least %d characters", int(min)))
+		}
+		if max, ok := schema["maxLength"].(float64); ok && float64(length) > max {
+			fail("maxLength", fmt.Sprintf("must be at most %d characters", int(max)))
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(v) {
+				fail("pattern", "must match pattern "+pattern)
+			}
+		}
+		if format, ok := schema["format"].(string); ok && !matchesSchemaFormat(format, v) {
+			fail("format", "must be a valid "+format)
+		}
+
+	case float64:
+		if min, ok := schema["minimum"].(float64); ok && v < min {
+			fail("minimum", fmt.Sprintf("must be at least %v", min))
+		}
+		if max, ok := schema["maximum"].(float64); ok && v > max {
+			fail("maximum", fmt.Sprintf("must be at most %v", max))
+		}
+	}
+}
+
+// matchesSchemaType reports whether value has the given JSON Schema type
+func matchesSchemaType(typ string, value any) bool {
+	switch typ {
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	}
+	return true
+}
+
+// matchesSchemaFormat checks the string formats used in contracts; unknown
+// formats are accepted
+func matchesSchemaFormat(format, value string) bool {
+	switch format {
+	case "email":
+		return emailPattern.MatchString(value)
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, value)
+		return err == nil
+	}
+	return true
+}
+
+// joinFieldPath appends a property name to a field path
+func joinFieldPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// =============================================================================
+// Handler
+// =============================================================================
+
+// Handler is the function signature for operation handlers
+type Handler func(ctx *Context) error
+
+// MiddlewareFunc wraps a handler with behavior that runs around it
+type MiddlewareFunc func(next Handler) Handler
+
+// Chain composes middlewares into one, applied in order: the first
+// middleware is outermost and sees the request first.
+func Chain(mw ...MiddlewareFunc) MiddlewareFunc {
+	return func(next Handler) Handler {
+		for i := len(mw) - 1; i >= 0; i-- {
+			next = mw[i](next)
+		}
+		return next
+	}
+}
+
+// =============================================================================
+// Application
+// =============================================================================
+
+// App represents an Archimedes application instance
+type App struct {
+	handle    *C.struct_archimedes_app
+	config    Config
+	handlers  map[string]Handler
+	lifecycle *Lifecycle
+	mu        sync.RWMutex
+
+	// handlerIDs maps operation IDs to their handler registry IDs
+	handlerIDs map[string]uintptr
+
+	// operationOrder holds the IDs of handlers in registration order
+	operationOrder []string
+
+	// operationTags holds the tags of the router each operation was merged
+	// from
+	operationTags map[string][]string
+
+	// registrationErrors holds the operations Merge failed to register
+	// (see RegistrationErrors)
+	registrationErrors map[string]error
+
+	// decoders are body decoders registered with RegisterDecoder
+	decoders map[string]Decoder
+
+	// middleware wraps every operation, outermost first (see Use)
+	middleware []MiddlewareFunc
+
+	// tagMiddleware wraps operations carrying a tag (see BindTagMiddleware)
+	tagMiddleware map[string][]MiddlewareFunc
+
+	// unsupportedMediaType renders 415 responses (nil for the default)
+	unsupportedMediaType Handler
+
+	// responseCache holds serialized JSONCached responses by key
+	responseCache   map[string][]byte
+	responseCacheMu sync.RWMutex
+
+	// started is true between successful startup hooks and shutdown hooks
+	started bool
+
+	// inFlight is the number of requests currently being handled
+	inFlight atomic.Int64
+
+	// requestsCtx is the parent of every request's Context.Context;
+	// ShutdownNow cancels it through cancelRequests
+	requestsCtx    context.Context
+	cancelRequests context.CancelFunc
+
+	// templateFS holds templates for Context.Render, parsed on first use
+	templateFS  fs.FS
+	templates   map[string]*template.Template
+	templatesMu sync.Mutex
+
+	// contract is the parsed contract, loaded on first use
+	contractOnce sync.Once
+	contract     *contractSpec
+	contractErr  error
+
+	// healthChecks are the dependency checks run by CheckHealth
+	healthChecks []healthCheck
+
+	// wildcards are the catch-all routes, longest prefix first
+	wildcards []wildcardRoute
+
+	// cors is the CORS policy set by UseCors (nil to disable)
+	cors *CorsConfig
+
+	// rateLimiter enforces the policy set by UseRateLimit (nil to disable)
+	rateLimiter *rateLimiter
+
+	// compression is the policy set by UseCompression (nil to disable)
+	compression *CompressionConfig
+
+	// metrics receives the app's Go-side metrics (see SetMetricsRegistry)
+	metrics MetricsRegistry
+
+	// responseHeaderFilter rewrites every response's headers before they
+	// are sent (see SetResponseHeaderFilter)
+	responseHeaderFilter func(headers map[string][]string)
+
+	// trustedProxies are the parsed Config.TrustedProxies
+	trustedProxies []netip.Prefix
+
+	// locales are the locales registered with RegisterLocale, by lowercase
+	// tag, and defaultLocale is the tag of the fallback
+	locales       map[string]Locale
+	defaultLocale string
+
+	// operationConfigs are the per-operation overrides set by
+	// ConfigureOperation
+	operationConfigs map[string]OperationConfig
+}
+
+// registeredHandler is a handler together with the app it was registered on
+type registeredHandler struct {
+	app     *App
+	handler Handler
+}
+
+// Handler registry for callbacks
+var (
+	handlerRegistry   = make(map[uintptr]registeredHandler)
 	handlerRegistryMu sync.RWMutex
 	nextHandlerID     uintptr
 )
 
-// New creates a new Archimedes application
-func New(cfg Config) (*App, error) {
-	// Set defaults
-	if cfg.Port == 0 {
-		cfg.Port = 8080
+// New creates a new Archimedes application
+func New(cfg Config) (*App, error) {
+	if cfg.UnixSocket != "" && cfg.Port != 0 && cfg.Port != 8080 {
+		return nil, &Error{Code: ErrInvalidConfig, Message: "only one of UnixSocket and Port may be set"}
+	}
+	trustedProxies, err := parseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set defaults
+	if cfg.Port == 0 {
+		cfg.Port = 8080
+	}
+	if cfg.MetricsPort == 0 {
+		cfg.MetricsPort = 9090
+	}
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = "archimedes-service"
+	}
+	if cfg.ShutdownTimeout == 0 {
+		cfg.ShutdownTimeout = 30
+	}
+	if cfg.MaxBodySize == 0 {
+		cfg.MaxBodySize = 1024 * 1024 // 1MB
+	}
+	if cfg.RequestTimeout == 0 {
+		cfg.RequestTimeout = 30
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+	if cfg.TLSMinVersion == "" {
+		cfg.TLSMinVersion = "1.2"
+	}
+	if cfg.UnixSocketMode == 0 {
+		cfg.UnixSocketMode = 0o600
+	}
+	if err := validateTLSConfig(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Contract != "" && cfg.ContractBytes != nil {
+		return nil, &Error{Code: ErrInvalidConfig, Message: "only one of Contract and ContractBytes may be set"}
+	}
+	if cfg.Contract == "" && cfg.ContractBytes == nil {
+		return nil, &Error{Code: ErrInvalidConfig, Message: "one of Contract and ContractBytes is required"}
+	}
+
+	if cfg.ContractBytes != nil {
+		cfg.ContractBytes = bytes.Clone(cfg.ContractBytes)
+	}
+
+	// Convert to C config
+	cConfig := C.struct_archimedes_config{
+		listen_port:                C.uint16_t(cfg.Port),
+		metrics_port:               C.uint16_t(cfg.MetricsPort),
+		enable_validation:          C.bool(cfg.EnableValidation),
+		enable_response_validation: C.bool(cfg.EnableResponseValidation),
+		enable_authorization:       C.bool(cfg.EnableAuthorization),
+		enable_tracing:             C.bool(cfg.EnableTracing),
+		shutdown_timeout_secs:      C.uint32_t(cfg.ShutdownTimeout),
+		max_body_size:              C.size_t(cfg.MaxBodySize),
+		request_timeout_secs:       C.uint32_t(cfg.RequestTimeout),
+		unix_socket_mode:           C.uint32_t(cfg.UnixSocketMode.Perm()),
+		http2_enabled:              C.bool(cfg.HTTP2Enabled),
+		h2c_enabled:                C.bool(cfg.H2CEnabled),
+	}
+
+	// Set string fields. In-memory contracts are loaded after creating the
+	// application, without a contract path.
+	if cfg.Contract != "" {
+		cContract := C.CString(cfg.Contract)
+		defer C.free(unsafe.Pointer(cContract))
+		cConfig.contract_path = cContract
+	}
+	if cfg.PolicyBundle != "" {
+		cBundle := C.CString(cfg.PolicyBundle)
+		defer C.free(unsafe.Pointer(cBundle))
+		cConfig.policy_bundle_path = cBundle
+	}
+	if cfg.ListenAddr != "" {
+		cAddr := C.CString(cfg.ListenAddr)
+		defer C.free(unsafe.Pointer(cAddr))
+		cConfig.listen_addr = cAddr
+	}
+	if cfg.OTLPEndpoint != "" {
+		cEndpoint := C.CString(cfg.OTLPEndpoint)
+		defer C.free(unsafe.Pointer(cEndpoint))
+		cConfig.otlp_endpoint = cEndpoint
+	}
+	if cfg.ServiceName != "" {
+		cName := C.CString(cfg.ServiceName)
+		defer C.free(unsafe.Pointer(cName))
+		cConfig.service_name = cName
+	}
+	if cfg.TLSCertFile != "" {
+		cCertPath := C.CString(cfg.TLSCertFile)
+		defer C.free(unsafe.Pointer(cCertPath))
+		cConfig.tls_cert_path = cCertPath
+	}
+	if cfg.TLSKeyFile != "" {
+		cKeyPath := C.CString(cfg.TLSKeyFile)
+		defer C.free(unsafe.Pointer(cKeyPath))
+		cConfig.tls_key_path = cKeyPath
+	}
+	if cfg.TLSCert != nil {
+		cCert := C.CString(string(cfg.TLSCert))
+		defer C.free(unsafe.Pointer(cCert))
+		cConfig.tls_cert_pem = cCert
+	}
+	if cfg.TLSKey != nil {
+		cKey := C.CString(string(cfg.TLSKey))
+		defer C.free(unsafe.Pointer(cKey))
+		cConfig.tls_key_pem = cKey
+	}
+	if cfg.TLSCACertFile != "" {
+		cCA := C.CString(cfg.TLSCACertFile)
+		defer C.free(unsafe.Pointer(cCA))
+		cConfig.tls_ca_cert_path = cCA
+	}
+	if cfg.UnixSocket != "" {
+		cSocket := C.CString(cfg.UnixSocket)
+		defer C.free(unsafe.Pointer(cSocket))
+		cConfig.unix_socket_path = cSocket
+	}
+	cMinVersion := C.CString(cfg.TLSMinVersion)
+	defer C.free(unsafe.Pointer(cMinVersion))
+	cConfig.tls_min_version = cMinVersion
+
+	// Create application
+	handle := C.archimedes_new(&cConfig)
+	if handle == nil {
+		errMsg := C.GoString(C.archimedes_last_error())
+		return nil, &Error{Code: ErrInvalidConfig, Message: errMsg}
+	}
+
+	// Hand in-memory contracts to the FFI layer directly
+	if cfg.ContractBytes != nil {
+		cJSON := C.CString(string(cfg.ContractBytes))
+		err := C.archimedes_load_contract(handle, cJSON)
+		C.free(unsafe.Pointer(cJSON))
+		if err != C.ARCHIMEDES_ERROR_OK {
+			errMsg := C.GoString(C.archimedes_last_error())
+			C.archimedes_free(handle)
+			return nil, &Error{Code: int(err), Message: errMsg}
+		}
+	}
+
+	app := &App{
+		handle:         handle,
+		config:         cfg,
+		handlers:       make(map[string]Handler),
+		handlerIDs:     make(map[string]uintptr),
+		operationTags:  make(map[string][]string),
+		lifecycle:      NewLifecycle(),
+		trustedProxies: trustedProxies,
+	}
+
+	app.lifecycle.SetLogger(cfg.Logger)
+	app.requestsCtx, app.cancelRequests = context.WithCancel(context.Background())
+
+	// Prevent GC of app while handle is alive
+	runtime.SetFinalizer(app, func(a *App) {
+		a.Close()
+	})
+
+	return app, nil
+}
+
+// validateTLSConfig checks that the TLS credentials are complete and
+// unambiguous
+func validateTLSConfig(cfg Config) error {
+	invalid := func(msg string) error {
+		return &Error{Code: ErrInvalidConfig, Message: msg}
+	}
+	if cfg.TLSMinVersion != "1.2" && cfg.TLSMinVersion != "1.3" {
+		return invalid(fmt.Sprintf("TLSMinVersion must be \"1.2\" or \"1.3\", got %q", cfg.TLSMinVersion))
+	}
+	if cfg.TLSCertFile != "" && cfg.TLSCert != nil {
+		return invalid("only one of TLSCertFile and TLSCert may be set")
+	}
+	if cfg.TLSKeyFile != "" && cfg.TLSKey != nil {
+		return invalid("only one of TLSKeyFile and TLSKey may be set")
+	}
+	hasCert := cfg.TLSCertFile != "" || cfg.TLSCert != nil
+	hasKey := cfg.TLSKeyFile != "" || cfg.TLSKey != nil
+	if hasCert != hasKey {
+		return invalid("a TLS certificate and key must be set together")
+	}
+	if cfg.TLSCACertFile != "" && !hasCert {
+		return invalid("TLSCACertFile requires a TLS certificate and key")
+	}
+	return nil
+}
+
+// Use adds app-level middleware that wraps every operation, including
+// operations registered before the call. app.Use(logger, auth, cors) runs
+// handlers as logger(auth(cors(handler))).
+//
+// App-level middleware always runs outermost, then router-level middleware
+// (see Router.Use), then the operation's own handler. Middleware cannot be
+// added once the server has started; Use returns ErrInvalidOperation then.
+func (a *App) Use(mw ...MiddlewareFunc) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.started {
+		return &Error{Code: ErrInvalidOperation, Message: "middleware cannot be added after the server has started"}
+	}
+	a.middleware = append(a.middleware, mw...)
+	return nil
+}
+
+// BindTagMiddleware applies mw to every operation tagged tag, either in
+// the contract or by the router it was merged from, so behavior declared
+// in the contract is wired up without per-route code:
+//
+//	app.BindTagMiddleware("cached", cacheMiddleware)
+//
+// Tag middleware runs inside app-level middleware and outside router-level
+// middleware. An operation with several bound tags runs their middleware in
+// the order the tags are declared.
+func (a *App) BindTagMiddleware(tag string, mw MiddlewareFunc) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.tagMiddleware == nil {
+		a.tagMiddleware = make(map[string][]MiddlewareFunc)
+	}
+	a.tagMiddleware[tag] = append(a.tagMiddleware[tag], mw)
+}
+
+// Operation registers a handler for an operation.
+// Returns ErrHandlerRegistration if handler is nil.
+//
+// Registering an operation that already has a handler replaces it, for
+// hot reloading or feature-flag-driven routing. If the new handler cannot
+// be registered the old one stays in place.
+func (a *App) Operation(operationID string, handler Handler) error {
+	if handler == nil {
+		return &Error{Code: ErrHandlerRegistration, Message: fmt.Sprintf("nil handler for operation '%s'", operationID)}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// Register in global registry for callbacks
+	handlerRegistryMu.Lock()
+	id := nextHandlerID
+	nextHandlerID++
+	handlerRegistry[id] = registeredHandler{app: a, handler: handler}
+	handlerRegistryMu.Unlock()
+
+	// Register with C API
+	cOpID := C.CString(operationID)
+	defer C.free(unsafe.Pointer(cOpID))
+
+	// The C layer rejects duplicates, so a replaced handler is
+	// unregistered first
+	oldID, replacing := a.handlerIDs[operationID]
+	if _, ok := a.handlers[operationID]; !ok {
+		replacing = false
+	}
+	if replacing {
+		if err := C.archimedes_unregister_handler(a.handle, cOpID); err != C.ARCHIMEDES_ERROR_OK {
+			errMsg := C.GoString(C.archimedes_last_error())
+			handlerRegistryMu.Lock()
+			delete(handlerRegistry, id)
+			handlerRegistryMu.Unlock()
+			return &Error{Code: int(err), Message: errMsg}
+		}
+	}
+
+	err := C.archimedes_register_handler(
+		a.handle,
+		cOpID,
+		(C.archimedes_handler_fn)(C.go_handler_callback),
+		unsafe.Pointer(id),
+	)
+
+	if err != C.ARCHIMEDES_ERROR_OK {
+		errMsg := C.GoString(C.archimedes_last_error())
+		handlerRegistryMu.Lock()
+		delete(handlerRegistry, id)
+		handlerRegistryMu.Unlock()
+		if replacing {
+			// Put the old handler back
+			C.archimedes_register_handler(
+				a.handle,
+				cOpID,
+				(C.archimedes_handler_fn)(C.go_handler_callback),
+				unsafe.Pointer(oldID),
+			)
+		}
+		return &Error{Code: int(err), Message: errMsg}
+	}
+
+	// Free the replaced handler's callback slot
+	if replacing {
+		handlerRegistryMu.Lock()
+		delete(handlerRegistry, oldID)
+		handlerRegistryMu.Unlock()
+	}
+
+	// Store handler
+	if _, ok := a.handlers[operationID]; !ok {
+		a.operationOrder = append(a.operationOrder, operationID)
+	}
+	a.handlers[operationID] = handler
+	a.handlerIDs[operationID] = id
+	delete(a.registrationErrors, operationID)
+
+	return nil
+}
+
+// RegisteredCount returns the number of operations registered with the
+// core. It counts the core's registrations rather than the app's handlers,
+// so comparing the two shows whether an operation failed to register.
+func (a *App) RegisteredCount() int {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return int(C.archimedes_handler_count(a.handle))
+}
+
+// RegistrationErrors returns the operations Merge failed to register,
+// with the error for each, to diagnose a partially merged app. An entry is
+// cleared once the operation registers successfully.
+func (a *App) RegistrationErrors() map[string]error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	errs := make(map[string]error, len(a.registrationErrors))
+	for opID, err := range a.registrationErrors {
+		errs[opID] = err
+	}
+	return errs
+}
+
+// recordRegistrationError records err for operationID. The caller must
+// hold a.mu.
+func (a *App) recordRegistrationError(operationID string, err error) {
+	if a.registrationErrors == nil {
+		a.registrationErrors = make(map[string]error)
+	}
+	a.registrationErrors[operationID] = err
+}
+
+// RemoveOperation unregisters the handler for an operation, so requests to
+// it get 501 Not Implemented as if it had never been registered. Returns
+// ErrInvalidOperation if the operation has no handler.
+func (a *App) RemoveOperation(operationID string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.handlers[operationID]; !ok {
+		return &Error{Code: ErrInvalidOperation, Message: fmt.Sprintf("no handler registered for operation '%s'", operationID)}
+	}
+	return a.removeOperation(operationID)
+}
+
+// wildcardRoute is a catch-all handler registered with Wildcard
+type wildcardRoute struct {
+	prefix  string
+	handler Handler
+}
+
+// Wildcard registers h for every request under prefix that no contract
+// operation matches, such as a proxy under "/proxy". The rest of the path
+// after the prefix is available from Context.Wildcard:
+//
+//	app.Wildcard("/proxy", func(ctx *archimedes.Context) error {
+//	    return forward(ctx, ctx.Wildcard()) // "a/b" for /proxy/a/b
+//	})
+//
+// Contract operations always take precedence, including a 405 for a known
+// path with another method. When prefixes overlap the longest one wins.
+// Wildcards are served by the Go dispatch path (ServeHTTP and TestClient).
+func (a *App) Wildcard(prefix string, h Handler) error {
+	if h == nil {
+		return &Error{Code: ErrHandlerRegistration, Message: fmt.Sprintf("nil handler for wildcard '%s'", prefix)}
+	}
+	prefix = strings.TrimRight(strings.TrimSuffix(prefix, "*"), "/")
+	if prefix != "" && !strings.HasPrefix(prefix, "/") {
+		return &Error{Code: ErrHandlerRegistration, Message: fmt.Sprintf("wildcard prefix '%s' must start with /", prefix)}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, route := range a.wildcards {
+		if route.prefix == prefix {
+			return &Error{Code: ErrHandlerRegistration, Message: fmt.Sprintf("wildcard '%s/*' already registered", prefix)}
+		}
+	}
+	a.wildcards = append(a.wildcards, wildcardRoute{prefix: prefix, handler: h})
+	sort.SliceStable(a.wildcards, func(i, j int) bool {
+		return len(a.wildcards[i].prefix) > len(a.wildcards[j].prefix)
+	})
+	return nil
+}
+
+// matchWildcard returns the wildcard handler for path and the remainder
+// of the path after its prefix
+func (a *App) matchWildcard(path string) (Handler, string, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	for _, route := range a.wildcards {
+		if path == route.prefix {
+			return route.handler, "", true
+		}
+		if rest, ok := strings.CutPrefix(path, route.prefix+"/"); ok {
+			return route.handler, rest, true
+		}
+	}
+	return nil, "", false
+}
+
+// removeOperation unregisters an operation from the C API and the handler
+// registries. The caller must hold a.mu.
+func (a *App) removeOperation(operationID string) error {
+	cOpID := C.CString(operationID)
+	defer C.free(unsafe.Pointer(cOpID))
+
+	err := C.archimedes_unregister_handler(a.handle, cOpID)
+	if err != C.ARCHIMEDES_ERROR_OK {
+		errMsg := C.GoString(C.archimedes_last_error())
+		return &Error{Code: int(err), Message: errMsg}
+	}
+
+	if id, ok := a.handlerIDs[operationID]; ok {
+		handlerRegistryMu.Lock()
+		delete(handlerRegistry, id)
+		handlerRegistryMu.Unlock()
+	}
+	delete(a.handlers, operationID)
+	delete(a.handlerIDs, operationID)
+	delete(a.operationTags, operationID)
+	a.operationOrder = slices.DeleteFunc(a.operationOrder, func(id string) bool { return id == operationID })
+	return nil
+}
+
+// Run runs the startup hooks, starts the server and blocks until shutdown.
+// Shutdown hooks run once the server stops.
+//
+// Startup hooks run in registration order before the server accepts
+// connections. If any startup hook fails, the server is not started and the
+// hook error is returned.
+//
+// addr overrides Config.ListenAddr and Config.Port. It may be ":8080",
+// "0.0.0.0:8080" or "host:port"; an empty host keeps Config.ListenAddr, and
+// an empty addr keeps the configured address. A malformed addr is an
+// ErrInvalidConfig and no hooks run. When Config.UnixSocket is set the
+// server listens on that socket and addr is ignored.
+func (a *App) Run(addr string) error {
+	if err := a.listenOn(addr); err != nil {
+		return err
+	}
+	if err := a.startup(); err != nil {
+		return err
+	}
+	runErr := a.run()
+	return errors.Join(runErr, a.shutdown())
+}
+
+// RunContext is like Run, but gracefully shuts the server down when ctx is
+// done: the server stops accepting requests, in-flight requests drain and
+// the shutdown hooks run, bounded by Config.ShutdownTimeout, before
+// RunContext returns. This suits embedded servers in tests or
+// invocation-style environments that control the server's lifetime with a
+// context rather than OS signals.
+//
+// Cancellation is a normal shutdown and is not reported as an error.
+// addr is interpreted as in Run.
+func (a *App) RunContext(ctx context.Context, addr string) error {
+	if err := a.listenOn(addr); err != nil {
+		return err
+	}
+	if err := a.startup(); err != nil {
+		return err
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- a.run()
+	}()
+
+	select {
+	case runErr := <-serverErr:
+		return errors.Join(runErr, a.shutdown())
+	case <-ctx.Done():
+	}
+
+	// Keep ctx's values but not its cancellation for the shutdown hooks
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Duration(a.config.ShutdownTimeout)*time.Second)
+	defer cancel()
+	shutdownErr := a.Shutdown(shutdownCtx)
+
+	var runErr error
+	select {
+	case runErr = <-serverErr:
+	case <-shutdownCtx.Done():
+	}
+	return errors.Join(runErr, shutdownErr)
+}
+
+// listenOn points the server at addr, as passed to Run
+func (a *App) listenOn(addr string) error {
+	if addr == "" || a.config.UnixSocket != "" {
+		return nil
+	}
+	host, port, err := parseListenAddr(addr)
+	if err != nil {
+		return err
+	}
+	if host == "" {
+		host = a.config.ListenAddr
+	}
+	if host == "" {
+		host = "0.0.0.0"
+	}
+
+	cAddr := C.CString(host)
+	defer C.free(unsafe.Pointer(cAddr))
+	if cerr := C.archimedes_set_listen_addr(a.handle, cAddr, C.uint16_t(port)); cerr != C.ARCHIMEDES_ERROR_OK {
+		errMsg := C.GoString(C.archimedes_last_error())
+		return &Error{Code: int(cerr), Message: errMsg}
+	}
+	a.config.ListenAddr = host
+	a.config.Port = port
+	return nil
+}
+
+// parseListenAddr splits a listen address such as ":8080" or
+// "127.0.0.1:8080" into its host and port. The host is empty when addr
+// names only a port.
+func parseListenAddr(addr string) (string, uint16, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", 0, &Error{Code: ErrInvalidConfig, Message: fmt.Sprintf("invalid listen address %q: %v", addr, err)}
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return "", 0, &Error{Code: ErrInvalidConfig, Message: fmt.Sprintf("invalid port in listen address %q", addr)}
+	}
+	return host, uint16(port), nil
+}
+
+// startup runs the startup hooks and marks the app as started
+func (a *App) startup() error {
+	if a.config.StrictMode {
+		if issues := a.Validate(); len(issues) > 0 {
+			messages := make([]string, len(issues))
+			for i, issue := range issues {
+				messages[i] = issue.String()
+			}
+			return &Error{
+				Code:    ErrInvalidConfig,
+				Message: fmt.Sprintf("server not started: strict mode: %s", strings.Join(messages, "; ")),
+			}
+		}
+	}
+
+	a.mu.Lock()
+	if a.lifecycle == nil {
+		a.lifecycle = NewLifecycle()
+	}
+	lifecycle := a.lifecycle
+	a.mu.Unlock()
+
+	if err := lifecycle.RunStartup(); err != nil {
+		return fmt.Errorf("server not started: %w", err)
+	}
+
+	a.mu.Lock()
+	a.started = true
+	a.mu.Unlock()
+	return nil
+}
+
+// shutdown runs the shutdown hooks if startup completed and they have not
+// already run. The hooks share a deadline of Config.ShutdownTimeout.
+func (a *App) shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(a.config.ShutdownTimeout)*time.Second)
+	defer cancel()
+	return a.shutdownContext(ctx)
+}
+
+// shutdownContext runs the shutdown hooks with ctx if startup completed and
+// they have not already run
+func (a *App) shutdownContext(ctx context.Context) error {
+	a.mu.Lock()
+	if !a.started {
+		a.mu.Unlock()
+		return nil
+	}
+	a.started = false
+	lifecycle := a.lifecycle
+	a.mu.Unlock()
+
+	return lifecycle.RunShutdownContext(ctx)
+}
+
+// run blocks in the C layer until the server stops
+func (a *App) run() (runErr error) {
+	if socket := a.config.UnixSocket; socket != "" {
+		if err := removeStaleSocket(socket); err != nil {
+			return err
+		}
+		defer func() {
+			runErr = errors.Join(runErr, removeSocketFile(socket))
+		}()
+	}
+
+	err := C.archimedes_run(a.handle)
+	if err != C.ARCHIMEDES_ERROR_OK {
+		errMsg := C.GoString(C.archimedes_last_error())
+		return &Error{Code: int(err), Message: errMsg}
+	}
+	return nil
+}
+
+// removeStaleSocket removes a socket file at path left by a server that
+// is no longer running. A socket another process still listens on, or a
+// file that is not a socket, is an ErrInvalidConfig and left in place.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode().Type() != fs.ModeSocket {
+		return &Error{Code: ErrInvalidConfig, Message: fmt.Sprintf("unix socket path %s exists and is not a socket", path)}
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return &Error{Code: ErrInvalidConfig, Message: fmt.Sprintf("unix socket %s is in use by another process", path)}
+	}
+	return os.Remove(path)
+}
+
+// removeSocketFile unlinks the socket file at path, if it is still a socket
+func removeSocketFile(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil || info.Mode().Type() != fs.ModeSocket {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// RunWithGracefulShutdown runs startup hooks, starts the server, and blocks
+// until SIGINT or SIGTERM is received. It then stops the server and runs the
+// shutdown hooks, bounded by Config.ShutdownTimeout. The server listens on
+// Config.ListenAddr and Config.Port, or Config.UnixSocket when set.
+//
+// Only a signal or a server error ends the wait: a server that returns
+// cleanly before a signal arrives still waits for it, so the shutdown hooks
+// always run on SIGINT or SIGTERM.
+//
+// Returns the first startup hook error (the server is not started), or any
+// error from the server, Stop, or the shutdown hooks.
+func (a *App) RunWithGracefulShutdown() error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	if err := a.startup(); err != nil {
+		return err
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- a.run()
+	}()
+
+	var runErr error
+	select {
+	case <-signals:
+	case runErr = <-serverErr:
+		if runErr == nil {
+			<-signals
+		}
+	}
+
+	timeout := time.Duration(a.config.ShutdownTimeout) * time.Second
+	done := make(chan error, 1)
+	go func() {
+		done <- a.Stop()
+	}()
+
+	select {
+	case err := <-done:
+		return errors.Join(runErr, err)
+	case <-time.After(timeout):
+		return errors.Join(runErr, &Error{
+			Code:    ErrInternal,
+			Message: fmt.Sprintf("shutdown did not complete within %s", timeout),
+		})
+	}
+}
+
+// Stop gracefully stops the server and runs the shutdown hooks
+func (a *App) Stop() error {
+	err := C.archimedes_stop(a.handle)
+	if err != C.ARCHIMEDES_ERROR_OK {
+		errMsg := C.GoString(C.archimedes_last_error())
+		return &Error{Code: int(err), Message: errMsg}
+	}
+	return a.shutdown()
+}
+
+// Shutdown gracefully stops the server: it stops accepting requests, waits
+// for in-flight requests to finish, then runs the shutdown hooks.
+//
+// Draining and the hooks are bounded by ctx. If ctx is done before all
+// requests finish, the hooks still run (with the cancelled context) and the
+// returned error wraps the context error.
+func (a *App) Shutdown(ctx context.Context) error {
+	err := C.archimedes_stop(a.handle)
+	if err != C.ARCHIMEDES_ERROR_OK {
+		errMsg := C.GoString(C.archimedes_last_error())
+		return &Error{Code: int(err), Message: errMsg}
+	}
+
+	drainErr := a.drain(ctx)
+	return errors.Join(drainErr, a.shutdownContext(ctx))
+}
+
+// ShutdownNow stops the server immediately. Unlike Stop and Shutdown, it
+// aborts in-flight requests instead of letting them finish: their
+// Context.Context is canceled, so handlers that pass it on stop waiting.
+// It then runs the shutdown hooks bounded by Config.ShutdownTimeout without
+// waiting for the handlers to return.
+func (a *App) ShutdownNow() error {
+	err := C.archimedes_stop(a.handle)
+	if err != C.ARCHIMEDES_ERROR_OK {
+		errMsg := C.GoString(C.archimedes_last_error())
+		return &Error{Code: int(err), Message: errMsg}
+	}
+
+	// Requests after a restart get a fresh parent context
+	a.mu.Lock()
+	cancel := a.cancelRequests
+	a.requestsCtx, a.cancelRequests = context.WithCancel(context.Background())
+	a.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	return a.shutdown()
+}
+
+// InFlight returns the number of requests currently being handled
+func (a *App) InFlight() int {
+	return int(a.inFlight.Load())
+}
+
+// drainPollInterval is how often drain checks for in-flight requests
+const drainPollInterval = 10 * time.Millisecond
+
+// drain waits until no requests are in flight or ctx is done
+func (a *App) drain(ctx context.Context) error {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		n := a.InFlight()
+		if n == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d requests still in flight: %w", n, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// serve runs handler for a request, tracking it as in flight and flushing
+// any streamed response
+func (a *App) serve(ctx *Context, handler Handler) error {
+	a.inFlight.Add(1)
+	defer a.inFlight.Add(-1)
+
+	a.mu.RLock()
+	cors, limiter, compression := a.cors, a.rateLimiter, a.compression
+	if ctx.stdCtx == nil {
+		ctx.stdCtx = a.requestsCtx
+	}
+	a.mu.RUnlock()
+	if cors != nil {
+		cors.setResponseHeaders(ctx)
+	}
+	if limiter != nil && !limiter.allow(ctx) {
+		return ctx.Error(429, "RATE_LIMITED", "Too many requests")
+	}
+
+	// Enforce per-operation limits before any handler code runs
+	limits := a.operationConfig(ctx.OperationID)
+	if limits.MaxBodySize > 0 && uint64(len(ctx.body)) > limits.MaxBodySize {
+		return ctx.Errorf(413, "PAYLOAD_TOO_LARGE", "Request body exceeds %d bytes", limits.MaxBodySize)
+	}
+	if limits.Timeout > 0 && ctx.Elapsed() > limits.Timeout {
+		return ctx.Errorf(408, "REQUEST_TIMEOUT", "Request timeout of %s exceeded", limits.Timeout)
+	}
+	var cancel context.CancelFunc
+	if limits.Timeout > 0 {
+		start := ctx.ReceivedAt
+		if start.IsZero() {
+			start = time.Now()
+		}
+		ctx.stdCtx, cancel = context.WithDeadline(ctx.Context(), start.Add(limits.Timeout))
+	} else {
+		ctx.stdCtx, cancel = context.WithCancel(ctx.Context())
+	}
+	defer cancel()
+
+	if tagged := a.taggedMiddleware(ctx.OperationID); len(tagged) > 0 {
+		handler = Chain(tagged...)(handler)
+	}
+	a.mu.RLock()
+	middleware := a.middleware
+	a.mu.RUnlock()
+	if len(middleware) > 0 {
+		handler = Chain(middleware...)(handler)
+	}
+
+	err := handler(ctx)
+	var mediaErr *UnsupportedMediaTypeError
+	if errors.As(err, &mediaErr) && !ctx.streaming {
+		err = a.renderUnsupportedMediaType(ctx)
+	}
+	if err == nil && ctx.stream != nil {
+		err = ctx.stream.Flush()
+	}
+	if err == nil && compression != nil {
+		err = compression.compress(ctx)
+	}
+	if err == nil && !ctx.streaming {
+		err = ctx.checkResponseSize(uint64(len(ctx.responseBody)))
+	}
+	return err
+}
+
+// checkResponseSize returns an error, logging it with the operation, if a
+// response body of size bytes exceeds Config.MaxResponseSize
+func (c *Context) checkResponseSize(size uint64) error {
+	if c.app == nil || c.app.config.MaxResponseSize == 0 || size <= c.app.config.MaxResponseSize {
+		return nil
+	}
+	limit := c.app.config.MaxResponseSize
+	c.Logger().Error("response exceeds MaxResponseSize", "size", size, "limit", limit)
+	return &Error{
+		Code:    ErrHandlerError,
+		Message: fmt.Sprintf("operation %s: response body exceeds %d bytes", c.OperationID, limit),
+	}
+}
+
+// taggedMiddleware returns the middleware bound to the tags of an operation
+func (a *App) taggedMiddleware(operationID string) []MiddlewareFunc {
+	a.mu.RLock()
+	empty := len(a.tagMiddleware) == 0
+	a.mu.RUnlock()
+	if empty {
+		return nil
+	}
+
+	spec, _ := a.loadContract()
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	var middleware []MiddlewareFunc
+	for _, tag := range a.tagsFor(operationID, spec) {
+		middleware = append(middleware, a.tagMiddleware[tag]...)
+	}
+	return middleware
+}
+
+// tagsFor returns the contract tags of an operation followed by the tags of
+// the router it was merged from, without duplicates. spec may be nil. The
+// caller must hold a.mu.
+func (a *App) tagsFor(operationID string, spec *contractSpec) []string {
+	tags := []string{}
+	seen := make(map[string]bool)
+	var contractTags []string
+	if spec != nil {
+		contractTags = spec.operations[operationID].tags
+	}
+	for _, list := range [][]string{contractTags, a.operationTags[operationID]} {
+		for _, tag := range list {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// renderUnsupportedMediaType replaces the response with the app's 415
+// response
+func (a *App) renderUnsupportedMediaType(ctx *Context) error {
+	a.mu.RLock()
+	handler := a.unsupportedMediaType
+	a.mu.RUnlock()
+	if handler == nil {
+		handler = defaultUnsupportedMediaType
+	}
+
+	ctx.responseStatus = 415
+	ctx.responseBody = nil
+	ctx.contentType = ""
+	return handler(ctx)
+}
+
+// InvalidateCache drops the response cached by Context.JSONCached under
+// key, so the next call serializes its value again
+func (a *App) InvalidateCache(key string) {
+	a.responseCacheMu.Lock()
+	defer a.responseCacheMu.Unlock()
+	delete(a.responseCache, key)
+}
+
+// OperationConfig overrides app-wide request limits for one operation
+type OperationConfig struct {
+	// Timeout replaces Config.RequestTimeout (0 keeps the app default)
+	Timeout time.Duration
+
+	// MaxBodySize replaces Config.MaxBodySize in bytes (0 keeps the app
+	// default)
+	MaxBodySize uint64
+}
+
+// ConfigureOperation overrides the request timeout or body size limit for
+// one operation, such as a longer timeout for report generation or a larger
+// limit for file uploads:
+//
+//	app.ConfigureOperation("uploadAvatar", archimedes.OperationConfig{MaxBodySize: 10 << 20})
+//
+// Requests over the limits get a 413 or 408 response before the handler or
+// middleware run. The timeout is the deadline of Context.Context, so
+// handlers that pass it on stop waiting once it expires, and it also bounds
+// streamed responses.
+//
+// The overrides are passed to the native core too, so a limit above
+// Config.MaxBodySize or Config.RequestTimeout takes effect for the
+// operation.
+func (a *App) ConfigureOperation(operationID string, cfg OperationConfig) error {
+	spec, err := a.loadContract()
+	if err != nil {
+		return err
+	}
+	if _, ok := spec.operation(operationID); !ok {
+		return &Error{Code: ErrInvalidOperation, Message: fmt.Sprintf("operation %s not found in contract", operationID)}
+	}
+	if cfg.Timeout < 0 {
+		return &Error{Code: ErrInvalidConfig, Message: fmt.Sprintf("operation %s: negative timeout", operationID)}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	cOpID := C.CString(operationID)
+	defer C.free(unsafe.Pointer(cOpID))
+	// Round the timeout up so a sub-millisecond one does not become the
+	// app default
+	timeoutMs := (cfg.Timeout + time.Millisecond - 1) / time.Millisecond
+	if err := C.archimedes_configure_operation(a.handle, cOpID, C.size_t(cfg.MaxBodySize), C.uint64_t(timeoutMs)); err != C.ARCHIMEDES_ERROR_OK {
+		return &Error{Code: int(err), Message: C.GoString(C.archimedes_last_error())}
+	}
+	if a.operationConfigs == nil {
+		a.operationConfigs = make(map[string]OperationConfig)
+	}
+	a.operationConfigs[operationID] = cfg
+	return nil
+}
+
+// operationConfig returns the effective limits for an operation: its
+// overrides, falling back to the app-wide config
+func (a *App) operationConfig(operationID string) OperationConfig {
+	a.mu.RLock()
+	cfg := a.operationConfigs[operationID]
+	a.mu.RUnlock()
+	if cfg.Timeout == 0 {
+		cfg.Timeout = time.Duration(a.config.RequestTimeout) * time.Second
+	}
+	if cfg.MaxBodySize == 0 {
+		cfg.MaxBodySize = a.config.MaxBodySize
+	}
+	return cfg
+}
+
+// URL builds the URL of an operation from its contract path, substituting
+// pathParams into the "{param}" segments and appending queryParams as an
+// encoded query string. It returns ErrInvalidOperation if the operation is
+// not in the contract or a path parameter is missing.
+func (a *App) URL(operationID string, pathParams map[string]string, queryParams map[string]string) (string, error) {
+	spec, err := a.loadContract()
+	if err != nil {
+		return "", err
+	}
+	op, ok := spec.operation(operationID)
+	if !ok {
+		return "", &Error{Code: ErrInvalidOperation, Message: fmt.Sprintf("operation %s not found in contract", operationID)}
+	}
+
+	segments := strings.Split(op.path, "/")
+	for i, segment := range segments {
+		if !strings.HasPrefix(segment, "{") || !strings.HasSuffix(segment, "}") {
+			continue
+		}
+		name := segment[1 : len(segment)-1]
+		value, ok := pathParams[name]
+		if !ok || value == "" {
+			return "", &Error{Code: ErrInvalidOperation, Message: fmt.Sprintf("operation %s: missing path parameter %s", operationID, name)}
+		}
+		segments[i] = url.PathEscape(value)
+	}
+	u := strings.Join(segments, "/")
+
+	if len(queryParams) > 0 {
+		query := make(url.Values, len(queryParams))
+		for k, v := range queryParams {
+			query.Set(k, v)
+		}
+		u += "?" + query.Encode()
+	}
+	return u, nil
+}
+
+// IsRunning returns true if the server is running
+func (a *App) IsRunning() bool {
+	return C.archimedes_is_running(a.handle) != 0
+}
+
+// Close frees the application resources, including the app's entries in
+// the global handler registry.
+func (a *App) Close() {
+	a.mu.Lock()
+	handlerRegistryMu.Lock()
+	for _, id := range a.handlerIDs {
+		delete(handlerRegistry, id)
+	}
+	handlerRegistryMu.Unlock()
+	clear(a.handlers)
+	clear(a.handlerIDs)
+	a.operationOrder = nil
+	a.mu.Unlock()
+
+	if a.handle != nil {
+		C.archimedes_free(a.handle)
+		a.handle = nil
+	}
+}
+
+// Version returns the Archimedes version string
+func Version() string {
+	return C.GoString(C.archimedes_version())
+}
+
+// =============================================================================
+// Router
+// =============================================================================
+
+// Router is a sub-router for grouping operations with shared configuration
+type Router struct {
+	prefix     string
+	tags       []string
+	operations map[string]Handler
+	middleware []MiddlewareFunc
+}
+
+// NewRouter creates a new router
+func NewRouter() *Router {
+	return &Router{
+		tags:       []string{},
+		operations: make(map[string]Handler),
+	}
+}
+
+// Prefix sets the path prefix for all operations in this router
+func (r *Router) Prefix(prefix string) *Router {
+	// Normalize prefix
+	if prefix != "" && prefix[0] != '/' {
+		prefix = "/" + prefix
+	}
+	if len(prefix) > 1 && prefix[len(prefix)-1] == '/' {
+		prefix = prefix[:len(prefix)-1]
+	}
+	r.prefix = prefix
+	return r
+}
+
+// Tag adds a tag to this router for grouping
+func (r *Router) Tag(tag string) *Router {
+	// Don't add duplicates
+	for _, t := range r.tags {
+		if t == tag {
+			return r
+		}
+	}
+	r.tags = append(r.tags, tag)
+	return r
+}
+
+// Operation registers a handler for an operation on this router.
+// It panics if handler is nil, so the mistake surfaces at registration
+// rather than at request time.
+func (r *Router) Operation(operationID string, handler Handler) *Router {
+	if handler == nil {
+		panic(fmt.Sprintf("archimedes: nil handler for operation '%s'", operationID))
+	}
+	r.operations[operationID] = handler
+	return r
+}
+
+// Use adds middleware that wraps every operation of this router when it is
+// merged into an app. Middlewares run in registration order, outermost
+// first.
+func (r *Router) Use(mw ...MiddlewareFunc) *Router {
+	r.middleware = append(r.middleware, mw...)
+	return r
+}
+
+// handlers returns the router's operations wrapped in its middleware
+func (r *Router) handlers() map[string]Handler {
+	if len(r.middleware) == 0 {
+		return r.operations
+	}
+	chain := Chain(r.middleware...)
+	handlers := make(map[string]Handler, len(r.operations))
+	for opID, handler := range r.operations {
+		if handler != nil {
+			handler = chain(handler)
+		}
+		handlers[opID] = handler
+	}
+	return handlers
+}
+
+// GetPrefix returns the current prefix
+func (r *Router) GetPrefix() string {
+	return r.prefix
+}
+
+// GetTags returns all tags
+func (r *Router) GetTags() []string {
+	return r.tags
+}
+
+// GetOperations returns all registered operations
+func (r *Router) GetOperations() map[string]Handler {
+	return r.operations
+}
+
+// Nest adds a child router under this router. The child's middleware is
+// applied to its operations.
+func (r *Router) Nest(child *Router) *Router {
+	// Copy operations from child with combined prefix
+	for opID, handler := range child.handlers() {
+		r.operations[opID] = handler
+	}
+	return r
+}
+
+// Merge copies all operations from another router, wrapped in the other
+// router's middleware
+func (r *Router) Merge(other *Router) *Router {
+	for opID, handler := range other.handlers() {
+		r.operations[opID] = handler
+	}
+	return r
+}
+
+// Merge merges a router's operations into this app, each wrapped in the
+// router's middleware chain (see Router.Use).
+//
+// Merge is all-or-nothing: every operation is checked for a nil handler or
+// an existing registration before any is registered, and if registration
+// still fails, the operations registered so far are removed again.
+func (a *App) Merge(router *Router) error {
+	operations := router.handlers()
+	ids := make([]string, 0, len(operations))
+	for opID := range operations {
+		ids = append(ids, opID)
+	}
+	sort.Strings(ids)
+
+	a.mu.Lock()
+	for _, opID := range ids {
+		var err error
+		if operations[opID] == nil {
+			err = &Error{Code: ErrHandlerRegistration, Message: fmt.Sprintf("nil handler for operation '%s'", opID)}
+		} else if _, exists := a.handlers[opID]; exists {
+			err = &Error{Code: ErrHandlerRegistration, Message: fmt.Sprintf("handler already registered for operation '%s'", opID)}
+		}
+		if err != nil {
+			a.recordRegistrationError(opID, err)
+			a.mu.Unlock()
+			return err
+		}
+	}
+	a.mu.Unlock()
+
+	for i, opID := range ids {
+		if err := a.Operation(opID, operations[opID]); err != nil {
+			a.mu.Lock()
+			a.recordRegistrationError(opID, err)
+			for _, registered := range ids[:i] {
+				if rollbackErr := a.removeOperation(registered); rollbackErr != nil {
+					err = errors.Join(err, rollbackErr)
+				}
+			}
+			a.mu.Unlock()
+			return err
+		}
+	}
+
+	if tags := router.GetTags(); len(tags) > 0 {
+		a.mu.Lock()
+		for _, opID := range ids {
+			a.operationTags[opID] = append([]string(nil), tags...)
+		}
+		a.mu.Unlock()
+	}
+	return nil
+}
+
+// Group creates a router with the given prefix, passes it to fn to register
+// operations, and merges it into the app:
+//
+//	app.Group("/admin", func(r *archimedes.Router) {
+//	    r.Operation("getStats", getStatsHandler)
+//	})
+//
+// Like Router.Operation, Group panics if the router cannot be merged, e.g.
+// because an operation is already registered.
+func (a *App) Group(prefix string, fn func(r *Router)) *App {
+	return a.GroupWithTags(prefix, nil, fn)
+}
+
+// GroupWithTags is like Group, and also tags the router with tags
+func (a *App) GroupWithTags(prefix string, tags []string, fn func(r *Router)) *App {
+	router := NewRouter().Prefix(prefix)
+	for _, tag := range tags {
+		router.Tag(tag)
+	}
+	fn(router)
+	if err := a.Merge(router); err != nil {
+		panic(fmt.Sprintf("archimedes: group %s: %v", prefix, err))
+	}
+	return a
+}
+
+// Nest nests a router under a prefix in this app
+func (a *App) Nest(prefix string, router *Router) error {
+	// Set prefix on router if not already set
+	if router.GetPrefix() == "" {
+		router.Prefix(prefix)
+	}
+	return a.Merge(router)
+}
+
+// =============================================================================
+// Health Checks
+// =============================================================================
+
+// Health check statuses
+const (
+	HealthStatusHealthy   = "healthy"
+	HealthStatusUnhealthy = "unhealthy"
+	HealthStatusTimeout   = "timeout"
+	HealthStatusDegraded  = "degraded"
+)
+
+// healthCheck is a registered dependency check
+type healthCheck struct {
+	name    string
+	timeout time.Duration
+	check   func(ctx context.Context) error
+}
+
+// HealthCheckResult is the outcome of one health check
+type HealthCheckResult struct {
+	Name string `json:"name"`
+
+	// Status is HealthStatusHealthy, HealthStatusUnhealthy or
+	// HealthStatusTimeout
+	Status string `json:"status"`
+
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// HealthReport is the aggregate health of the app's dependencies
+type HealthReport struct {
+	// Status is HealthStatusHealthy if every check passed and
+	// HealthStatusDegraded otherwise
+	Status  string              `json:"status"`
+	Service string              `json:"service"`
+	Checks  []HealthCheckResult `json:"checks"`
+}
+
+// RegisterHealthCheckTimeout registers a dependency check run by
+// CheckHealth. The check's context is cancelled after timeout, and a check
+// still running then is reported with HealthStatusTimeout, even if it
+// ignores cancellation.
+func (a *App) RegisterHealthCheckTimeout(name string, timeout time.Duration, check func(ctx context.Context) error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.healthChecks = append(a.healthChecks, healthCheck{name: name, timeout: timeout, check: check})
+}
+
+// CheckHealth runs every registered health check concurrently, each with
+// its own deadline, so it returns within the longest check timeout (or
+// sooner if ctx is done). Results are in registration order.
+func (a *App) CheckHealth(ctx context.Context) HealthReport {
+	a.mu.RLock()
+	checks := append([]healthCheck(nil), a.healthChecks...)
+	a.mu.RUnlock()
+
+	report := HealthReport{
+		Status:  HealthStatusHealthy,
+		Service: a.config.ServiceName,
+		Checks:  make([]HealthCheckResult, len(checks)),
+	}
+	var wg sync.WaitGroup
+	for i, hc := range checks {
+		wg.Add(1)
+		go func(i int, hc healthCheck) {
+			defer wg.Done()
+			report.Checks[i] = hc.run(ctx)
+		}(i, hc)
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if result.Status != HealthStatusHealthy {
+			report.Status = HealthStatusDegraded
+		}
+	}
+	return report
+}
+
+// run runs the check, abandoning it once its deadline passes
+func (hc healthCheck) run(ctx context.Context) HealthCheckResult {
+	ctx, cancel := context.WithTimeout(ctx, hc.timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- hc.check(ctx)
+	}()
+
+	result := HealthCheckResult{Name: hc.name, Status: HealthStatusHealthy}
+	select {
+	case err := <-done:
+		if err != nil {
+			result.Status = HealthStatusUnhealthy
+			result.Error = err.Error()
+		}
+	case <-ctx.Done():
+		result.Status = HealthStatusTimeout
+		result.Error = fmt.Sprintf("check did not complete within %s", hc.timeout)
+	}
+	result.DurationMS = time.Since(start).Milliseconds()
+	return result
+}
+
+// ServeHealth registers a handler for operationID that responds with
+// CheckHealth as JSON: 200 when healthy and 503 when degraded
+func (a *App) ServeHealth(operationID string) error {
+	return a.Operation(operationID, func(ctx *Context) error {
+		report := a.CheckHealth(context.Background())
+		status := 200
+		if report.Status != HealthStatusHealthy {
+			status = 503
+		}
+		return ctx.JSON(status, report)
+	})
+}
+
+// =============================================================================
+// Introspection
+// =============================================================================
+
+// OperationInfo describes an operation known to an app
+type OperationInfo struct {
+	ID     string   `json:"id"`
+	Method string   `json:"method"`
+	Path   string   `json:"path"`
+	Tags   []string `json:"tags"`
+
+	// HasHandler is false for contract operations with no registered handler
+	HasHandler bool `json:"has_handler"`
+}
+
+// ListOperations returns the contract operations together with any
+// registered handlers not in the contract, sorted by ID. Method and Path
+// are empty when the contract cannot be loaded. Tags are the operation's
+// contract tags followed by those of the router it was merged from.
+func (a *App) ListOperations() []OperationInfo {
+	spec, _ := a.loadContract()
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	ops := make(map[string]OperationInfo)
+	if spec != nil {
+		for id, op := range spec.operations {
+			ops[id] = OperationInfo{ID: id, Method: op.method, Path: op.path}
+		}
+	}
+	for id := range a.handlers {
+		ops[id] = OperationInfo{ID: id, Method: ops[id].Method, Path: ops[id].Path, HasHandler: true}
+	}
+
+	infos := make([]OperationInfo, 0, len(ops))
+	for id, info := range ops {
+		info.Tags = a.tagsFor(id, spec)
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
+
+// OrderedRoutes returns the operations with a registered handler in the
+// order they were registered, so generated docs and test output are
+// stable across runs. Replacing a handler keeps its position; removing it
+// drops it. Unlike ListOperations, contract operations without a handler
+// are not included.
+func (a *App) OrderedRoutes() []OperationInfo {
+	spec, _ := a.loadContract()
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	infos := make([]OperationInfo, 0, len(a.operationOrder))
+	for _, id := range a.operationOrder {
+		info := OperationInfo{ID: id, Tags: a.tagsFor(id, spec), HasHandler: true}
+		if spec != nil {
+			if op, ok := spec.operations[id]; ok {
+				info.Method, info.Path = op.method, op.path
+			}
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// ServeIntrospection registers a handler for operationID that responds
+// with ListOperations as JSON
+func (a *App) ServeIntrospection(operationID string) error {
+	return a.Operation(operationID, func(ctx *Context) error {
+		return ctx.JSON(200, a.ListOperations())
+	})
+}
+
+// =============================================================================
+// Contract Coverage
+// =============================================================================
+
+// Kinds of ValidationIssue
+const (
+	// IssueMissingHandler is a contract operation with no handler
+	IssueMissingHandler = "missing_handler"
+
+	// IssueUnknownOperation is a handler for an operation ID that is not in
+	// the contract
+	IssueUnknownOperation = "unknown_operation"
+
+	// IssuePossibleTypo is a handler for an unknown operation ID that is
+	// close to the ID of a contract operation with no handler
+	IssuePossibleTypo = "possible_typo"
+
+	// IssueContractError means the contract could not be loaded
+	IssueContractError = "contract_error"
+)
+
+// ValidationIssue describes a mismatch between the registered handlers and
+// the contract
+type ValidationIssue struct {
+	Kind        string
+	OperationID string
+	Message     string
+
+	// Suggestion is the contract operation ID an IssuePossibleTypo handler
+	// was probably meant for
+	Suggestion string
+}
+
+// String returns the issue message
+func (i ValidationIssue) String() string {
+	return i.Message
+}
+
+// Validate compares the registered handlers against the contract and
+// returns an issue for every contract operation without a handler and
+// every handler whose operation ID is not in the contract, flagging IDs
+// that look like typos of an unhandled operation. Issues are sorted by
+// operation ID. See also Config.StrictMode.
+func (a *App) Validate() []ValidationIssue {
+	spec, err := a.loadContract()
+	if err != nil {
+		return []ValidationIssue{{Kind: IssueContractError, Message: err.Error()}}
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	var missing []string
+	for id := range spec.operations {
+		if _, ok := a.handlers[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	sort.Strings(missing)
+
+	var issues []ValidationIssue
+	for _, id := range missing {
+		issues = append(issues, ValidationIssue{
+			Kind:        IssueMissingHandler,
+			OperationID: id,
+			Message:     fmt.Sprintf("operation %s has no handler", id),
+		})
+	}
+	for id := range a.handlers {
+		if _, ok := spec.operations[id]; ok {
+			continue
+		}
+		issue := ValidationIssue{
+			Kind:        IssueUnknownOperation,
+			OperationID: id,
+			Message:     fmt.Sprintf("handler registered for unknown operation %s", id),
+		}
+		if suggestion := closestOperationID(id, missing); suggestion != "" {
+			issue.Kind = IssuePossibleTypo
+			issue.Suggestion = suggestion
+			issue.Message = fmt.Sprintf("handler registered for unknown operation %s (did you mean %s?)", id, suggestion)
+		}
+		issues = append(issues, issue)
+	}
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].OperationID < issues[j].OperationID })
+	return issues
+}
+
+// closestOperationID returns the candidate within a small edit distance of
+// id, or "" if there is none
+func closestOperationID(id string, candidates []string) string {
+	best, bestDistance := "", 3
+	for _, candidate := range candidates {
+		d := editDistance(strings.ToLower(id), strings.ToLower(candidate))
+		if d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// =============================================================================
+// Pagination
+// =============================================================================
+
+// Pagination holds the paging parameters of a list request
+type Pagination struct {
+	Limit  int
+	Offset int
+	Cursor string
+}
+
+// Pagination reads the limit, offset and cursor query parameters.
+//
+// Limit defaults to defaultLimit when absent, not a number, or not
+// positive, and is clamped to maxLimit. Offset defaults to 0 when absent,
+// not a number, or negative.
+func (c *Context) Pagination(defaultLimit, maxLimit int) Pagination {
+	query, _ := url.ParseQuery(c.Query)
+	p := Pagination{Limit: defaultLimit, Cursor: query.Get("cursor")}
+	if limit, err := strconv.Atoi(query.Get("limit")); err == nil && limit > 0 {
+		p.Limit = limit
+	}
+	if maxLimit > 0 && p.Limit > maxLimit {
+		p.Limit = maxLimit
+	}
+	if offset, err := strconv.Atoi(query.Get("offset")); err == nil && offset > 0 {
+		p.Offset = offset
+	}
+	return p
+}
+
+// LinkHeader sets an RFC 5988 Link response header pointing to the next
+// and previous pages. Empty URLs are omitted; if both are empty no header
+// is set.
+func (c *Context) LinkHeader(next, prev string) {
+	var links []string
+	if next != "" {
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, next))
+	}
+	if prev != "" {
+		links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, prev))
+	}
+	if len(links) > 0 {
+		c.SetHeader("Link", strings.Join(links, ", "))
+	}
+}
+
+// listEnvelope is the body written by Context.List
+type listEnvelope struct {
+	Items  any    `json:"items"`
+	Total  int    `json:"total"`
+	Limit  *int   `json:"limit,omitempty"`
+	Offset *int   `json:"offset,omitempty"`
+	Cursor string `json:"cursor,omitempty"`
+}
+
+// List sends a list response in the standard envelope
+// {"items":[...],"total":N}, so list endpoints share one shape. items is a
+// slice; nil encodes as []. total is the size of the full collection, not
+// just this page. Passing the request's Pagination adds its limit, offset
+// and cursor:
+//
+//	page := ctx.Pagination(20, 100)
+//	return ctx.List(200, users[start:end], len(users), page)
+func (c *Context) List(status int, items any, total int, page ...Pagination) error {
+	if v := reflect.ValueOf(items); !v.IsValid() || (v.Kind() == reflect.Slice && v.IsNil()) {
+		items = []any{}
+	}
+	body := listEnvelope{Items: items, Total: total}
+	if len(page) > 0 {
+		body.Limit = &page[0].Limit
+		body.Offset = &page[0].Offset
+		body.Cursor = page[0].Cursor
+	}
+	return c.JSON(status, body)
+}
+
+// =============================================================================
+// Form Data Extractor
+// =============================================================================
+
+// Form parses URL-encoded form data from the request body
+type Form map[string]string
+
+// ParseForm parses the request body as URL-encoded form data
+func (c *Context) ParseForm() (Form, error) {
+	return parseFormData(c.body), nil
+}
+
+// parseFormData parses URL-encoded form data
+func parseFormData(body []byte) Form {
+	if len(body) == 0 {
+		return Form{}
+	}
+
+	form := make(Form)
+	pairs := string(body)
+
+	for _, pair := range splitString(pairs, '&') {
+		if pair == "" {
+			continue
+		}
+		kv := splitString(pair, '=')
+		if len(kv) >= 1 {
+			key := urlDecode(kv[0])
+			value := ""
+			if len(kv) >= 2 {
+				value = urlDecode(kv[1])
+			}
+			form[key] = value
+		}
+	}
+
+	return form
+}
+
+// Get returns a form field value by name
+func (f Form) Get(name string) string {
+	return f[name]
+}
+
+// GetOr returns a form field value or a default if not present
+func (f Form) GetOr(name, defaultValue string) string {
+	if val, ok := f[name]; ok {
+		return val
+	}
+	return defaultValue
+}
+
+// Has returns true if the form has a field with the given name
+func (f Form) Has(name string) bool {
+	_, ok := f[name]
+	return ok
+}
+
+// BindForm parses the URL-encoded form body into the struct pointed to by v.
+//
+// Keys are matched to fields by their `form:"..."` tag, falling back to the
+// `json:"..."` tag and then the field name. Fields may be strings, integers,
+// unsigned integers, floats, booleans, or pointers to these. A value that
+// cannot be converted is rejected with an ErrValidationError naming the field.
+func (c *Context) BindForm(v any) error {
+	return c.countBindError(c.bindForm(v))
+}
+
+func (c *Context) bindForm(v any) error {
+	form, err := c.ParseForm()
+	if err != nil {
+		return err
+	}
+	return bindValues(form.values(), v, "form")
+}
+
+// values returns the form as multi-valued parameters for bindValues
+func (f Form) values() map[string][]string {
+	values := make(map[string][]string, len(f))
+	for name, value := range f {
+		values[name] = []string{value}
+	}
+	return values
+}
+
+// BindQuery parses the query string into the struct pointed to by v.
+//
+// Parameters are matched to fields by their `query:"..."` tag, falling back
+// to the `json:"..."` tag and then the field name, case-insensitively. Field
+// types are as for BindForm; slice fields collect repeated parameters
+// (?id=1&id=2), and pointer fields stay nil when the parameter is absent.
+// A value that cannot be converted is rejected with an ErrValidationError
+// naming the parameter.
+func (c *Context) BindQuery(v any) error {
+	return c.countBindError(c.bindQuery(v))
+}
+
+func (c *Context) bindQuery(v any) error {
+	values, err := url.ParseQuery(c.Query)
+	if err != nil {
+		return &Error{Code: ErrValidationError, Message: fmt.Sprintf("invalid query string: %v", err)}
+	}
+	return bindValues(values, v, "query")
+}
+
+// bindValues assigns string values to the fields of the struct pointed to
+// by v, matching keys using the given tag with a json tag fallback
+func bindValues(values map[string][]string, v any, tagName string) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("bind %s: expected pointer to struct, got %T", tagName, v)
+	}
+	return bindStructValues(values, rv.Elem(), tagName)
+}
+
+// bindStructValues assigns values to the fields of a struct value,
+// descending into embedded structs
+func bindStructValues(values map[string][]string, rv reflect.Value, tagName string) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && field.Tag.Get(tagName) == "" {
+			if err := bindStructValues(values, rv.Field(i), tagName); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get(tagName), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			jsonName, skip := jsonFieldName(field)
+			if skip {
+				continue
+			}
+			name = jsonName
+		}
+		fieldValues, ok := values[name]
+		if name == "" {
+			name = field.Name
+			fieldValues, ok = lookupFold(values, name)
+		}
+		if !ok || len(fieldValues) == 0 {
+			continue
+		}
+
+		fv := rv.Field(i)
+		if fv.Kind() == reflect.Slice {
+			slice := reflect.MakeSlice(fv.Type(), len(fieldValues), len(fieldValues))
+			for j, value := range fieldValues {
+				if err := setFieldFromString(slice.Index(j), value); err != nil {
+					return conversionError(tagName, name, value, fv.Type().Elem())
+				}
+			}
+			fv.Set(slice)
+			continue
+		}
+		if err := setFieldFromString(fv, fieldValues[0]); err != nil {
+			return conversionError(tagName, name, fieldValues[0], field.Type)
+		}
+	}
+	return nil
+}
+
+// lookupFold finds values by case-insensitive name
+func lookupFold(values map[string][]string, name string) ([]string, bool) {
+	if v, ok := values[name]; ok {
+		return v, true
+	}
+	for key, v := range values {
+		if strings.EqualFold(key, name) {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// conversionError reports a value that cannot be converted to its field type
+func conversionError(tagName, name, value string, typ reflect.Type) error {
+	kind := "field"
+	if tagName == "query" {
+		kind = "query parameter"
+	}
+	return &Error{
+		Code:    ErrValidationError,
+		Message: fmt.Sprintf("%s %q: cannot convert %q to %s", kind, name, value, typ),
+	}
+}
+
+// setFieldFromString converts value to the field's type and assigns it
+func setFieldFromString(fv reflect.Value, value string) error {
+	if fv.Kind() == reflect.Pointer {
+		elem := reflect.New(fv.Type().Elem())
+		if err := setFieldFromString(elem.Elem(), value); err != nil {
+			return err
+		}
+		fv.Set(elem)
+		return nil
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", fv.Type())
+	}
+	return nil
+}
+
+// =============================================================================
+// Cookie Extractor
+// =============================================================================
+
+// Cookies parses cookies from the Cookie header
+type Cookies map[string]string
+
+// ParseCookies parses the Cookie header into a map
+func (c *Context) ParseCookies() Cookies {
+	cookies := make(Cookies)
+	cookieHeader := c.Headers["Cookie"]
+	if cookieHeader == "" {
+		cookieHeader = c.Headers["cookie"]
+	}
+	if cookieHeader == "" {
+		return cookies
+	}
+
+	for _, part := range splitString(cookieHeader, ';') {
+		part = trimSpace(part)
+		if part == "" {
+			continue
+		}
+		kv := splitString(part, '=')
+		if len(kv) >= 2 {
+			cookies[trimSpace(kv[0])] = trimSpace(kv[1])
+		}
+	}
+
+	return cookies
+}
+
+// Get returns a cookie value by name
+func (c Cookies) Get(name string) string {
+	return c[name]
+}
+
+// GetOr returns a cookie value or a default if not present
+func (c Cookies) GetOr(name, defaultValue string) string {
+	if val, ok := c[name]; ok {
+		return val
+	}
+	return defaultValue
+}
+
+// Has returns true if the cookie exists
+func (c Cookies) Has(name string) bool {
+	_, ok := c[name]
+	return ok
+}
+
+// GetSigned returns the value of a cookie signed with SetCookie.Sign.
+// The signature is accepted if it matches any of the given keys, so keys can
+// be rotated by passing the current key followed by previous ones. Returns
+// false if the cookie is absent or the signature is invalid.
+func (c Cookies) GetSigned(name string, keys ...[]byte) (string, bool) {
+	raw, ok := c[name]
+	if !ok {
+		return "", false
+	}
+
+	idx := strings.LastIndexByte(raw, '.')
+	if idx < 0 {
+		return "", false
+	}
+	value, signature := raw[:idx], raw[idx+1:]
+
+	for _, key := range keys {
+		expected := cookieSignature(key, name, value)
+		if hmac.Equal([]byte(signature), []byte(expected)) {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// cookieSignature computes the hex HMAC-SHA256 of a cookie name and value
+func cookieSignature(key []byte, name, value string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(name + "=" + value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// =============================================================================
+// Set-Cookie Builder
+// =============================================================================
+
+// SameSite represents the SameSite cookie attribute
+type SameSite string
+
+const (
+	SameSiteNone   SameSite = "None"
+	SameSiteLax    SameSite = "Lax"
+	SameSiteStrict SameSite = "Strict"
+)
+
+// SetCookie builds Set-Cookie header values
+type SetCookie struct {
+	name     string
+	value    string
+	path     string
+	domain   string
+	expires  string
+	maxAge   int
+	secure   bool
+	httpOnly bool
+	sameSite SameSite
+	hasMaxAge bool
+	signKey  []byte
+}
+
+// NewSetCookie creates a new Set-Cookie builder
+func NewSetCookie(name, value string) *SetCookie {
+	return &SetCookie{
+		name:     name,
+		value:    value,
+		sameSite: SameSiteLax,
 	}
-	if cfg.MetricsPort == 0 {
-		cfg.MetricsPort = 9090
+}
+
+// Path sets the Path attribute
+func (s *SetCookie) Path(path string) *SetCookie {
+	s.path = path
+	return s
+}
+
+// Domain sets the Domain attribute
+func (s *SetCookie) Domain(domain string) *SetCookie {
+	s.domain = domain
+	return s
+}
+
+// Expires sets the Expires attribute (RFC 7231 format)
+func (s *SetCookie) Expires(expires string) *SetCookie {
+	s.expires = expires
+	return s
+}
+
+// MaxAge sets the Max-Age attribute in seconds
+func (s *SetCookie) MaxAge(seconds int) *SetCookie {
+	s.maxAge = seconds
+	s.hasMaxAge = true
+	return s
+}
+
+// Secure sets the Secure attribute
+func (s *SetCookie) Secure(secure bool) *SetCookie {
+	s.secure = secure
+	return s
+}
+
+// HttpOnly sets the HttpOnly attribute
+func (s *SetCookie) HttpOnly(httpOnly bool) *SetCookie {
+	s.httpOnly = httpOnly
+	return s
+}
+
+// SetSameSite sets the SameSite attribute
+func (s *SetCookie) SetSameSite(sameSite SameSite) *SetCookie {
+	s.sameSite = sameSite
+	return s
+}
+
+// Sign signs the cookie value with HMAC-SHA256 using the given key.
+// Build appends ".<hex signature>" to the value; read it back with
+// Cookies.GetSigned.
+func (s *SetCookie) Sign(key []byte) *SetCookie {
+	s.signKey = key
+	return s
+}
+
+// Build returns the Set-Cookie header value
+func (s *SetCookie) Build() string {
+	value := s.value
+	if s.signKey != nil {
+		value += "." + cookieSignature(s.signKey, s.name, s.value)
 	}
-	if cfg.ServiceName == "" {
-		cfg.ServiceName = "archimedes-service"
+	result := s.name + "=" + value
+
+	if s.path != "" {
+		result += "; Path=" + s.path
 	}
-	if cfg.ShutdownTimeout == 0 {
-		cfg.ShutdownTimeout = 30
+	if s.domain != "" {
+		result += "; Domain=" + s.domain
+	}
+	if s.expires != "" {
+		result += "; Expires=" + s.expires
+	}
+	if s.hasMaxAge {
+		result += fmt.Sprintf("; Max-Age=%d", s.maxAge)
+	}
+	if s.secure {
+		result += "; Secure"
+	}
+	if s.httpOnly {
+		result += "; HttpOnly"
+	}
+	result += "; SameSite=" + string(s.sameSite)
+
+	return result
+}
+
+// AddCookie adds a Set-Cookie response header.
+// Each call emits a separate Set-Cookie header, so multiple cookies can be
+// set in one response.
+func (c *Context) AddCookie(cookie *SetCookie) {
+	c.cookieHeaders = append(c.cookieHeaders, cookie.Build())
+}
+
+// SetCookie sets a Set-Cookie response header.
+// It is equivalent to AddCookie; prefer AddCookie for new code.
+func (c *Context) SetCookie(cookie *SetCookie) {
+	c.AddCookie(cookie)
+}
+
+// =============================================================================
+// Multipart Form Data
+// =============================================================================
+
+// MultipartField represents a field in multipart form data
+type MultipartField struct {
+	Name        string
+	Value       string
+	Filename    string
+	ContentType string
+	Data        []byte
+	IsFile      bool
+}
+
+// Multipart represents parsed multipart form data
+type Multipart struct {
+	Fields []MultipartField
+}
+
+// ParseMultipart parses multipart/form-data from the request body
+func (c *Context) ParseMultipart() (*Multipart, error) {
+	contentType := c.Headers["Content-Type"]
+	if contentType == "" {
+		contentType = c.Headers["content-type"]
+	}
+
+	if contentType == "" {
+		return nil, errors.New("missing Content-Type header")
+	}
+
+	// Extract boundary
+	boundary := ""
+	for _, part := range splitString(contentType, ';') {
+		part = trimSpace(part)
+		if hasPrefix(part, "boundary=") {
+			boundary = part[9:]
+			// Remove quotes if present
+			if len(boundary) >= 2 && boundary[0] == '"' && boundary[len(boundary)-1] == '"' {
+				boundary = boundary[1 : len(boundary)-1]
+			}
+			break
+		}
+	}
+
+	if boundary == "" {
+		return nil, errors.New("missing multipart boundary")
+	}
+
+	multipart := &Multipart{Fields: []MultipartField{}}
+	delimiter := "--" + boundary
+	bodyStr := string(c.body)
+
+	parts := splitString(bodyStr, '\n')
+	inPart := false
+	var currentField *MultipartField
+	var contentBuffer string
+	inHeaders := false
+
+	for _, line := range parts {
+		line = trimSuffix(line, "\r")
+
+		if hasPrefix(line, delimiter) {
+			// End previous part if any
+			if currentField != nil && inPart {
+				// Trim trailing CRLF from content
+				content := trimSuffix(contentBuffer, "\r\n")
+				content = trimSuffix(content, "\n")
+				if currentField.IsFile {
+					currentField.Data = []byte(content)
+				} else {
+					currentField.Value = content
+				}
+				multipart.Fields = append(multipart.Fields, *currentField)
+			}
+
+			if hasSuffix(line, "--") {
+				// End of multipart
+				break
+			}
+
+			// Start new part
+			currentField = &MultipartField{}
+			contentBuffer = ""
+			inPart = true
+			inHeaders = true
+			continue
+		}
+
+		if inPart {
+			if inHeaders {
+				if line == "" {
+					// End of headers, start of content
+					inHeaders = false
+					continue
+				}
+
+				// Parse headers
+				lowerLine := toLower(line)
+				if hasPrefix(lowerLine, "content-disposition:") {
+					// Parse name and filename
+					if name := extractHeaderParam(line, "name"); name != "" {
+						currentField.Name = name
+					}
+					if filename := extractHeaderParam(line, "filename"); filename != "" {
+						currentField.Filename = filename
+						currentField.IsFile = true
+					}
+				} else if hasPrefix(lowerLine, "content-type:") {
+					currentField.ContentType = trimSpace(line[13:])
+				}
+			} else {
+				// Content
+				if contentBuffer != "" {
+					contentBuffer += "\n"
+				}
+				contentBuffer += line
+			}
+		}
+	}
+
+	return multipart, nil
+}
+
+// Get returns a field by name
+func (m *Multipart) Get(name string) *MultipartField {
+	for i := range m.Fields {
+		if m.Fields[i].Name == name {
+			return &m.Fields[i]
+		}
+	}
+	return nil
+}
+
+// GetFile returns a file field by name
+func (m *Multipart) GetFile(name string) *MultipartField {
+	for i := range m.Fields {
+		if m.Fields[i].Name == name && m.Fields[i].IsFile {
+			return &m.Fields[i]
+		}
 	}
-	if cfg.MaxBodySize == 0 {
-		cfg.MaxBodySize = 1024 * 1024 // 1MB
+	return nil
+}
+
+// GetValue returns a text field value by name
+func (m *Multipart) GetValue(name string) string {
+	field := m.Get(name)
+	if field != nil && !field.IsFile {
+		return field.Value
 	}
-	if cfg.RequestTimeout == 0 {
-		cfg.RequestTimeout = 30
+	return ""
+}
+
+// =============================================================================
+// File Response
+// =============================================================================
+
+// File sends a file as a response with appropriate headers. A Range
+// request header is honored as in ServeContent.
+func (c *Context) File(filename string, data []byte, inline bool) error {
+	disposition := "attachment"
+	if inline {
+		disposition = "inline"
 	}
+	c.SetHeader("Content-Disposition", fmt.Sprintf(`%s; filename="%s"`, disposition, filename))
 
-	// Convert to C config
-	cConfig := C.struct_archimedes_config{
-		listen_port:                C.uint16_t(cfg.Port),
-		metrics_port:               C.uint16_t(cfg.MetricsPort),
-		enable_validation:          C.bool(cfg.EnableValidation),
-		enable_response_validation: C.bool(cfg.EnableResponseValidation),
-		enable_authorization:       C.bool(cfg.EnableAuthorization),
-		enable_tracing:             C.bool(cfg.EnableTracing),
-		shutdown_timeout_secs:      C.uint32_t(cfg.ShutdownTimeout),
-		max_body_size:              C.size_t(cfg.MaxBodySize),
-		request_timeout_secs:       C.uint32_t(cfg.RequestTimeout),
+	return c.serveBytes(guessMimeType(filename), data)
+}
+
+// httpTimeFormat is the time format of HTTP date headers
+const httpTimeFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+// ServeContent sends data as the response, modeled on http.ServeContent.
+// The Content-Type is guessed from name, and Last-Modified is set from
+// modTime unless it is zero.
+//
+// A single "bytes=" range in the Range request header is answered with
+// 206 Partial Content and only the requested bytes, so media players can
+// seek and downloads can resume. An unsatisfiable range gets 416 Range Not
+// Satisfiable. Full responses advertise Accept-Ranges: bytes.
+func (c *Context) ServeContent(name string, modTime time.Time, data []byte) error {
+	if !modTime.IsZero() {
+		c.SetHeader("Last-Modified", modTime.UTC().Format(httpTimeFormat))
 	}
+	return c.serveBytes(guessMimeType(name), data)
+}
 
-	// Set string fields
-	if cfg.Contract != "" {
-		cContract := C.CString(cfg.Contract)
-		defer C.free(unsafe.Pointer(cContract))
-		cConfig.contract_path = cContract
+// serveBytes sends data, or the part of it selected by the Range request
+// header
+func (c *Context) serveBytes(contentType string, data []byte) error {
+	start, end, err := c.byteRange(int64(len(data)))
+	if err != nil {
+		return c.rangeNotSatisfiable(int64(len(data)))
 	}
-	if cfg.PolicyBundle != "" {
-		cBundle := C.CString(cfg.PolicyBundle)
-		defer C.free(unsafe.Pointer(cBundle))
-		cConfig.policy_bundle_path = cBundle
+	status := c.setRangeHeaders(start, end, int64(len(data)))
+	return c.Blob(status, contentType, data[start:end])
+}
+
+// byteRange returns the half-open byte range [start, end) of a resource of
+// the given size selected by the Range request header. Without a Range
+// header, or with one that is not a single "bytes=" range, the whole
+// resource is selected. An error means the range is unsatisfiable.
+func (c *Context) byteRange(size int64) (start, end int64, err error) {
+	header := c.requestHeader("Range")
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return 0, size, nil
 	}
-	if cfg.ListenAddr != "" {
-		cAddr := C.CString(cfg.ListenAddr)
-		defer C.free(unsafe.Pointer(cAddr))
-		cConfig.listen_addr = cAddr
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return 0, size, nil
 	}
-	if cfg.OTLPEndpoint != "" {
-		cEndpoint := C.CString(cfg.OTLPEndpoint)
-		defer C.free(unsafe.Pointer(cEndpoint))
-		cConfig.otlp_endpoint = cEndpoint
+
+	unsatisfiable := &Error{Code: ErrValidationError, Message: fmt.Sprintf("range %s not satisfiable", header)}
+	if first == "" {
+		// Suffix range: the last n bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 || size == 0 {
+			return 0, 0, unsatisfiable
+		}
+		return max(size-n, 0), size, nil
 	}
-	if cfg.ServiceName != "" {
-		cName := C.CString(cfg.ServiceName)
-		defer C.free(unsafe.Pointer(cName))
-		cConfig.service_name = cName
+	start, err = strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, unsatisfiable
 	}
-
-	// Create application
-	handle := C.archimedes_new(&cConfig)
-	if handle == nil {
-		errMsg := C.GoString(C.archimedes_last_error())
-		return nil, &Error{Code: ErrInvalidConfig, Message: errMsg}
+	end = size
+	if last != "" {
+		lastByte, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || lastByte < start {
+			return 0, 0, unsatisfiable
+		}
+		end = min(lastByte+1, size)
 	}
+	return start, end, nil
+}
 
-	app := &App{
-		handle:    handle,
-		config:    cfg,
-		handlers:  make(map[string]Handler),
-		lifecycle: NewLifecycle(),
+// setRangeHeaders sets Accept-Ranges, Content-Length and, for a partial
+// range, Content-Range, returning 206 for a partial range and 200 otherwise
+func (c *Context) setRangeHeaders(start, end, size int64) int {
+	c.SetHeader("Accept-Ranges", "bytes")
+	c.SetHeader("Content-Length", strconv.FormatInt(end-start, 10))
+	if start == 0 && end == size {
+		return 200
 	}
-
-	// Prevent GC of app while handle is alive
-	runtime.SetFinalizer(app, func(a *App) {
-		a.Close()
-	})
-
-	return app, nil
+	c.SetHeader("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end-1, size))
+	return 206
 }
 
-// Operation registers a handler for an operation
-func (a *App) Operation(operationID string, handler Handler) error {
-	a.mu.Lock()
-	defer a.mu.Unlock()
-
-	// Store handler
-	a.handlers[operationID] = handler
+// rangeNotSatisfiable sends 416 Range Not Satisfiable for a resource of the
+// given size
+func (c *Context) rangeNotSatisfiable(size int64) error {
+	c.SetHeader("Content-Range", fmt.Sprintf("bytes */%d", size))
+	return c.Blob(416, "text/plain", nil)
+}
 
-	// Register in global registry for callbacks
-	handlerRegistryMu.Lock()
-	id := nextHandlerID
-	nextHandlerID++
-	handlerRegistry[id] = handler
-	handlerRegistryMu.Unlock()
+// Attachment sends a file as a download
+func (c *Context) Attachment(filename string, data []byte) error {
+	return c.File(filename, data, false)
+}
 
-	// Register with C API
-	cOpID := C.CString(operationID)
-	defer C.free(unsafe.Pointer(cOpID))
+// Inline sends a file for inline display (e.g., in browser)
+func (c *Context) Inline(filename string, data []byte) error {
+	return c.File(filename, data, true)
+}
 
-	err := C.archimedes_register_handler(
-		a.handle,
-		cOpID,
-		(C.archimedes_handler_fn)(C.go_handler_callback),
-		unsafe.Pointer(id),
-	)
+// SendFile streams the file at path, relative to Config.FileRoot, as the
+// response, without reading it into memory first. The Content-Type is
+// guessed from the file extension, and a Range request header is honored
+// as in ServeContent.
+//
+// The response carries a weak ETag computed from the file size and
+// modification time, and conditional requests for an unchanged file get
+// 304 Not Modified (see CheckNotModified).
+//
+// A path that is absolute, contains ".." elements, or leads out of the
+// root through a symlink is rejected with ErrValidationError, so a path
+// built from user input cannot escape the root. A missing file or a
+// directory gets 404 Not Found.
+func (c *Context) SendFile(path string, inline bool) error {
+	resolved, err := c.resolveFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c.Error(404, "NOT_FOUND", "File not found")
+	}
+	if err != nil {
+		return err
+	}
 
-	if err != C.ARCHIMEDES_ERROR_OK {
-		errMsg := C.GoString(C.archimedes_last_error())
-		return &Error{Code: int(err), Message: errMsg}
+	f, err := os.Open(resolved)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return c.Error(404, "NOT_FOUND", "File not found")
+	}
+	if c.CheckNotModified(fileETag(info), info.ModTime()) {
+		return nil
 	}
 
-	return nil
-}
+	filename := filepath.Base(path)
+	disposition := "attachment"
+	if inline {
+		disposition = "inline"
+	}
+	c.SetHeader("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": filename}))
+	return c.streamFile(f, info, guessMimeType(filename))
+}
+
+// resolveFile resolves a SendFile path to a file inside Config.FileRoot,
+// following symlinks. A missing file yields an error matching
+// fs.ErrNotExist.
+func (c *Context) resolveFile(path string) (string, error) {
+	invalid := &Error{Code: ErrValidationError, Message: fmt.Sprintf("invalid file path: %s", path)}
+	path = filepath.FromSlash(strings.ReplaceAll(path, "\\", "/"))
+	if !filepath.IsLocal(path) {
+		return "", invalid
+	}
 
-// Run starts the server and blocks until shutdown
-func (a *App) Run(addr string) error {
-	// Parse port from addr if provided (e.g., ":8080")
-	// For now, use configured port
-	err := C.archimedes_run(a.handle)
-	if err != C.ARCHIMEDES_ERROR_OK {
-		errMsg := C.GoString(C.archimedes_last_error())
-		return &Error{Code: int(err), Message: errMsg}
+	root := "."
+	if c.app != nil && c.app.config.FileRoot != "" {
+		root = c.app.config.FileRoot
 	}
-	return nil
+	root, err := filepath.Abs(root)
+	if err == nil {
+		root, err = filepath.EvalSymlinks(root)
+	}
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.Join(root, path))
+	if err != nil {
+		return "", err
+	}
+	if rel, err := filepath.Rel(root, resolved); err != nil || !filepath.IsLocal(rel) {
+		return "", invalid
+	}
+	return resolved, nil
 }
 
-// Stop gracefully stops the server
-func (a *App) Stop() error {
-	err := C.archimedes_stop(a.handle)
-	if err != C.ARCHIMEDES_ERROR_OK {
-		errMsg := C.GoString(C.archimedes_last_error())
-		return &Error{Code: int(err), Message: errMsg}
+// streamFile streams the open file f as the response with the given
+// Content-Type, setting ETag and Last-Modified from info and honoring a
+// Range request header
+func (c *Context) streamFile(f *os.File, info fs.FileInfo, contentType string) error {
+	c.SetETag(fileETag(info))
+	c.SetHeader("Last-Modified", info.ModTime().UTC().Format(httpTimeFormat))
+
+	start, end, err := c.byteRange(info.Size())
+	if err != nil {
+		return c.rangeNotSatisfiable(info.Size())
 	}
-	return nil
-}
+	if _, err := f.Seek(start, io.SeekStart); err != nil {
+		return err
+	}
+	status := c.setRangeHeaders(start, end, info.Size())
 
-// IsRunning returns true if the server is running
-func (a *App) IsRunning() bool {
-	return C.archimedes_is_running(a.handle) != 0
+	return c.Stream(status, contentType, func(w io.Writer) error {
+		_, err := io.CopyN(w, f, end-start)
+		return err
+	})
 }
 
-// Close frees the application resources
-func (a *App) Close() {
-	if a.handle != nil {
-		C.archimedes_free(a.handle)
-		a.handle = nil
+// =============================================================================
+// Streaming Responses
+// =============================================================================
+
+// streamChunkSize is the number of bytes buffered before a chunk is handed
+// to the transport, to avoid a CGO crossing per small write
+const streamChunkSize = 32 * 1024
+
+// StreamWriter is the io.Writer passed to Stream callbacks.
+// Writes are batched into chunks of up to 32KB; call Flush to send buffered
+// data immediately.
+//
+// Once the client disconnects or the request timeout passes, every Write
+// and Flush returns an error, so producers should stop on the first error.
+type StreamWriter struct {
+	ctx      *Context
+	buf      []byte
+	err      error
+	timeout  time.Duration
+	deadline time.Time
+}
+
+// Write buffers p, sending a chunk once the buffer is full
+func (w *StreamWriter) Write(p []byte) (int, error) {
+	if err := w.checkDeadline(); err != nil {
+		return 0, err
+	}
+	w.buf = append(w.buf, p...)
+	if len(w.buf) >= streamChunkSize {
+		if err := w.Flush(); err != nil {
+			return 0, err
+		}
 	}
+	return len(p), nil
 }
 
-// Version returns the Archimedes version string
-func Version() string {
-	return C.GoString(C.archimedes_version())
+// Flush sends any buffered data as a chunk
+func (w *StreamWriter) Flush() error {
+	if err := w.checkDeadline(); err != nil {
+		return err
+	}
+	if len(w.buf) == 0 {
+		return nil
+	}
+	w.err = w.ctx.writeChunk(w.buf)
+	w.buf = w.buf[:0]
+	return w.err
+}
+
+// checkDeadline returns the writer's error, failing the writer once the
+// request timeout has passed
+func (w *StreamWriter) checkDeadline() error {
+	if w.err == nil && !w.deadline.IsZero() && time.Now().After(w.deadline) {
+		w.err = &Error{
+			Code:    ErrHandlerError,
+			Message: fmt.Sprintf("request timeout of %s exceeded while streaming", w.timeout),
+		}
+	}
+	return w.err
 }
 
-// =============================================================================
-// Router
-// =============================================================================
+// Stream sends a response produced incrementally by fn using chunked
+// transfer encoding. fn receives a writer whose writes are batched and
+// flushed as chunks. Returns the first error from fn or from writing.
+//
+// When the transport has no streaming sink attached, chunks are collected
+// and sent as a single buffered body.
+func (c *Context) Stream(status int, contentType string, fn func(w io.Writer) error) error {
+	c.beginStream(status, contentType)
+	err := fn(c.stream)
+	flushErr := c.stream.Flush()
+	if err != nil {
+		return err
+	}
+	return flushErr
+}
 
-// Router is a sub-router for grouping operations with shared configuration
-type Router struct {
-	prefix     string
-	tags       []string
-	operations map[string]Handler
+// beginStream discards any buffered body and starts a streamed response
+func (c *Context) beginStream(status int, contentType string) {
+	c.responseStatus = status
+	c.responseBody = nil
+	c.contentType = contentType
+	c.streaming = true
+	c.stream = c.newStreamWriter()
 }
 
-// NewRouter creates a new router
-func NewRouter() *Router {
-	return &Router{
-		tags:       []string{},
-		operations: make(map[string]Handler),
+// newStreamWriter creates a writer bounded by the request timeout,
+// measured from when the request was received
+func (c *Context) newStreamWriter() *StreamWriter {
+	w := &StreamWriter{ctx: c, buf: make([]byte, 0, streamChunkSize)}
+	if c.app != nil {
+		w.timeout = c.app.operationConfig(c.OperationID).Timeout
+	}
+	if w.timeout > 0 {
+		start := c.ReceivedAt
+		if start.IsZero() {
+			start = time.Now()
+		}
+		w.deadline = start.Add(w.timeout)
 	}
+	return w
 }
 
-// Prefix sets the path prefix for all operations in this router
-func (r *Router) Prefix(prefix string) *Router {
-	// Normalize prefix
-	if prefix != "" && prefix[0] != '/' {
-		prefix = "/" + prefix
+// Write appends p to the response body, making Context usable as an
+// io.Writer. Set the status with Status and the headers before writing.
+//
+// When Config.ResponseBufferLimit is set and the buffered body grows past
+// it, the response switches to streaming: the buffered bytes are sent as the
+// first chunk and later writes are batched and sent as further chunks.
+func (c *Context) Write(p []byte) (int, error) {
+	if c.streaming {
+		if c.stream == nil {
+			c.stream = c.newStreamWriter()
+		}
+		return c.stream.Write(p)
 	}
-	if len(prefix) > 1 && prefix[len(prefix)-1] == '/' {
-		prefix = prefix[:len(prefix)-1]
+
+	c.responseBody = append(c.responseBody, p...)
+	if limit := c.responseBufferLimit(); limit > 0 && len(c.responseBody) > limit {
+		if err := c.startStreaming(); err != nil {
+			return 0, err
+		}
 	}
-	r.prefix = prefix
-	return r
+	return len(p), nil
 }
 
-// Tag adds a tag to this router for grouping
-func (r *Router) Tag(tag string) *Router {
-	// Don't add duplicates
-	for _, t := range r.tags {
-		if t == tag {
-			return r
+// Heartbeat keeps a streamed response alive during a long poll by sending a
+// keep-alive every interval until stop is closed or the stream fails, e.g.
+// because the client disconnected or the request timed out. It blocks, so
+// run the work being waited on in another goroutine and close stop when
+// it completes:
+//
+//	done := make(chan struct{})
+//	go func() { result = waitForUpdate(); close(done) }()
+//	ctx.Heartbeat(15*time.Second, done)
+//
+// Heartbeat requires the streaming response mode (Stream, SSE, or a Write
+// past Config.ResponseBufferLimit). SSE streams receive a comment line;
+// other streams receive a single space, which JSON parsers ignore. Before
+// streaming has started, Heartbeat only waits for stop.
+func (c *Context) Heartbeat(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		if !c.streaming {
+			continue
+		}
+		keepAlive := []byte(" ")
+		if parseMediaType(c.contentType) == "text/event-stream" {
+			keepAlive = []byte(": keep-alive\n\n")
+		}
+		if _, err := c.Write(keepAlive); err != nil {
+			return
+		}
+		if err := c.stream.Flush(); err != nil {
+			return
 		}
 	}
-	r.tags = append(r.tags, tag)
-	return r
 }
 
-// Operation registers a handler for an operation on this router
-func (r *Router) Operation(operationID string, handler Handler) *Router {
-	r.operations[operationID] = handler
-	return r
+// Status sets the response status code for responses written with Write
+func (c *Context) Status(status int) {
+	c.responseStatus = status
 }
 
-// GetPrefix returns the current prefix
-func (r *Router) GetPrefix() string {
-	return r.prefix
+// responseBufferLimit returns the configured buffer limit, or 0 for none
+func (c *Context) responseBufferLimit() int {
+	if c.app == nil {
+		return 0
+	}
+	return c.app.config.ResponseBufferLimit
 }
 
-// GetTags returns all tags
-func (r *Router) GetTags() []string {
-	return r.tags
+// startStreaming switches a buffered response to streaming, sending the
+// buffered body as the first chunk
+func (c *Context) startStreaming() error {
+	c.streaming = true
+	buffered := c.responseBody
+	c.responseBody = nil
+	return c.writeChunk(buffered)
 }
 
-// GetOperations returns all registered operations
-func (r *Router) GetOperations() map[string]Handler {
-	return r.operations
+// writeChunk hands a chunk to the transport, or collects it into the
+// response body when no streaming sink is attached
+func (c *Context) writeChunk(chunk []byte) error {
+	c.sentBytes += uint64(len(chunk))
+	if err := c.checkResponseSize(c.sentBytes); err != nil {
+		return err
+	}
+	if c.chunkSink != nil {
+		return c.chunkSink(chunk)
+	}
+	c.responseBody = append(c.responseBody, chunk...)
+	return nil
 }
 
-// Nest adds a child router under this router
-func (r *Router) Nest(child *Router) *Router {
-	// Copy operations from child with combined prefix
-	for opID, handler := range child.operations {
-		r.operations[opID] = handler
+// =============================================================================
+// HTML Templates
+// =============================================================================
+
+// HTML renders tpl with data and sends it as text/html. The template is
+// rendered into a buffer first, so a rendering error is returned and no
+// partial page is sent.
+func (c *Context) HTML(status int, tpl *template.Template, data any) error {
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, data); err != nil {
+		return fmt.Errorf("render template %s: %w", tpl.Name(), err)
 	}
-	return r
+	return c.Blob(status, "text/html; charset=utf-8", buf.Bytes())
 }
 
-// Merge copies all operations from another router
-func (r *Router) Merge(other *Router) *Router {
-	for opID, handler := range other.operations {
-		r.operations[opID] = handler
-	}
-	return r
+// HTMLString sends pre-rendered HTML as text/html
+func (c *Context) HTMLString(status int, html string) error {
+	return c.Blob(status, "text/html; charset=utf-8", []byte(html))
 }
 
-// Merge merges a router's operations into this app
-func (a *App) Merge(router *Router) error {
-	for opID, handler := range router.GetOperations() {
-		if err := a.Operation(opID, handler); err != nil {
-			return err
-		}
+// Render renders the named template from the app's template filesystem
+// (see App.SetTemplateFS) and sends it as text/html
+func (c *Context) Render(status int, name string, data any) error {
+	if c.app == nil {
+		return &Error{Code: ErrInvalidOperation, Message: "context is not attached to an app"}
 	}
-	return nil
+	tpl, err := c.app.template(name)
+	if err != nil {
+		return err
+	}
+	return c.HTML(status, tpl, data)
 }
 
-// Nest nests a router under a prefix in this app
-func (a *App) Nest(prefix string, router *Router) error {
-	// Set prefix on router if not already set
-	if router.GetPrefix() == "" {
-		router.Prefix(prefix)
+// SetTemplateFS sets the filesystem that Context.Render loads templates
+// from, e.g. an embed.FS or os.DirFS. Templates are parsed on first use and
+// cached; setting a new filesystem clears the cache.
+func (a *App) SetTemplateFS(fsys fs.FS) {
+	a.templatesMu.Lock()
+	defer a.templatesMu.Unlock()
+	a.templateFS = fsys
+	a.templates = make(map[string]*template.Template)
+}
+
+// template returns the named template, parsing it on first use
+func (a *App) template(name string) (*template.Template, error) {
+	a.templatesMu.Lock()
+	defer a.templatesMu.Unlock()
+
+	if a.templateFS == nil {
+		return nil, &Error{Code: ErrInvalidConfig, Message: "no template filesystem set"}
 	}
-	return a.Merge(router)
+	if tpl, ok := a.templates[name]; ok {
+		return tpl, nil
+	}
+	tpl, err := template.ParseFS(a.templateFS, name)
+	if err != nil {
+		return nil, fmt.Errorf("load template %s: %w", name, err)
+	}
+	a.templates[name] = tpl
+	return tpl, nil
 }
 
 // =============================================================================
-// Form Data Extractor
+// Localization
 // =============================================================================
 
-// Form parses URL-encoded form data from the request body
-type Form map[string]string
+// Locale describes how numbers, amounts and dates are written in a
+// language and region
+type Locale struct {
+	// Tag is the BCP 47 language tag, e.g. "en-US" or "de-DE"
+	Tag string
 
-// ParseForm parses the request body as URL-encoded form data
-func (c *Context) ParseForm() (Form, error) {
-	if len(c.body) == 0 {
-		return Form{}, nil
+	// DecimalSeparator and GroupSeparator separate the fraction and the
+	// groups of three integer digits, e.g. "." and "," for 1,234.5
+	DecimalSeparator string
+	GroupSeparator   string
+
+	// CurrencyFormat places a formatted amount into "{amount}" and the
+	// currency symbol or code into "{symbol}", e.g. "{symbol}{amount}"
+	CurrencyFormat string
+
+	// DateLayout is the time.Format layout for dates, e.g. "01/02/2006"
+	DateLayout string
+}
+
+// Predefined locales, ready to pass to App.RegisterLocale. LocaleEnUS is
+// the default of every app unless SetDefaultLocale picks another.
+var (
+	LocaleEnUS = Locale{Tag: "en-US", DecimalSeparator: ".", GroupSeparator: ",", CurrencyFormat: "{symbol}{amount}", DateLayout: "01/02/2006"}
+	LocaleEnGB = Locale{Tag: "en-GB", DecimalSeparator: ".", GroupSeparator: ",", CurrencyFormat: "{symbol}{amount}", DateLayout: "02/01/2006"}
+	LocaleDeDE = Locale{Tag: "de-DE", DecimalSeparator: ",", GroupSeparator: ".", CurrencyFormat: "{amount} {symbol}", DateLayout: "02.01.2006"}
+	LocaleFrFR = Locale{Tag: "fr-FR", DecimalSeparator: ",", GroupSeparator: "\u202f", CurrencyFormat: "{amount} {symbol}", DateLayout: "02/01/2006"}
+)
+
+// currencySymbols are the symbols FormatCurrency writes for common ISO
+// 4217 codes; other codes are written as is
+var currencySymbols = map[string]string{
+	"USD": "$",
+	"EUR": "€",
+	"GBP": "£",
+	"JPY": "¥",
+	"INR": "₹",
+}
+
+// zeroDecimalCurrencies are the currencies without minor units
+var zeroDecimalCurrencies = map[string]bool{"JPY": true, "KRW": true}
+
+// RegisterLocale makes locale available to Context.Localizer, replacing a
+// locale registered with the same tag. It returns ErrInvalidConfig unless
+// the tag and both separators are set; a missing currency format or date
+// layout falls back to the one of LocaleEnUS.
+func (a *App) RegisterLocale(locale Locale) error {
+	if locale.Tag == "" || locale.DecimalSeparator == "" || locale.GroupSeparator == "" {
+		return &Error{Code: ErrInvalidConfig, Message: "locale tag, decimal separator and group separator are required"}
+	}
+	if locale.CurrencyFormat == "" {
+		locale.CurrencyFormat = LocaleEnUS.CurrencyFormat
+	}
+	if locale.DateLayout == "" {
+		locale.DateLayout = LocaleEnUS.DateLayout
 	}
 
-	form := make(Form)
-	pairs := string(c.body)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.locales == nil {
+		a.locales = make(map[string]Locale)
+	}
+	a.locales[strings.ToLower(locale.Tag)] = locale
+	return nil
+}
 
-	for _, pair := range splitString(pairs, '&') {
-		if pair == "" {
-			continue
+// SetDefaultLocale sets the registered locale used when none of the
+// request's languages is registered (default: "en-US")
+func (a *App) SetDefaultLocale(tag string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.locales[strings.ToLower(tag)]; !ok && !strings.EqualFold(tag, LocaleEnUS.Tag) {
+		return &Error{Code: ErrInvalidConfig, Message: fmt.Sprintf("locale '%s' is not registered", tag)}
+	}
+	a.defaultLocale = tag
+	return nil
+}
+
+// locale returns the registered locale best matching the languages, most
+// preferred first: an exact tag, then a locale of the same base language,
+// then the default
+func (a *App) locale(languages []string) Locale {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	for _, language := range languages {
+		if locale, ok := a.locales[strings.ToLower(language)]; ok {
+			return locale
 		}
-		kv := splitString(pair, '=')
-		if len(kv) >= 1 {
-			key := urlDecode(kv[0])
-			value := ""
-			if len(kv) >= 2 {
-				value = urlDecode(kv[1])
+		base, _, _ := strings.Cut(strings.ToLower(language), "-")
+		for _, tag := range slices.Sorted(maps.Keys(a.locales)) {
+			if prefix, _, _ := strings.Cut(tag, "-"); prefix == base {
+				return a.locales[tag]
 			}
-			form[key] = value
 		}
 	}
+	if locale, ok := a.locales[strings.ToLower(a.defaultLocale)]; ok {
+		return locale
+	}
+	return LocaleEnUS
+}
 
-	return form, nil
+// Localizer formats numbers, amounts and dates for a locale, keeping
+// presentation details out of handlers
+type Localizer struct {
+	locale Locale
 }
 
-// Get returns a form field value by name
-func (f Form) Get(name string) string {
-	return f[name]
+// NewLocalizer creates a localizer for locale
+func NewLocalizer(locale Locale) *Localizer {
+	return &Localizer{locale: locale}
 }
 
-// GetOr returns a form field value or a default if not present
-func (f Form) GetOr(name, defaultValue string) string {
-	if val, ok := f[name]; ok {
-		return val
+// Localizer returns a localizer for the registered locale that best
+// matches the request's Accept-Language header (see AcceptsLanguages),
+// falling back to the app's default locale:
+//
+//	loc := ctx.Localizer()
+//	return ctx.String(200, "Total: "+loc.FormatCurrency(order.Total, "EUR"))
+func (c *Context) Localizer() *Localizer {
+	if c.app == nil {
+		return NewLocalizer(LocaleEnUS)
 	}
-	return defaultValue
+	return NewLocalizer(c.app.locale(c.AcceptsLanguages()))
 }
 
-// Has returns true if the form has a field with the given name
-func (f Form) Has(name string) bool {
-	_, ok := f[name]
-	return ok
+// Locale returns the locale the localizer formats for
+func (l *Localizer) Locale() Locale {
+	return l.locale
 }
 
-// =============================================================================
-// Cookie Extractor
-// =============================================================================
-
-// Cookies parses cookies from the Cookie header
-type Cookies map[string]string
+// FormatNumber formats v with the given number of decimals, grouping the
+// integer digits, e.g. "1,234.50" for en-US and "1.234,50" for de-DE
+func (l *Localizer) FormatNumber(v float64, decimals int) string {
+	digits := strconv.FormatFloat(math.Abs(v), 'f', max(decimals, 0), 64)
+	integer, fraction, _ := strings.Cut(digits, ".")
 
-// ParseCookies parses the Cookie header into a map
-func (c *Context) ParseCookies() Cookies {
-	cookies := make(Cookies)
-	cookieHeader := c.Headers["Cookie"]
-	if cookieHeader == "" {
-		cookieHeader = c.Headers["cookie"]
-	}
-	if cookieHeader == "" {
-		return cookies
+	var b strings.Builder
+	if v < 0 && strings.Trim(digits, "0.") != "" {
+		b.WriteByte('-')
 	}
-
-	for _, part := range splitString(cookieHeader, ';') {
-		part = trimSpace(part)
-		if part == "" {
-			continue
-		}
-		kv := splitString(part, '=')
-		if len(kv) >= 2 {
-			cookies[trimSpace(kv[0])] = trimSpace(kv[1])
+	for i, digit := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			b.WriteString(l.locale.GroupSeparator)
 		}
+		b.WriteRune(digit)
+	}
+	if fraction != "" {
+		b.WriteString(l.locale.DecimalSeparator)
+		b.WriteString(fraction)
 	}
+	return b.String()
+}
 
-	return cookies
+// FormatCurrency formats amount in the ISO 4217 currency, with the
+// currency's symbol where known, e.g. "$1,234.50" for en-US and
+// "1.234,50 €" for de-DE in EUR
+func (l *Localizer) FormatCurrency(amount float64, currency string) string {
+	currency = strings.ToUpper(currency)
+	decimals := 2
+	if zeroDecimalCurrencies[currency] {
+		decimals = 0
+	}
+	symbol, ok := currencySymbols[currency]
+	if !ok {
+		symbol = currency
+	}
+	return strings.NewReplacer("{amount}", l.FormatNumber(amount, decimals), "{symbol}", symbol).Replace(l.locale.CurrencyFormat)
 }
 
-// Get returns a cookie value by name
-func (c Cookies) Get(name string) string {
-	return c[name]
+// FormatDate formats the date of t with the locale's date layout, e.g.
+// "03/14/2026" for en-US and "14.03.2026" for de-DE
+func (l *Localizer) FormatDate(t time.Time) string {
+	return t.Format(l.locale.DateLayout)
 }
 
-// GetOr returns a cookie value or a default if not present
-func (c Cookies) GetOr(name, defaultValue string) string {
-	if val, ok := c[name]; ok {
-		return val
-	}
-	return defaultValue
+// =============================================================================
+// NDJSON
+// =============================================================================
+
+// NDJSON streams items as newline-delimited JSON, one object per line
+func (c *Context) NDJSON(status int, items []any) error {
+	return c.NDJSONStream(status, func(enc *json.Encoder) error {
+		for _, item := range items {
+			if err := enc.Encode(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
-// Has returns true if the cookie exists
-func (c Cookies) Has(name string) bool {
-	_, ok := c[name]
-	return ok
+// NDJSONStream streams newline-delimited JSON produced by fn. Each call to
+// enc.Encode writes one object followed by a newline.
+func (c *Context) NDJSONStream(status int, fn func(enc *json.Encoder) error) error {
+	return c.Stream(status, "application/x-ndjson", func(w io.Writer) error {
+		return fn(json.NewEncoder(w))
+	})
 }
 
 // =============================================================================
-// Set-Cookie Builder
+// Server-Sent Events
 // =============================================================================
 
-// SameSite represents the SameSite cookie attribute
-type SameSite string
+// SSEEvent is a single Server-Sent Event
+type SSEEvent struct {
+	// ID sets the client's last event ID (omitted if empty)
+	ID string
 
-const (
-	SameSiteNone   SameSite = "None"
-	SameSiteLax    SameSite = "Lax"
-	SameSiteStrict SameSite = "Strict"
-)
+	// Event is the event type (omitted if empty, meaning "message")
+	Event string
 
-// SetCookie builds Set-Cookie header values
-type SetCookie struct {
-	name     string
-	value    string
-	path     string
-	domain   string
-	expires  string
-	maxAge   int
-	secure   bool
-	httpOnly bool
-	sameSite SameSite
-	hasMaxAge bool
+	// Data is the event payload; multi-line data is sent as multiple data lines
+	Data string
+
+	// Retry is the client reconnection time in milliseconds (omitted if 0)
+	Retry int
 }
 
-// NewSetCookie creates a new Set-Cookie builder
-func NewSetCookie(name, value string) *SetCookie {
-	return &SetCookie{
-		name:     name,
-		value:    value,
-		sameSite: SameSiteLax,
+// SSEWriter writes Server-Sent Events to a streamed response
+type SSEWriter struct {
+	stream *StreamWriter
+}
+
+// SSE starts a Server-Sent Events response with the given status. It sets
+// the Content-Type, Cache-Control and Connection headers, so any other
+// headers must be set before calling SSE.
+func (c *Context) SSE(status int) (*SSEWriter, error) {
+	if c.streaming {
+		return nil, &Error{Code: ErrInternal, Message: "response is already streaming"}
 	}
+	c.SetHeader("Cache-Control", "no-cache")
+	c.SetHeader("Connection", "keep-alive")
+	c.beginStream(status, "text/event-stream")
+	return &SSEWriter{stream: c.stream}, nil
 }
 
-// Path sets the Path attribute
-func (s *SetCookie) Path(path string) *SetCookie {
-	s.path = path
-	return s
+// Send writes an event and flushes it to the client
+func (w *SSEWriter) Send(event SSEEvent) error {
+	var b strings.Builder
+	if event.ID != "" {
+		writeSSEField(&b, "id", event.ID)
+	}
+	if event.Event != "" {
+		writeSSEField(&b, "event", event.Event)
+	}
+	if event.Retry > 0 {
+		writeSSEField(&b, "retry", fmt.Sprintf("%d", event.Retry))
+	}
+	for _, line := range strings.Split(event.Data, "\n") {
+		writeSSEField(&b, "data", line)
+	}
+	b.WriteString("\n")
+	return w.write(b.String())
+}
+
+// SendComment writes a comment line, which clients ignore. Comments are
+// useful as keep-alives through proxies that close idle connections.
+func (w *SSEWriter) SendComment(comment string) error {
+	var b strings.Builder
+	for _, line := range strings.Split(comment, "\n") {
+		b.WriteString(": ")
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+	return w.write(b.String())
 }
 
-// Domain sets the Domain attribute
-func (s *SetCookie) Domain(domain string) *SetCookie {
-	s.domain = domain
-	return s
+// write writes a formatted event and flushes it
+func (w *SSEWriter) write(s string) error {
+	if _, err := io.WriteString(w.stream, s); err != nil {
+		return err
+	}
+	return w.stream.Flush()
 }
 
-// Expires sets the Expires attribute (RFC 7231 format)
-func (s *SetCookie) Expires(expires string) *SetCookie {
-	s.expires = expires
-	return s
+// SSEStream is a Server-Sent Events stream with a simple event/data API,
+// opened with Context.SSEStream
+type SSEStream struct {
+	writer *SSEWriter
+	closed bool
 }
 
-// MaxAge sets the Max-Age attribute in seconds
-func (s *SetCookie) MaxAge(seconds int) *SetCookie {
-	s.maxAge = seconds
-	s.hasMaxAge = true
-	return s
+// SSEStream starts a 200 Server-Sent Events response and returns a stream
+// for sending events. It sets the same headers as SSE.
+func (c *Context) SSEStream() (*SSEStream, error) {
+	w, err := c.SSE(200)
+	if err != nil {
+		return nil, err
+	}
+	return &SSEStream{writer: w}, nil
 }
 
-// Secure sets the Secure attribute
-func (s *SetCookie) Secure(secure bool) *SetCookie {
-	s.secure = secure
-	return s
+// Send sends an event of the given type (empty for "message") and flushes
+// it to the client. Returns an error if the stream is closed or the client
+// has disconnected, so producers should stop on the first error.
+func (s *SSEStream) Send(event, data string) error {
+	if s.closed {
+		return &Error{Code: ErrHandlerError, Message: "sse stream is closed"}
+	}
+	return s.writer.Send(SSEEvent{Event: event, Data: data})
 }
 
-// HttpOnly sets the HttpOnly attribute
-func (s *SetCookie) HttpOnly(httpOnly bool) *SetCookie {
-	s.httpOnly = httpOnly
-	return s
+// Close ends the stream, flushing anything still buffered. Later calls to
+// Send fail.
+func (s *SSEStream) Close() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.writer.stream.Flush()
 }
 
-// SetSameSite sets the SameSite attribute
-func (s *SetCookie) SetSameSite(sameSite SameSite) *SetCookie {
-	s.sameSite = sameSite
-	return s
+// writeSSEField writes a single "name: value" line, stripping carriage
+// returns that would otherwise end the line early
+func writeSSEField(b *strings.Builder, name, value string) {
+	b.WriteString(name)
+	b.WriteString(": ")
+	b.WriteString(strings.ReplaceAll(value, "\r", ""))
+	b.WriteString("\n")
 }
 
-// Build returns the Set-Cookie header value
-func (s *SetCookie) Build() string {
-	result := s.name + "=" + s.value
+// =============================================================================
+// ETag / Conditional GET
+// =============================================================================
 
-	if s.path != "" {
-		result += "; Path=" + s.path
-	}
-	if s.domain != "" {
-		result += "; Domain=" + s.domain
+// ComputeETag returns a strong ETag for data using the FNV-1a hash.
+// Prefix the result with "W/" for a weak ETag.
+func ComputeETag(data []byte) string {
+	h := fnv.New64a()
+	h.Write(data)
+	return fmt.Sprintf(`"%016x"`, h.Sum64())
+}
+
+// FileWithETag sends a file like File, but responds with 304 Not Modified
+// when the request's If-None-Match header matches etag. If etag is empty it
+// is computed from data with ComputeETag.
+func (c *Context) FileWithETag(filename string, data []byte, etag string) error {
+	if etag == "" {
+		etag = ComputeETag(data)
 	}
-	if s.expires != "" {
-		result += "; Expires=" + s.expires
+	if c.notModified(etag) {
+		return nil
 	}
-	if s.hasMaxAge {
-		result += fmt.Sprintf("; Max-Age=%d", s.maxAge)
+	c.SetHeader("ETag", etag)
+	return c.File(filename, data, false)
+}
+
+// JSONWithETag sends a JSON response like JSON, but responds with 304 Not
+// Modified when the request's If-None-Match header matches etag. If etag is
+// empty it is computed from the serialized body with ComputeETag.
+//
+// JSON serialization is not guaranteed to be byte-for-byte stable, so weak
+// ETags (W/"...") are appropriate for JSON responses.
+func (c *Context) JSONWithETag(status int, v any, etag string) error {
+	data, err := c.marshalJSON(v)
+	if err != nil {
+		return err
 	}
-	if s.secure {
-		result += "; Secure"
+	if etag == "" {
+		etag = "W/" + ComputeETag(data)
 	}
-	if s.httpOnly {
-		result += "; HttpOnly"
+	if c.notModified(etag) {
+		return nil
 	}
-	result += "; SameSite=" + string(s.sameSite)
-
-	return result
+	c.SetHeader("ETag", etag)
+	return c.Blob(status, "application/json", data)
 }
 
-// SetCookie sets a Set-Cookie response header
-func (c *Context) SetCookie(cookie *SetCookie) {
-	c.SetHeader("Set-Cookie", cookie.Build())
+// notModified sends a 304 Not Modified response and returns true if the
+// request's If-None-Match header matches etag
+func (c *Context) notModified(etag string) bool {
+	return c.CheckNotModified(etag, time.Time{})
 }
 
-// =============================================================================
-// Multipart Form Data
-// =============================================================================
-
-// MultipartField represents a field in multipart form data
-type MultipartField struct {
-	Name        string
-	Value       string
-	Filename    string
-	ContentType string
-	Data        []byte
-	IsFile      bool
+// SetETag sets the ETag response header, quoting tag if it is not already
+// a quoted (or W/-prefixed weak) entity tag
+func (c *Context) SetETag(tag string) {
+	if !strings.HasPrefix(tag, `"`) && !strings.HasPrefix(tag, `W/"`) {
+		tag = `"` + tag + `"`
+	}
+	c.SetHeader("ETag", tag)
 }
 
-// Multipart represents parsed multipart form data
-type Multipart struct {
-	Fields []MultipartField
-}
+// CheckNotModified evaluates the request's conditional headers against the
+// current etag and modification time of the resource. If the client's copy
+// is current, it sends 304 Not Modified with an empty body and returns
+// true, so the handler can return early:
+//
+//	if ctx.CheckNotModified(etag, info.ModTime()) {
+//	    return nil
+//	}
+//
+// If-None-Match takes precedence; If-Modified-Since is only consulted when
+// it is absent and modTime is not zero. Either argument may be empty.
+func (c *Context) CheckNotModified(etag string, modTime time.Time) bool {
+	if ifNoneMatch := c.requestHeader("If-None-Match"); ifNoneMatch != "" {
+		if etag == "" || !etagMatches(ifNoneMatch, etag) {
+			return false
+		}
+	} else {
+		since, err := time.Parse(httpTimeFormat, c.requestHeader("If-Modified-Since"))
+		if err != nil || modTime.IsZero() || modTime.Truncate(time.Second).After(since) {
+			return false
+		}
+	}
 
-// ParseMultipart parses multipart/form-data from the request body
-func (c *Context) ParseMultipart() (*Multipart, error) {
-	contentType := c.Headers["Content-Type"]
-	if contentType == "" {
-		contentType = c.Headers["content-type"]
+	c.responseStatus = 304
+	c.responseBody = nil
+	if etag != "" {
+		c.SetETag(etag)
 	}
-
-	if contentType == "" {
-		return nil, errors.New("missing Content-Type header")
+	if !modTime.IsZero() {
+		c.SetHeader("Last-Modified", modTime.UTC().Format(httpTimeFormat))
 	}
+	return true
+}
 
-	// Extract boundary
-	boundary := ""
-	for _, part := range splitString(contentType, ';') {
-		part = trimSpace(part)
-		if hasPrefix(part, "boundary=") {
-			boundary = part[9:]
-			// Remove quotes if present
-			if len(boundary) >= 2 && boundary[0] == '"' && boundary[len(boundary)-1] == '"' {
-				boundary = boundary[1 : len(boundary)-1]
-			}
-			break
+// fileETag returns a weak ETag for a file computed from its size and
+// modification time, which is cheap to compute without reading the file
+func fileETag(info fs.FileInfo) string {
+	return fmt.Sprintf(`W/"%x-%x"`, info.Size(), info.ModTime().UnixNano())
+}
+
+// etagMatches reports whether an If-None-Match header value matches etag
+// using weak comparison (RFC 7232 section 3.2)
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	if trimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range splitString(ifNoneMatch, ',') {
+		if strings.TrimPrefix(trimSpace(candidate), "W/") == etag {
+			return true
 		}
 	}
+	return false
+}
 
-	if boundary == "" {
-		return nil, errors.New("missing multipart boundary")
-	}
+// =============================================================================
+// Response Caching
+// =============================================================================
 
-	multipart := &Multipart{Fields: []MultipartField{}}
-	delimiter := "--" + boundary
-	bodyStr := string(c.body)
+// CachedResponse is a response stored by the Cache middleware
+type CachedResponse struct {
+	Status      int
+	ContentType string
+	Headers     map[string]string
+	Body        []byte
 
-	parts := splitString(bodyStr, '\n')
-	inPart := false
-	var currentField *MultipartField
-	var contentBuffer string
-	inHeaders := false
+	// StoredAt is when the response was stored, used for the Age header
+	StoredAt time.Time
+}
 
-	for _, line := range parts {
-		line = trimSuffix(line, "\r")
+// CacheStore holds the responses cached by the Cache middleware. Get
+// returns false for missing and expired entries. Implementations must be
+// safe for concurrent use.
+type CacheStore interface {
+	Get(key string) (CachedResponse, bool)
+	Set(key string, resp CachedResponse, ttl time.Duration)
+}
 
-		if hasPrefix(line, delimiter) {
-			// End previous part if any
-			if currentField != nil && inPart {
-				// Trim trailing CRLF from content
-				content := trimSuffix(contentBuffer, "\r\n")
-				content = trimSuffix(content, "\n")
-				if currentField.IsFile {
-					currentField.Data = []byte(content)
-				} else {
-					currentField.Value = content
-				}
-				multipart.Fields = append(multipart.Fields, *currentField)
-			}
+// CacheOptions configures the Cache middleware
+type CacheOptions struct {
+	// Store holds the cached responses (default: a new in-memory store)
+	Store CacheStore
 
-			if hasSuffix(line, "--") {
-				// End of multipart
-				break
-			}
+	// VaryHeaders are the request headers whose values select separate
+	// cache entries, e.g. "Accept-Language". They are added to the Vary
+	// response header.
+	VaryHeaders []string
 
-			// Start new part
-			currentField = &MultipartField{}
-			contentBuffer = ""
-			inPart = true
-			inHeaders = true
-			continue
-		}
+	// now returns the current time (time.Now when nil)
+	now func() time.Time
+}
 
-		if inPart {
-			if inHeaders {
-				if line == "" {
-					// End of headers, start of content
-					inHeaders = false
-					continue
-				}
+// Cache returns middleware that caches successful GET responses for ttl,
+// keyed by path, query and the CacheOptions.VaryHeaders, so read-heavy
+// operations skip the handler while the entry is fresh:
+//
+//	app.BindTagMiddleware("cached", archimedes.Cache(time.Minute, archimedes.CacheOptions{}))
+//
+// Responses carry X-Cache: HIT or MISS, and hits carry Age with the
+// entry's age in seconds. A request with Cache-Control: no-cache or
+// Pragma: no-cache skips the cache and refreshes the entry. Only 200
+// responses are stored; streamed responses, responses setting cookies and
+// responses marked Cache-Control: no-store or private are not.
+func Cache(ttl time.Duration, opts CacheOptions) MiddlewareFunc {
+	store := opts.Store
+	if store == nil {
+		store = NewMemoryCacheStore()
+	}
+	now := opts.now
+	if now == nil {
+		now = time.Now
+	}
 
-				// Parse headers
-				lowerLine := toLower(line)
-				if hasPrefix(lowerLine, "content-disposition:") {
-					// Parse name and filename
-					if name := extractHeaderParam(line, "name"); name != "" {
-						currentField.Name = name
-					}
-					if filename := extractHeaderParam(line, "filename"); filename != "" {
-						currentField.Filename = filename
-						currentField.IsFile = true
+	return func(next Handler) Handler {
+		return func(ctx *Context) error {
+			if ctx.Method != "GET" {
+				return next(ctx)
+			}
+			for _, name := range opts.VaryHeaders {
+				ctx.addVary(name)
+			}
+
+			key := cacheKey(ctx, opts.VaryHeaders)
+			if !requestsNoCache(ctx) {
+				if cached, ok := store.Get(key); ok {
+					for name, value := range cached.Headers {
+						ctx.SetHeader(name, value)
 					}
-				} else if hasPrefix(lowerLine, "content-type:") {
-					currentField.ContentType = trimSpace(line[13:])
-				}
-			} else {
-				// Content
-				if contentBuffer != "" {
-					contentBuffer += "\n"
+					ctx.SetHeader("Age", strconv.Itoa(int(now().Sub(cached.StoredAt).Seconds())))
+					ctx.SetHeader("X-Cache", "HIT")
+					ctx.responseStatus = cached.Status
+					ctx.contentType = cached.ContentType
+					ctx.responseBody = bytes.Clone(cached.Body)
+					return nil
 				}
-				contentBuffer += line
 			}
-		}
-	}
 
-	return multipart, nil
-}
+			// Only headers set by the handler are stored, not per-request
+			// ones such as CORS headers
+			before := maps.Clone(ctx.responseHeaders)
+			ctx.SetHeader("X-Cache", "MISS")
+			if err := next(ctx); err != nil {
+				return err
+			}
+			cacheControl := strings.ToLower(ctx.responseHeaders["Cache-Control"])
+			if ctx.streaming || ctx.responseStatus != 200 || len(ctx.cookieHeaders) > 0 ||
+				strings.Contains(cacheControl, "no-store") || strings.Contains(cacheControl, "private") {
+				return nil
+			}
 
-// Get returns a field by name
-func (m *Multipart) Get(name string) *MultipartField {
-	for i := range m.Fields {
-		if m.Fields[i].Name == name {
-			return &m.Fields[i]
+			headers := make(map[string]string)
+			for name, value := range ctx.responseHeaders {
+				if previous, ok := before[name]; name != "X-Cache" && (!ok || previous != value) {
+					headers[name] = value
+				}
+			}
+			store.Set(key, CachedResponse{
+				Status:      ctx.responseStatus,
+				ContentType: ctx.contentType,
+				Headers:     headers,
+				Body:        bytes.Clone(ctx.responseBody),
+				StoredAt:    now(),
+			}, ttl)
+			return nil
 		}
 	}
-	return nil
 }
 
-// GetFile returns a file field by name
-func (m *Multipart) GetFile(name string) *MultipartField {
-	for i := range m.Fields {
-		if m.Fields[i].Name == name && m.Fields[i].IsFile {
-			return &m.Fields[i]
-		}
+// cacheKey identifies the response to a request by its path, query and
+// the values of the vary headers
+func cacheKey(ctx *Context, varyHeaders []string) string {
+	var b strings.Builder
+	b.WriteString(ctx.Path)
+	if ctx.Query != "" {
+		b.WriteString("?" + ctx.Query)
 	}
-	return nil
+	for _, name := range varyHeaders {
+		b.WriteString("\n" + strings.ToLower(name) + ": " + ctx.requestHeader(name))
+	}
+	return b.String()
 }
 
-// GetValue returns a text field value by name
-func (m *Multipart) GetValue(name string) string {
-	field := m.Get(name)
-	if field != nil && !field.IsFile {
-		return field.Value
-	}
-	return ""
+// requestsNoCache reports whether the client asked to bypass caches
+func requestsNoCache(ctx *Context) bool {
+	cacheControl := strings.ToLower(ctx.requestHeader("Cache-Control"))
+	return strings.Contains(cacheControl, "no-cache") || strings.Contains(cacheControl, "no-store") ||
+		strings.EqualFold(ctx.requestHeader("Pragma"), "no-cache")
 }
 
-// =============================================================================
-// File Response
-// =============================================================================
+// MemoryCacheStore is an in-memory CacheStore. Expired entries are
+// dropped when they are next read.
+type MemoryCacheStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryCacheEntry
+	now     func() time.Time
+}
 
-// File sends a file as a response with appropriate headers
-func (c *Context) File(filename string, data []byte, inline bool) error {
-	c.responseStatus = 200
-	c.responseBody = data
-	c.contentType = guessMimeType(filename)
+// memoryCacheEntry is a cached response with its expiry
+type memoryCacheEntry struct {
+	resp    CachedResponse
+	expires time.Time
+}
 
-	disposition := "attachment"
-	if inline {
-		disposition = "inline"
+// NewMemoryCacheStore creates an empty in-memory cache store
+func NewMemoryCacheStore() *MemoryCacheStore {
+	return &MemoryCacheStore{
+		entries: make(map[string]memoryCacheEntry),
+		now:     time.Now,
 	}
-	c.SetHeader("Content-Disposition", fmt.Sprintf(`%s; filename="%s"`, disposition, filename))
-
-	return nil
 }
 
-// Attachment sends a file as a download
-func (c *Context) Attachment(filename string, data []byte) error {
-	return c.File(filename, data, false)
+// Get returns the response stored under key unless it has expired
+func (s *MemoryCacheStore) Get(key string) (CachedResponse, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[key]
+	if !ok {
+		return CachedResponse{}, false
+	}
+	if !s.now().Before(entry.expires) {
+		delete(s.entries, key)
+		return CachedResponse{}, false
+	}
+	return entry.resp, true
 }
 
-// Inline sends a file for inline display (e.g., in browser)
-func (c *Context) Inline(filename string, data []byte) error {
-	return c.File(filename, data, true)
+// Set stores resp under key for ttl
+func (s *MemoryCacheStore) Set(key string, resp CachedResponse, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = memoryCacheEntry{resp: resp, expires: s.now().Add(ttl)}
 }
 
 // =============================================================================
@@ -1252,68 +5918,510 @@ func guessMimeType(filename string) string {
 	}
 }
 
-// =============================================================================
-// Lifecycle Hooks
-// =============================================================================
-
-// LifecycleHook is a function that runs during startup or shutdown
-type LifecycleHook func() error
-
-// LifecycleEntry stores a hook with its name
-type LifecycleEntry struct {
-	Name string
-	Hook LifecycleHook
+// =============================================================================
+// Lifecycle Hooks
+// =============================================================================
+
+// LifecycleHook is a function that runs during startup or shutdown. Its
+// context is cancelled when the hook's deadline passes (e.g.
+// Config.ShutdownTimeout during shutdown) or the caller gives up on startup.
+type LifecycleHook func(ctx context.Context) error
+
+// LifecycleHookSimple is a lifecycle hook that does not take a context.
+// OnStartup, OnStartupParallel and OnShutdown wrap it into a LifecycleHook.
+type LifecycleHookSimple func() error
+
+// LifecycleHookCtx is a lifecycle hook that receives a context.
+//
+// Deprecated: LifecycleHook now receives a context; use it instead.
+type LifecycleHookCtx = LifecycleHook
+
+// LifecycleEntry stores a hook with its name
+type LifecycleEntry struct {
+	Name string
+	Hook LifecycleHook
+
+	// group is the ParallelGroup the hook belongs to (0 for none)
+	group int
+}
+
+// newLifecycleEntry creates an entry for a hook without a context
+func newLifecycleEntry(name string, hook LifecycleHookSimple) LifecycleEntry {
+	return LifecycleEntry{
+		Name: name,
+		Hook: func(context.Context) error {
+			return hook()
+		},
+	}
+}
+
+// run runs the hook, returning early with the context error if the context
+// is done before the hook returns. A hook that ignores cancellation keeps
+// running in the background but no longer blocks the caller.
+//
+// Hooks started after the context is done run to completion with the
+// cancelled context, giving them a chance to release resources quickly.
+func (e LifecycleEntry) run(ctx context.Context) error {
+	hook := e.Hook
+	if ctx.Done() == nil || ctx.Err() != nil {
+		return hook(ctx)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- hook(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// HookReport records how a lifecycle hook ran
+type HookReport struct {
+	Name     string
+	Duration time.Duration
+
+	// Err is the hook's error, or the context error if the hook was
+	// abandoned when its deadline passed
+	Err error
+}
+
+// Lifecycle manages startup and shutdown hooks
+type Lifecycle struct {
+	startupHooks  []LifecycleEntry
+	parallelHooks []LifecycleEntry
+	shutdownHooks []LifecycleEntry
+
+	// groups is the number of ParallelGroup calls so far
+	groups int
+
+	// dependencies maps a startup hook name to the names of the hooks it
+	// must run after, as recorded by DependsOn
+	dependencies map[string][]string
+
+	// logger receives hook start and finish logs (nil for none)
+	logger *slog.Logger
+
+	// reports of the last startup and shutdown runs
+	reportMu       sync.Mutex
+	startupReport  []HookReport
+	shutdownReport []HookReport
+}
+
+// NewLifecycle creates a new lifecycle manager
+func NewLifecycle() *Lifecycle {
+	return &Lifecycle{
+		startupHooks:  []LifecycleEntry{},
+		parallelHooks: []LifecycleEntry{},
+		shutdownHooks: []LifecycleEntry{},
+	}
+}
+
+// SetLogger sets the logger that receives the start, finish and duration
+// of each hook. Apps use Config.Logger.
+func (l *Lifecycle) SetLogger(logger *slog.Logger) {
+	l.logger = logger
+}
+
+// LastStartupReport returns a report for each startup hook that ran in the
+// most recent startup, in the order the hooks were registered
+func (l *Lifecycle) LastStartupReport() []HookReport {
+	l.reportMu.Lock()
+	defer l.reportMu.Unlock()
+	return append([]HookReport(nil), l.startupReport...)
+}
+
+// LastShutdownReport returns a report for each shutdown hook of the most
+// recent shutdown, in the order the hooks ran
+func (l *Lifecycle) LastShutdownReport() []HookReport {
+	l.reportMu.Lock()
+	defer l.reportMu.Unlock()
+	return append([]HookReport(nil), l.shutdownReport...)
+}
+
+// runHook runs entry, logging and timing it
+func (l *Lifecycle) runHook(ctx context.Context, phase string, entry LifecycleEntry) HookReport {
+	if l.logger != nil {
+		l.logger.Info("running "+phase+" hook", "hook", entry.Name)
+	}
+	start := time.Now()
+	err := entry.run(ctx)
+	report := HookReport{Name: entry.Name, Duration: time.Since(start), Err: err}
+	if l.logger != nil {
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			l.logger.Warn(phase+" hook timed out", "hook", entry.Name, "duration", report.Duration, "error", err)
+		case err != nil:
+			l.logger.Error(phase+" hook failed", "hook", entry.Name, "duration", report.Duration, "error", err)
+		default:
+			l.logger.Info(phase+" hook finished", "hook", entry.Name, "duration", report.Duration)
+		}
+	}
+	return report
+}
+
+// OnStartup registers a startup hook that does not take a context
+func (l *Lifecycle) OnStartup(name string, hook LifecycleHookSimple) {
+	l.startupHooks = append(l.startupHooks, newLifecycleEntry(name, hook))
+}
+
+// OnStartupCtx registers a startup hook that receives a context
+func (l *Lifecycle) OnStartupCtx(name string, hook LifecycleHook) {
+	l.startupHooks = append(l.startupHooks, LifecycleEntry{Name: name, Hook: hook})
+}
+
+// OnStartupParallel registers a startup hook that runs concurrently with the
+// other parallel hooks, after all ordered startup hooks have completed
+func (l *Lifecycle) OnStartupParallel(name string, hook LifecycleHookSimple) {
+	l.parallelHooks = append(l.parallelHooks, newLifecycleEntry(name, hook))
+}
+
+// ParallelGroup makes the named startup hooks, registered with OnStartup
+// or OnStartupCtx, run concurrently as a group, such as independent
+// connections to a database, a cache and object storage. The group runs at
+// the position of its earliest hook and completes before the next hook
+// starts, so hooks outside the group keep their order relative to it. The
+// errors of the group's hooks are returned together in an *ErrorGroup.
+//
+// An unknown name or a hook already in a group is an ErrInvalidOperation.
+func (l *Lifecycle) ParallelGroup(names ...string) error {
+	indexes := make([]int, 0, len(names))
+	for _, name := range names {
+		i := slices.IndexFunc(l.startupHooks, func(e LifecycleEntry) bool { return e.Name == name })
+		switch {
+		case i < 0:
+			return &Error{Code: ErrInvalidOperation, Message: fmt.Sprintf("unknown startup hook '%s'", name)}
+		case l.startupHooks[i].group != 0 || slices.Contains(indexes, i):
+			return &Error{Code: ErrInvalidOperation, Message: fmt.Sprintf("startup hook '%s' is already in a parallel group", name)}
+		}
+		indexes = append(indexes, i)
+	}
+
+	l.groups++
+	for _, i := range indexes {
+		l.startupHooks[i].group = l.groups
+	}
+	return nil
+}
+
+// DependsOn records that the startup hook hookName must run after the
+// startup hook dependsOn, so hooks registered in any order, e.g. by
+// independent modules, still start in a valid order. Startup runs the
+// hooks in topological order, keeping registration order where no
+// dependency applies. A ParallelGroup is ordered as a whole.
+//
+// The hooks need not be registered yet, but must be registered with
+// OnStartup or OnStartupCtx by the time startup runs. A dependency that
+// would create a cycle is rejected with ErrInvalidOperation.
+func (l *Lifecycle) DependsOn(hookName, dependsOn string) error {
+	if hookName == dependsOn || l.dependsOnPath(dependsOn, hookName, make(map[string]bool)) {
+		return &Error{
+			Code:    ErrInvalidOperation,
+			Message: fmt.Sprintf("startup hook '%s' depending on '%s' would create a cycle", hookName, dependsOn),
+		}
+	}
+	if l.dependencies == nil {
+		l.dependencies = make(map[string][]string)
+	}
+	if !slices.Contains(l.dependencies[hookName], dependsOn) {
+		l.dependencies[hookName] = append(l.dependencies[hookName], dependsOn)
+	}
+	return nil
+}
+
+// dependsOnPath reports whether the startup hook from depends on the hook
+// to, directly or through other hooks
+func (l *Lifecycle) dependsOnPath(from, to string, visited map[string]bool) bool {
+	if visited[from] {
+		return false
+	}
+	visited[from] = true
+	for _, dep := range l.dependencies[from] {
+		if dep == to || l.dependsOnPath(dep, to, visited) {
+			return true
+		}
+	}
+	return false
+}
+
+// startupUnits returns the ordered startup hooks as the units startup runs
+// one after another: a single hook, or the hooks of a ParallelGroup. The
+// units are sorted topologically by DependsOn with Kahn's algorithm, always
+// taking the earliest registered unit that is ready next.
+func (l *Lifecycle) startupUnits() ([][]LifecycleEntry, error) {
+	var units [][]LifecycleEntry
+	unitOf := make(map[string]int)
+	groupUnit := make(map[int]int)
+	for _, entry := range l.startupHooks {
+		if entry.group != 0 {
+			if u, ok := groupUnit[entry.group]; ok {
+				units[u] = append(units[u], entry)
+				unitOf[entry.Name] = u
+				continue
+			}
+			groupUnit[entry.group] = len(units)
+		}
+		unitOf[entry.Name] = len(units)
+		units = append(units, []LifecycleEntry{entry})
+	}
+	if len(l.dependencies) == 0 {
+		return units, nil
+	}
+
+	inDegree := make([]int, len(units))
+	dependents := make([][]int, len(units))
+	for _, name := range slices.Sorted(maps.Keys(l.dependencies)) {
+		u, ok := unitOf[name]
+		if !ok {
+			return nil, &Error{Code: ErrInvalidOperation, Message: fmt.Sprintf("startup hook '%s' has dependencies but is not registered", name)}
+		}
+		for _, dep := range l.dependencies[name] {
+			d, ok := unitOf[dep]
+			switch {
+			case !ok:
+				return nil, &Error{Code: ErrInvalidOperation, Message: fmt.Sprintf("startup hook '%s' depends on unknown hook '%s'", name, dep)}
+			case d == u:
+				return nil, &Error{Code: ErrInvalidOperation, Message: fmt.Sprintf("startup hook '%s' depends on '%s' in the same parallel group", name, dep)}
+			}
+			dependents[d] = append(dependents[d], u)
+			inDegree[u]++
+		}
+	}
+
+	sorted := make([][]LifecycleEntry, 0, len(units))
+	done := make([]bool, len(units))
+	for len(sorted) < len(units) {
+		next := -1
+		for u := range units {
+			if !done[u] && inDegree[u] == 0 {
+				next = u
+				break
+			}
+		}
+		if next < 0 {
+			// Only possible when parallel groups join otherwise acyclic edges
+			return nil, &Error{Code: ErrInvalidOperation, Message: "startup hook dependencies form a cycle through a parallel group"}
+		}
+		done[next] = true
+		sorted = append(sorted, units[next])
+		for _, u := range dependents[next] {
+			inDegree[u]--
+		}
+	}
+	return sorted, nil
+}
+
+// OnShutdown registers a shutdown hook that does not take a context
+func (l *Lifecycle) OnShutdown(name string, hook LifecycleHookSimple) {
+	l.shutdownHooks = append(l.shutdownHooks, newLifecycleEntry(name, hook))
 }
 
-// Lifecycle manages startup and shutdown hooks
-type Lifecycle struct {
-	startupHooks  []LifecycleEntry
-	shutdownHooks []LifecycleEntry
+// OnShutdownCtx registers a shutdown hook that receives a context
+func (l *Lifecycle) OnShutdownCtx(name string, hook LifecycleHook) {
+	l.shutdownHooks = append(l.shutdownHooks, LifecycleEntry{Name: name, Hook: hook})
 }
 
-// NewLifecycle creates a new lifecycle manager
-func NewLifecycle() *Lifecycle {
-	return &Lifecycle{
-		startupHooks:  []LifecycleEntry{},
-		shutdownHooks: []LifecycleEntry{},
+// RunStartup runs all ordered startup hooks in registration order, adjusted
+// for DependsOn, then runs the parallel hooks concurrently. Parallel hooks
+// only start if every ordered hook succeeded; their errors are combined
+// with errors.Join. Each hook's duration and error are logged and kept for
+// LastStartupReport.
+func (l *Lifecycle) RunStartup() error {
+	return l.RunStartupWithContext(context.Background())
+}
+
+// RunStartupWithContext is like RunStartup, passing ctx to the hooks, so a
+// hung hook cannot block startup forever. Once ctx is done, a hook still
+// running is abandoned and fails with the context error, and the remaining
+// hooks do not run.
+func (l *Lifecycle) RunStartupWithContext(ctx context.Context) error {
+	var reports []HookReport
+	defer func() {
+		l.reportMu.Lock()
+		l.startupReport = reports
+		l.reportMu.Unlock()
+	}()
+
+	units, err := l.startupUnits()
+	if err != nil {
+		return err
+	}
+	for _, unit := range units {
+		entry := unit[0]
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("startup aborted before hook %s: %w", entry.Name, err)
+		}
+		if entry.group != 0 {
+			groupReports, errs := l.runParallel(ctx, unit)
+			reports = append(reports, groupReports...)
+			if len(errs) > 0 {
+				return &ErrorGroup{Errors: errs}
+			}
+			continue
+		}
+		report := l.runHook(ctx, "startup", entry)
+		reports = append(reports, report)
+		if report.Err != nil {
+			return fmt.Errorf("startup hook %s failed: %w", entry.Name, report.Err)
+		}
+	}
+
+	if err := ctx.Err(); err != nil && len(l.parallelHooks) > 0 {
+		return fmt.Errorf("startup aborted before parallel hooks: %w", err)
+	}
+	parallel, errs := l.runParallel(ctx, l.parallelHooks)
+	reports = append(reports, parallel...)
+
+	return errors.Join(errs...)
+}
+
+// runParallel runs the startup hooks in entries concurrently and waits for
+// all of them, returning their reports in the order of entries and the
+// errors of the hooks that failed
+func (l *Lifecycle) runParallel(ctx context.Context, entries []LifecycleEntry) ([]HookReport, []error) {
+	reports := make([]HookReport, len(entries))
+	var wg sync.WaitGroup
+	for i, entry := range entries {
+		wg.Add(1)
+		go func(i int, entry LifecycleEntry) {
+			defer wg.Done()
+			reports[i] = l.runHook(ctx, "startup", entry)
+		}(i, entry)
+	}
+	wg.Wait()
+
+	var errs []error
+	for i, report := range reports {
+		if report.Err != nil {
+			errs = append(errs, fmt.Errorf("startup hook %s failed: %w", entries[i].Name, report.Err))
+		}
 	}
+	return reports, errs
 }
 
-// OnStartup registers a startup hook
-func (l *Lifecycle) OnStartup(name string, hook LifecycleHook) {
-	l.startupHooks = append(l.startupHooks, LifecycleEntry{Name: name, Hook: hook})
+// RunStartupContext is like RunStartupWithContext.
+//
+// Deprecated: use RunStartupWithContext.
+func (l *Lifecycle) RunStartupContext(ctx context.Context) error {
+	return l.RunStartupWithContext(ctx)
 }
 
-// OnShutdown registers a shutdown hook
-func (l *Lifecycle) OnShutdown(name string, hook LifecycleHook) {
-	l.shutdownHooks = append(l.shutdownHooks, LifecycleEntry{Name: name, Hook: hook})
+// RunShutdown runs all shutdown hooks in reverse order (LIFO). Each hook's
+// duration and error are logged and kept for LastShutdownReport.
+func (l *Lifecycle) RunShutdown() error {
+	return l.RunShutdownContext(context.Background())
 }
 
-// RunStartup runs all startup hooks in order
-func (l *Lifecycle) RunStartup() error {
-	for _, entry := range l.startupHooks {
-		if err := entry.Hook(); err != nil {
-			return fmt.Errorf("startup hook %s failed: %w", entry.Name, err)
-		}
+// RunShutdownContext runs all shutdown hooks in reverse order (LIFO),
+// passing ctx to each. Every hook runs even if an earlier one failed.
+//
+// A hook still running when ctx is done is abandoned and its error is
+// recorded as the context error, so a hook that ignores cancellation cannot
+// block the remaining hooks past the deadline. The remaining hooks then run
+// with the cancelled context. Errors are combined with errors.Join.
+func (l *Lifecycle) RunShutdownContext(ctx context.Context) error {
+	return errors.Join(l.runShutdown(func() (context.Context, context.CancelFunc) {
+		return ctx, func() {}
+	})...)
+}
+
+// RunShutdownWithTimeout runs all shutdown hooks in reverse order (LIFO),
+// giving each hook its own deadline of timeout, so a hook stalled on an
+// unresponsive service cannot hold up the hooks after it. Hooks that time
+// out are logged as warnings and the remaining hooks still run. All errors,
+// including timeouts, are returned in an *ErrorGroup.
+func (l *Lifecycle) RunShutdownWithTimeout(timeout time.Duration) error {
+	errs := l.runShutdown(func() (context.Context, context.CancelFunc) {
+		return context.WithTimeout(context.Background(), timeout)
+	})
+	if len(errs) == 0 {
+		return nil
 	}
-	return nil
+	return &ErrorGroup{Errors: errs}
 }
 
-// RunShutdown runs all shutdown hooks in reverse order (LIFO)
-func (l *Lifecycle) RunShutdown() error {
-	var lastErr error
+// runShutdown runs the shutdown hooks in reverse order, each with a
+// context from hookCtx, records the report and returns the hook errors
+func (l *Lifecycle) runShutdown(hookCtx func() (context.Context, context.CancelFunc)) []error {
+	var errs []error
+	var reports []HookReport
 	for i := len(l.shutdownHooks) - 1; i >= 0; i-- {
 		entry := l.shutdownHooks[i]
-		if err := entry.Hook(); err != nil {
-			lastErr = fmt.Errorf("shutdown hook %s failed: %w", entry.Name, err)
+		ctx, cancel := hookCtx()
+		report := l.runHook(ctx, "shutdown", entry)
+		cancel()
+		reports = append(reports, report)
+		if report.Err != nil {
+			errs = append(errs, fmt.Errorf("shutdown hook %s failed: %w", entry.Name, report.Err))
 		}
 	}
-	return lastErr
+
+	l.reportMu.Lock()
+	l.shutdownReport = reports
+	l.reportMu.Unlock()
+	return errs
+}
+
+// ErrorGroup collects the errors of lifecycle hooks that run as a group.
+// errors.Is and errors.As see each error.
+type ErrorGroup struct {
+	Errors []error
+}
+
+func (g *ErrorGroup) Error() string {
+	messages := make([]string, len(g.Errors))
+	for i, err := range g.Errors {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Unwrap returns the collected errors
+func (g *ErrorGroup) Unwrap() []error {
+	return g.Errors
+}
+
+// Remove deregisters every startup, parallel startup and shutdown hook
+// named name, e.g. so a test sharing an App can skip a hook. Dependencies
+// recorded with DependsOn for the hook are dropped too. It reports whether
+// any hook was removed.
+func (l *Lifecycle) Remove(name string) bool {
+	startup := l.removeStartup(name)
+	shutdown := l.removeShutdown(name)
+	return startup || shutdown
+}
+
+// removeStartup removes the startup and parallel startup hooks named name
+// and the dependencies involving them
+func (l *Lifecycle) removeStartup(name string) bool {
+	named := func(e LifecycleEntry) bool { return e.Name == name }
+	n := len(l.startupHooks) + len(l.parallelHooks)
+	l.startupHooks = slices.DeleteFunc(l.startupHooks, named)
+	l.parallelHooks = slices.DeleteFunc(l.parallelHooks, named)
+	if len(l.startupHooks)+len(l.parallelHooks) == n {
+		return false
+	}
+
+	delete(l.dependencies, name)
+	for hook, deps := range l.dependencies {
+		l.dependencies[hook] = slices.DeleteFunc(deps, func(dep string) bool { return dep == name })
+	}
+	return true
 }
 
-// StartupCount returns the number of startup hooks
+// removeShutdown removes the shutdown hooks named name
+func (l *Lifecycle) removeShutdown(name string) bool {
+	n := len(l.shutdownHooks)
+	l.shutdownHooks = slices.DeleteFunc(l.shutdownHooks, func(e LifecycleEntry) bool { return e.Name == name })
+	return len(l.shutdownHooks) != n
+}
+
+// StartupCount returns the number of startup hooks, including parallel ones
 func (l *Lifecycle) StartupCount() int {
-	return len(l.startupHooks)
+	return len(l.startupHooks) + len(l.parallelHooks)
 }
 
 // ShutdownCount returns the number of shutdown hooks
@@ -1323,8 +6431,21 @@ func (l *Lifecycle) ShutdownCount() int {
 
 // App lifecycle methods
 
-// OnStartup registers a startup hook on the app
-func (a *App) OnStartup(name string, hook LifecycleHook) {
+// Lifecycle returns the app's lifecycle manager, e.g. to inspect
+// LastShutdownReport after the server stopped
+func (a *App) Lifecycle() *Lifecycle {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.lifecycle == nil {
+		a.lifecycle = NewLifecycle()
+	}
+	return a.lifecycle
+}
+
+// OnStartup registers a startup hook on the app.
+// Startup hooks run when the server starts; a failing hook prevents the
+// server from starting.
+func (a *App) OnStartup(name string, hook LifecycleHookSimple) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 	if a.lifecycle == nil {
@@ -1333,8 +6454,68 @@ func (a *App) OnStartup(name string, hook LifecycleHook) {
 	a.lifecycle.OnStartup(name, hook)
 }
 
+// OnStartupCtx registers a startup hook on the app that receives a context
+func (a *App) OnStartupCtx(name string, hook LifecycleHook) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.lifecycle == nil {
+		a.lifecycle = NewLifecycle()
+	}
+	a.lifecycle.OnStartupCtx(name, hook)
+}
+
+// OnStartupParallel registers a startup hook on the app that runs
+// concurrently with other parallel hooks after the ordered startup hooks
+func (a *App) OnStartupParallel(name string, hook LifecycleHookSimple) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.lifecycle == nil {
+		a.lifecycle = NewLifecycle()
+	}
+	a.lifecycle.OnStartupParallel(name, hook)
+}
+
+// ParallelGroup makes the named startup hooks run concurrently as a group;
+// see Lifecycle.ParallelGroup
+func (a *App) ParallelGroup(names ...string) error {
+	return a.Lifecycle().ParallelGroup(names...)
+}
+
+// DependsOn records that the startup hook hookName must run after the
+// startup hook dependsOn; see Lifecycle.DependsOn
+func (a *App) DependsOn(hookName, dependsOn string) error {
+	return a.Lifecycle().DependsOn(hookName, dependsOn)
+}
+
+// RemoveStartupHook deregisters the startup hooks named name, including
+// parallel ones, and reports whether any was removed. It panics if the
+// server has started.
+func (a *App) RemoveStartupHook(name string) bool {
+	return a.removeHook(name, (*Lifecycle).removeStartup)
+}
+
+// RemoveShutdownHook deregisters the shutdown hooks named name and reports
+// whether any was removed. It panics if the server has started.
+func (a *App) RemoveShutdownHook(name string) bool {
+	return a.removeHook(name, (*Lifecycle).removeShutdown)
+}
+
+// removeHook removes hooks named name with remove, panicking once the
+// server has started since the hooks may already be running
+func (a *App) removeHook(name string, remove func(*Lifecycle, string) bool) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.started {
+		panic(fmt.Sprintf("archimedes: cannot remove lifecycle hook '%s' after the server has started", name))
+	}
+	if a.lifecycle == nil {
+		return false
+	}
+	return remove(a.lifecycle, name)
+}
+
 // OnShutdown registers a shutdown hook on the app
-func (a *App) OnShutdown(name string, hook LifecycleHook) {
+func (a *App) OnShutdown(name string, hook LifecycleHookSimple) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 	if a.lifecycle == nil {
@@ -1343,6 +6524,296 @@ func (a *App) OnShutdown(name string, hook LifecycleHook) {
 	a.lifecycle.OnShutdown(name, hook)
 }
 
+// OnShutdownCtx registers a shutdown hook on the app that receives a
+// context. The context is cancelled once Config.ShutdownTimeout elapses.
+func (a *App) OnShutdownCtx(name string, hook LifecycleHook) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.lifecycle == nil {
+		a.lifecycle = NewLifecycle()
+	}
+	a.lifecycle.OnShutdownCtx(name, hook)
+}
+
+// =============================================================================
+// WebSocket
+// =============================================================================
+
+// WebSocket message types, as RFC 6455 opcodes
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+	CloseMessage  = 8
+	PingMessage   = 9
+	PongMessage   = 10
+)
+
+// websocketGUID is the RFC 6455 key used to compute Sec-WebSocket-Accept
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocket is a connection upgraded from a request with Context.Upgrade.
+//
+// Control messages are not answered automatically: ReadMessage returns
+// client pings and pongs, and a handler replies to a ping with
+// WriteMessage(PongMessage, data). Once the client closes the connection,
+// ReadMessage returns io.EOF; call Close to send the closing message.
+//
+// One goroutine may read while another writes. Close may be called from
+// any goroutine: it unblocks a read in progress and waits for reads and
+// writes to return before releasing the connection.
+type WebSocket struct {
+	handle  *C.struct_archimedes_websocket
+	mu      sync.Mutex
+	closed  bool
+	pending sync.WaitGroup // reads and writes in progress
+}
+
+// Upgrade switches the request's connection to the WebSocket protocol. It
+// verifies the Upgrade, Connection, Sec-WebSocket-Key and
+// Sec-WebSocket-Version headers, completes the handshake, and returns the
+// connection. It returns an error without upgrading if the client did not
+// request a WebSocket upgrade.
+//
+// The handler owns the connection until it calls Close; the handler's own
+// response is not sent.
+func (c *Context) Upgrade() (*WebSocket, error) {
+	if !headerHasToken(c.requestHeader("Upgrade"), "websocket") || !headerHasToken(c.requestHeader("Connection"), "upgrade") {
+		return nil, &Error{Code: ErrInvalidOperation, Message: "request did not ask for a WebSocket upgrade"}
+	}
+	key := c.requestHeader("Sec-WebSocket-Key")
+	if nonce, err := base64.StdEncoding.DecodeString(key); err != nil || len(nonce) != 16 {
+		return nil, &Error{Code: ErrInvalidOperation, Message: "invalid Sec-WebSocket-Key header"}
+	}
+	if version := c.requestHeader("Sec-WebSocket-Version"); version != "13" {
+		return nil, &Error{Code: ErrInvalidOperation, Message: fmt.Sprintf("unsupported Sec-WebSocket-Version %q", version)}
+	}
+	if c.streaming {
+		return nil, &Error{Code: ErrInvalidOperation, Message: "cannot upgrade after the response has started"}
+	}
+
+	cRequestID := C.CString(c.RequestID)
+	defer C.free(unsafe.Pointer(cRequestID))
+	cAccept := C.CString(websocketAccept(key))
+	defer C.free(unsafe.Pointer(cAccept))
+
+	handle := C.archimedes_ws_upgrade(cRequestID, cAccept)
+	if handle == nil {
+		return nil, &Error{Code: ErrInvalidOperation, Message: C.GoString(C.archimedes_last_error())}
+	}
+	c.responseStatus = 101
+	return &WebSocket{handle: handle}, nil
+}
+
+// websocketAccept computes the Sec-WebSocket-Accept value for a key
+func websocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// headerHasToken reports whether a comma-separated header value contains
+// token, ignoring case
+func headerHasToken(value, token string) bool {
+	for _, part := range strings.Split(value, ",") {
+		if strings.EqualFold(strings.TrimSpace(part), token) {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadMessage blocks until the next message arrives and returns its payload
+// and type. It returns io.EOF once the connection is closed.
+func (ws *WebSocket) ReadMessage() ([]byte, int, error) {
+	handle := ws.acquire()
+	if handle == nil {
+		return nil, 0, io.EOF
+	}
+	defer ws.pending.Done()
+
+	var data *C.uint8_t
+	var length C.size_t
+	var msgType C.int32_t
+	if err := C.archimedes_ws_read(handle, &data, &length, &msgType); err != C.ARCHIMEDES_ERROR_OK {
+		return nil, 0, &Error{Code: int(err), Message: "failed to read WebSocket message"}
+	}
+	defer C.archimedes_ws_free_message(data, length)
+
+	if msgType == CloseMessage {
+		return nil, CloseMessage, io.EOF
+	}
+	return C.GoBytes(unsafe.Pointer(data), C.int(length)), int(msgType), nil
+}
+
+// WriteMessage sends a message of the given type (TextMessage,
+// BinaryMessage, PingMessage, PongMessage or CloseMessage)
+func (ws *WebSocket) WriteMessage(msgType int, data []byte) error {
+	handle := ws.acquire()
+	if handle == nil {
+		return &Error{Code: ErrInvalidOperation, Message: "WebSocket connection closed"}
+	}
+	defer ws.pending.Done()
+
+	var ptr *C.uint8_t
+	if len(data) > 0 {
+		ptr = (*C.uint8_t)(unsafe.Pointer(&data[0]))
+	}
+	if err := C.archimedes_ws_write(handle, C.int32_t(msgType), ptr, C.size_t(len(data))); err != C.ARCHIMEDES_ERROR_OK {
+		return &Error{Code: int(err), Message: C.GoString(C.archimedes_last_error())}
+	}
+	return nil
+}
+
+// Close sends a close message if the connection is still open and releases
+// it. A ReadMessage blocked in another goroutine returns io.EOF. Close is
+// safe to call more than once.
+func (ws *WebSocket) Close() {
+	ws.mu.Lock()
+	if ws.closed || ws.handle == nil {
+		ws.mu.Unlock()
+		return
+	}
+	ws.closed = true
+	handle := ws.handle
+	ws.mu.Unlock()
+
+	// The mutex is not held here, so a blocked read cannot stall Close:
+	// shutting the connection down wakes it, and the handle is freed once
+	// it returns
+	C.archimedes_ws_shutdown(handle)
+	ws.pending.Wait()
+	C.archimedes_ws_close(handle)
+}
+
+// acquire returns the connection handle for a read or write, or nil once
+// the connection is closed. A non-nil handle is released with
+// ws.pending.Done.
+func (ws *WebSocket) acquire() *C.struct_archimedes_websocket {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if ws.closed || ws.handle == nil {
+		return nil
+	}
+	ws.pending.Add(1)
+	return ws.handle
+}
+
+// =============================================================================
+// Internal Dispatch
+// =============================================================================
+
+// maxInvokeDepth bounds nested Invoke calls to catch handlers that invoke
+// each other recursively
+const maxInvokeDepth = 8
+
+// Invoke dispatches to another registered operation in-process and captures
+// its response, without an HTTP round-trip. The derived context shares the
+// request ID, trace, caller, and request headers of c.
+//
+// If the invoked handler returns an error, it is returned together with the
+// error response the client would have received. Invoke fails without
+// calling a handler if the operation is not registered or if nested Invoke
+// calls exceed the depth limit.
+func (c *Context) Invoke(operationID string, body []byte) (*TestResponse, error) {
+	if c.app == nil {
+		return nil, &Error{Code: ErrInvalidOperation, Message: "context is not attached to an app"}
+	}
+	if c.invokeDepth >= maxInvokeDepth {
+		return nil, &Error{
+			Code:    ErrHandlerError,
+			Message: fmt.Sprintf("invoke depth limit of %d exceeded calling %s", maxInvokeDepth, operationID),
+		}
+	}
+
+	c.app.mu.RLock()
+	handler, ok := c.app.handlers[operationID]
+	c.app.mu.RUnlock()
+	if !ok {
+		return nil, &Error{Code: ErrInvalidOperation, Message: fmt.Sprintf("operation %s is not registered", operationID)}
+	}
+
+	headers := make(map[string]string, len(c.Headers))
+	for name, value := range c.Headers {
+		headers[name] = value
+	}
+	child := &Context{
+		RequestID:       c.RequestID,
+		TraceID:         c.TraceID,
+		SpanID:          c.SpanID,
+		OperationID:     operationID,
+		Method:          c.Method,
+		Path:            c.Path,
+		Query:           c.Query,
+		PathParams:      make(map[string]string),
+		Headers:         headers,
+		Caller:          c.Caller,
+		RemoteAddr:      c.RemoteAddr,
+		tlsInfo:         c.tlsInfo,
+		rawPath:         c.rawPath,
+		rawQuery:        c.rawQuery,
+		headersMulti:    maps.Clone(c.headersMulti),
+		body:            body,
+		responseStatus:  200,
+		responseHeaders: make(map[string]string),
+		app:             c.app,
+		invokeDepth:     c.invokeDepth + 1,
+		ReceivedAt:      c.ReceivedAt,
+		stdCtx:          c.stdCtx,
+	}
+
+	err := handler(child)
+	if err == nil && child.stream != nil {
+		err = child.stream.Flush()
+	}
+	return child.testResponse(err), err
+}
+
+// testResponse captures the response written to c, or the error response
+// for a handler error
+func (c *Context) testResponse(err error) *TestResponse {
+	if err != nil {
+		return &TestResponse{
+			statusCode: statusForError(err),
+			headers:    testResponseHeaders(c.errorResponseHeaders()),
+			body:       []byte(errorBody(err)),
+		}
+	}
+
+	return &TestResponse{
+		statusCode: c.responseStatus,
+		headers:    testResponseHeaders(c.finalResponseHeaders()),
+		body:       c.responseBody,
+	}
+}
+
+// testResponseHeaders collects headers and contentType into the map a
+// TestResponse holds, keeping the first value of repeated headers and
+// leaving out cookies
+func testResponseHeaders(headers [][2]string, contentType string) map[string]string {
+	collected := make(map[string]string, len(headers)+1)
+	for _, header := range headers {
+		if _, ok := collected[header[0]]; ok || header[0] == "Set-Cookie" {
+			continue
+		}
+		collected[header[0]] = header[1]
+	}
+	if contentType != "" {
+		collected["Content-Type"] = contentType
+	}
+	return collected
+}
+
+// errorBody formats a handler error as the JSON error response body.
+// Validation errors include the failing fields.
+func errorBody(err error) string {
+	body := map[string]any{"error": err.Error()}
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		body["fields"] = validationErr.Fields
+	}
+	data, _ := json.Marshal(body)
+	return string(data)
+}
+
 // =============================================================================
 // CGO Callback Implementation
 // =============================================================================
@@ -1357,12 +6828,14 @@ func go_handler_callback(
 	// Get handler from registry
 	handlerID := uintptr(userData)
 	handlerRegistryMu.RLock()
-	handler, ok := handlerRegistry[handlerID]
+	entry, ok := handlerRegistry[handlerID]
 	handlerRegistryMu.RUnlock()
 
-	// Default error response
+	// Default error response. The body, content type and headers are all
+	// allocated with malloc for the FFI layer to free.
 	var response C.struct_archimedes_response_data
 	response.status_code = 500
+	response.headers_owned = true
 
 	if !ok {
 		errBody := `{"error":"Handler not found"}`
@@ -1385,6 +6858,8 @@ func go_handler_callback(
 		Headers:         make(map[string]string),
 		responseStatus:  200,
 		responseHeaders: make(map[string]string),
+		app:             entry.app,
+		ReceivedAt:      time.Now(),
 	}
 
 	// Copy body
@@ -1403,7 +6878,7 @@ func go_handler_callback(
 	for i := C.size_t(0); i < ctx.headers_count; i++ {
 		name := C.GoString(*(**C.char)(unsafe.Pointer(uintptr(unsafe.Pointer(ctx.header_names)) + uintptr(i)*unsafe.Sizeof(uintptr(0)))))
 		value := C.GoString(*(**C.char)(unsafe.Pointer(uintptr(unsafe.Pointer(ctx.header_values)) + uintptr(i)*unsafe.Sizeof(uintptr(0)))))
-		goCtx.Headers[name] = value
+		goCtx.addHeader(name, value)
 	}
 
 	// Parse caller identity
@@ -1417,29 +6892,272 @@ func go_handler_callback(
 		}
 	}
 
-	// Call handler
-	err := handler(goCtx)
-	if err != nil {
-		errBody := fmt.Sprintf(`{"error":"%s"}`, err.Error())
-		response.status_code = 500
-		response.body = C.CString(errBody)
-		response.body_len = C.size_t(len(errBody))
-		response.body_owned = true
-		return response
+	// Parse TLS connection info
+	if ctx.tls_info_json != nil {
+		goCtx.tlsInfo = parseTLSInfo(C.GoString(ctx.tls_info_json))
+	}
+
+	// Preserve the unnormalized request target
+	if ctx.raw_path != nil {
+		goCtx.rawPath = C.GoString(ctx.raw_path)
+	}
+	if ctx.raw_query != nil {
+		goCtx.rawQuery = C.GoString(ctx.raw_query)
+	}
+	if ctx.remote_addr != nil {
+		goCtx.RemoteAddr = C.GoString(ctx.remote_addr)
+	}
+
+	// A body that has already arrived means the client got 100 Continue
+	goCtx.continueSent = bodyLen > 0
+
+	// Send 100 Continue and stream chunks through the FFI as they are
+	// written, sending the status and headers with the first chunk
+	streamStarted := false
+	if ctx.response_stream != nil {
+		stream := ctx.response_stream
+		goCtx.continueSink = func() error {
+			if cerr := C.archimedes_stream_continue(stream); cerr != C.ARCHIMEDES_ERROR_OK {
+				return &Error{Code: int(cerr), Message: C.GoString(C.archimedes_last_error())}
+			}
+			return nil
+		}
+		goCtx.chunkSink = func(chunk []byte) error {
+			if !streamStarted {
+				streamStarted = true
+				if err := startResponseStream(stream, goCtx); err != nil {
+					return err
+				}
+			}
+			return writeResponseStream(stream, chunk)
+		}
+	}
+
+	// Reject an unmet expectation instead of calling the handler
+	var err error
+	expect := goCtx.requestHeader("Expect")
+	contentLength, _ := strconv.ParseInt(goCtx.requestHeader("Content-Length"), 10, 64)
+	maxBodySize := entry.app.operationConfig(goCtx.OperationID).MaxBodySize
+	if expectationFailed(expect, contentLength, maxBodySize) {
+		err = goCtx.Errorf(417, "EXPECTATION_FAILED", "Expectation %q cannot be met", expect)
+	} else {
+		err = entry.app.serve(goCtx, entry.handler)
+	}
+	if streamStarted {
+		// The status was sent with the first chunk; a late error can only
+		// end the stream
+		response.status_code = C.int32_t(goCtx.responseStatus)
+		return response
+	}
+	if err != nil {
+		errBody := errorBody(err)
+		response.status_code = C.int32_t(statusForError(err))
+		response.body = C.CString(errBody)
+		response.body_len = C.size_t(len(errBody))
+		response.body_owned = true
+		headers, contentType := goCtx.errorResponseHeaders()
+		if contentType != "" {
+			response.content_type = C.CString(contentType)
+		}
+		setResponseHeaders(&response, headers)
+		return response
+	}
+
+	// Build response
+	response.status_code = C.int32_t(goCtx.responseStatus)
+	if len(goCtx.responseBody) > 0 {
+		response.body = C.CString(string(goCtx.responseBody))
+		response.body_len = C.size_t(len(goCtx.responseBody))
+		response.body_owned = true
+	}
+	headers, contentType := goCtx.finalResponseHeaders()
+	if contentType != "" {
+		response.content_type = C.CString(contentType)
+	}
+	setResponseHeaders(&response, headers)
+
+	return response
+}
+
+// responseHeaderList flattens the response headers into name/value pairs,
+// emitting each cookie as its own Set-Cookie header
+func (c *Context) responseHeaderList() [][2]string {
+	headers := make([][2]string, 0, len(c.responseHeaders)+len(c.cookieHeaders))
+	for name, value := range c.responseHeaders {
+		headers = append(headers, [2]string{name, value})
+	}
+	for _, cookie := range c.cookieHeaders {
+		headers = append(headers, [2]string{"Set-Cookie", cookie})
+	}
+	return headers
+}
+
+// SetResponseHeaderFilter sets fn to run on the finalized headers of every
+// response just before they are sent, after handlers and middleware are
+// done. fn may add, remove or rewrite entries; names are canonicalized
+// (e.g. "Content-Type") and Set-Cookie holds one value per cookie. This is
+// the single place to enforce header policy such as HSTS or hiding Server.
+// Pass nil to remove the filter.
+func (a *App) SetResponseHeaderFilter(fn func(headers map[string][]string)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.responseHeaderFilter = fn
+}
+
+// finalResponseHeaders returns the response headers of c and its content
+// type after the response header filter has run
+func (c *Context) finalResponseHeaders() ([][2]string, string) {
+	if c.app == nil {
+		return c.responseHeaderList(), c.contentType
+	}
+	return c.app.filterResponseHeaders(c.responseHeaderList(), c.contentType)
+}
+
+// errorResponseHeaders returns the headers of the error response for a
+// handler error: those already set on c, such as CORS headers, without
+// the content type of the response the handler meant to send
+func (c *Context) errorResponseHeaders() ([][2]string, string) {
+	if c.app == nil {
+		return c.responseHeaderList(), ""
+	}
+	return c.app.filterResponseHeaders(c.responseHeaderList(), "")
+}
+
+// filterResponseHeaders runs the response header filter, if one is set,
+// over headers and contentType. The filtered headers are returned sorted by
+// name, with Content-Type split back out.
+func (a *App) filterResponseHeaders(headers [][2]string, contentType string) ([][2]string, string) {
+	a.mu.RLock()
+	filter := a.responseHeaderFilter
+	a.mu.RUnlock()
+	if filter == nil {
+		return headers, contentType
+	}
+
+	values := make(map[string][]string, len(headers)+1)
+	for _, header := range headers {
+		name := textproto.CanonicalMIMEHeaderKey(header[0])
+		values[name] = append(values[name], header[1])
+	}
+	if contentType != "" {
+		values["Content-Type"] = []string{contentType}
+	}
+
+	filter(values)
+
+	contentType = ""
+	if types := values["Content-Type"]; len(types) > 0 {
+		contentType = types[0]
+	}
+	delete(values, "Content-Type")
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	filtered := make([][2]string, 0, len(names))
+	for _, name := range names {
+		for _, value := range values[name] {
+			filtered = append(filtered, [2]string{name, value})
+		}
+	}
+	return filtered, contentType
+}
+
+// setResponseHeaders copies headers into C-allocated arrays on the response.
+// The FFI layer frees them once the response is sent (headers_owned).
+func setResponseHeaders(response *C.struct_archimedes_response_data, headers [][2]string) {
+	if len(headers) == 0 {
+		return
+	}
+
+	ptrSize := C.size_t(unsafe.Sizeof(uintptr(0)))
+	names := C.malloc(C.size_t(len(headers)) * ptrSize)
+	values := C.malloc(C.size_t(len(headers)) * ptrSize)
+	for i, header := range headers {
+		*(**C.char)(unsafe.Pointer(uintptr(names) + uintptr(i)*uintptr(ptrSize))) = C.CString(header[0])
+		*(**C.char)(unsafe.Pointer(uintptr(values) + uintptr(i)*uintptr(ptrSize))) = C.CString(header[1])
+	}
+
+	response.headers_count = C.size_t(len(headers))
+	response.header_names = (**C.char)(names)
+	response.header_values = (**C.char)(values)
+}
+
+// freeResponseHeaders frees the arrays and strings set by setResponseHeaders
+func freeResponseHeaders(response *C.struct_archimedes_response_data) {
+	if response.headers_count == 0 {
+		return
+	}
+
+	ptrSize := uintptr(unsafe.Sizeof(uintptr(0)))
+	for _, array := range []unsafe.Pointer{unsafe.Pointer(response.header_names), unsafe.Pointer(response.header_values)} {
+		for i := uintptr(0); i < uintptr(response.headers_count); i++ {
+			C.free(*(*unsafe.Pointer)(unsafe.Pointer(uintptr(array) + i*ptrSize)))
+		}
+		C.free(array)
+	}
+	response.headers_count = 0
+	response.header_names = nil
+	response.header_values = nil
+}
+
+// startResponseStream sends the context's status and headers as the head of
+// a streamed response
+func startResponseStream(stream *C.struct_archimedes_response_stream, ctx *Context) error {
+	var head C.struct_archimedes_response_data
+	head.status_code = C.int32_t(ctx.responseStatus)
+	headers, contentType := ctx.finalResponseHeaders()
+	if contentType != "" {
+		head.content_type = C.CString(contentType)
+		defer C.free(unsafe.Pointer(head.content_type))
+	}
+	setResponseHeaders(&head, headers)
+	defer freeResponseHeaders(&head)
+
+	if cerr := C.archimedes_stream_start(stream, &head); cerr != C.ARCHIMEDES_ERROR_OK {
+		return &Error{Code: int(cerr), Message: C.GoString(C.archimedes_last_error())}
 	}
+	return nil
+}
 
-	// Build response
-	response.status_code = C.int32_t(goCtx.responseStatus)
-	if len(goCtx.responseBody) > 0 {
-		response.body = C.CString(string(goCtx.responseBody))
-		response.body_len = C.size_t(len(goCtx.responseBody))
-		response.body_owned = true
+// writeResponseStream sends a chunk of a streamed response and flushes it
+// to the client
+func writeResponseStream(stream *C.struct_archimedes_response_stream, chunk []byte) error {
+	var data *C.uint8_t
+	if len(chunk) > 0 {
+		data = (*C.uint8_t)(unsafe.Pointer(&chunk[0]))
+	}
+	cerr := C.archimedes_stream_write(stream, data, C.size_t(len(chunk)))
+	if cerr == C.ARCHIMEDES_ERROR_OK {
+		cerr = C.archimedes_stream_flush(stream)
 	}
-	if goCtx.contentType != "" {
-		response.content_type = C.CString(goCtx.contentType)
+	if cerr != C.ARCHIMEDES_ERROR_OK {
+		return &Error{Code: int(cerr), Message: C.GoString(C.archimedes_last_error())}
 	}
+	return nil
+}
 
-	return response
+// statusForError maps a handler error to an HTTP status code
+func statusForError(err error) int {
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		return 422
+	}
+	var mediaErr *UnsupportedMediaTypeError
+	if errors.As(err, &mediaErr) {
+		return 415
+	}
+	var archErr *Error
+	if errors.As(err, &archErr) {
+		switch archErr.Code {
+		case ErrValidationError:
+			return 400
+		case ErrAuthorizationError:
+			return 403
+		}
+	}
+	return 500
 }
 
 // =============================================================================
@@ -1563,6 +7281,127 @@ func (c *CorsConfig) GetAllowCredentials() bool {
 	return c.allowCredentials
 }
 
+// UseCors applies cfg to every request: preflight OPTIONS requests are
+// answered directly, and responses to allowed origins carry the
+// Access-Control-Allow-* headers. Pass nil to disable CORS.
+//
+// The policy is applied by the Go dispatch path (ServeHTTP, TestClient and
+// handler callbacks); preflights served by the native core only reach it
+// when the contract declares an OPTIONS operation for the path.
+func (a *App) UseCors(cfg *CorsConfig) {
+	a.mu.Lock()
+	a.cors = cfg
+	a.mu.Unlock()
+}
+
+// allowOriginValue returns the Access-Control-Allow-Origin value for
+// origin, or "" if the origin is not allowed. Credentialed requests cannot
+// use the "*" wildcard, so the origin is echoed instead.
+func (c *CorsConfig) allowOriginValue(origin string) string {
+	if origin == "" || !c.IsOriginAllowed(origin) {
+		return ""
+	}
+	if c.allowAnyOrigin && !c.allowCredentials && !c.allowedOrigins[origin] {
+		return "*"
+	}
+	return origin
+}
+
+// headerAllowed reports whether a request header may be sent, ignoring case
+func (c *CorsConfig) headerAllowed(name string) bool {
+	for header := range c.allowedHeaders {
+		if strings.EqualFold(header, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// setResponseHeaders adds the CORS headers for an actual (non-preflight)
+// request to ctx's response
+func (c *CorsConfig) setResponseHeaders(ctx *Context) {
+	origin := ctx.requestHeader("Origin")
+	if origin == "" {
+		return
+	}
+	ctx.addVary("Origin")
+	allowOrigin := c.allowOriginValue(origin)
+	if allowOrigin == "" {
+		return
+	}
+	ctx.SetHeader("Access-Control-Allow-Origin", allowOrigin)
+	if c.allowCredentials {
+		ctx.SetHeader("Access-Control-Allow-Credentials", "true")
+	}
+	if len(c.exposedHeaders) > 0 {
+		ctx.SetHeader("Access-Control-Expose-Headers", strings.Join(sortedKeys(c.exposedHeaders), ", "))
+	}
+}
+
+// corsPreflight answers a CORS preflight request, identified by the OPTIONS
+// method with Origin and Access-Control-Request-Method headers. It returns
+// nil for other requests or when CORS is disabled. Preflights for a
+// disallowed origin, method or header are rejected with 403.
+func (a *App) corsPreflight(method string, header func(string) string) *TestResponse {
+	a.mu.RLock()
+	c := a.cors
+	a.mu.RUnlock()
+	if c == nil || method != "OPTIONS" {
+		return nil
+	}
+	origin := header("Origin")
+	requestMethod := header("Access-Control-Request-Method")
+	if origin == "" || requestMethod == "" {
+		return nil
+	}
+
+	forbidden := func() *TestResponse {
+		resp := newCodeTestResponse(403, "CORS_FORBIDDEN")
+		resp.headers["Vary"] = "Origin"
+		return resp
+	}
+	allowOrigin := c.allowOriginValue(origin)
+	if allowOrigin == "" || !c.IsMethodAllowed(requestMethod) {
+		return forbidden()
+	}
+	var requestHeaders []string
+	for _, name := range strings.Split(header("Access-Control-Request-Headers"), ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if !c.headerAllowed(name) {
+			return forbidden()
+		}
+		requestHeaders = append(requestHeaders, name)
+	}
+
+	headers := map[string]string{
+		"Access-Control-Allow-Origin":  allowOrigin,
+		"Access-Control-Allow-Methods": strings.Join(sortedKeys(c.allowedMethods), ", "),
+		"Access-Control-Max-Age":       strconv.FormatUint(uint64(c.maxAgeSeconds), 10),
+		"Vary":                         "Origin",
+	}
+	if len(requestHeaders) > 0 {
+		headers["Access-Control-Allow-Headers"] = strings.Join(requestHeaders, ", ")
+	}
+	if c.allowCredentials {
+		headers["Access-Control-Allow-Credentials"] = "true"
+	}
+	return &TestResponse{statusCode: 204, headers: headers, body: []byte{}}
+}
+
+// sortedKeys returns the keys of a set in sorted order
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key, ok := range set {
+		if ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // =============================================================================
 // Rate Limit Configuration
 // =============================================================================
@@ -1650,6 +7489,131 @@ func (c *RateLimitConfig) IsEnabled() bool {
 	return c.enabled
 }
 
+// UseRateLimit limits each client to cfg's request rate with a token
+// bucket: a client may make up to BurstSize requests at once, refilled at
+// RequestsPerSecond. Clients are told apart by the configured key
+// extractor:
+//
+//   - "ip": the client address from Context.ClientIP, which only trusts
+//     forwarded headers from Config.TrustedProxies
+//   - "user": Caller.UserID
+//   - "api_key": Caller.KeyID
+//   - "header:X-Name": the value of the X-Name request header
+//
+// Requests without a key share one bucket. Exempt paths are never limited.
+// Allowed responses carry X-RateLimit-Remaining; once a bucket is empty,
+// requests get a 429 with Retry-After before any handler or middleware
+// runs. cfg is copied, so later changes to it have no effect; pass nil or
+// a disabled config to remove the limit.
+func (a *App) UseRateLimit(cfg *RateLimitConfig) {
+	var limiter *rateLimiter
+	if cfg != nil && cfg.enabled && cfg.requestsPerSecond > 0 {
+		limiter = newRateLimiter(cfg, time.Now)
+	}
+	a.mu.Lock()
+	a.rateLimiter = limiter
+	a.mu.Unlock()
+}
+
+// rateLimitSweepInterval is how often idle, full buckets are dropped
+const rateLimitSweepInterval = time.Minute
+
+// rateLimiter is a concurrency-safe set of token buckets, one per client
+type rateLimiter struct {
+	rate      float64
+	burst     float64
+	extractor string
+	exempt    map[string]bool
+	now       func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// tokenBucket holds a client's available requests as of last
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(cfg *RateLimitConfig, now func() time.Time) *rateLimiter {
+	exempt := make(map[string]bool, len(cfg.exemptPaths))
+	for path, ok := range cfg.exemptPaths {
+		exempt[path] = ok
+	}
+	return &rateLimiter{
+		rate:      cfg.requestsPerSecond,
+		burst:     math.Max(float64(cfg.burstSize), 1),
+		extractor: cfg.keyExtractor,
+		exempt:    exempt,
+		now:       now,
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: now(),
+	}
+}
+
+// key identifies the client making the request
+func (l *rateLimiter) key(ctx *Context) string {
+	switch {
+	case l.extractor == "user":
+		if ctx.Caller != nil {
+			return ctx.Caller.UserID
+		}
+	case l.extractor == "api_key":
+		if ctx.Caller != nil {
+			return ctx.Caller.KeyID
+		}
+	case strings.HasPrefix(l.extractor, "header:"):
+		return ctx.requestHeader(strings.TrimPrefix(l.extractor, "header:"))
+	default:
+		return ctx.ClientIP()
+	}
+	return ""
+}
+
+// allow takes a token for the request's client and sets the rate limit
+// headers, including Retry-After when the bucket is empty and the request
+// must be rejected
+func (l *rateLimiter) allow(ctx *Context) bool {
+	if l.exempt[ctx.Path] {
+		return true
+	}
+	key := l.key(ctx)
+	now := l.now()
+
+	l.mu.Lock()
+	if now.Sub(l.lastSweep) > rateLimitSweepInterval {
+		for k, b := range l.buckets {
+			if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	tokens := b.tokens
+	l.mu.Unlock()
+
+	ctx.SetHeader("X-RateLimit-Remaining", strconv.Itoa(int(tokens)))
+	if allowed {
+		return true
+	}
+	retryAfter := math.Ceil((1 - tokens) / l.rate)
+	ctx.SetHeader("Retry-After", strconv.Itoa(int(retryAfter)))
+	return false
+}
+
 // =============================================================================
 // Compression Configuration
 // =============================================================================
@@ -1818,6 +7782,92 @@ func (c *CompressionConfig) GetEnabledAlgorithms() []string {
 	return algos
 }
 
+// UseCompression compresses responses according to cfg. A response of at
+// least the minimum size whose Content-Type is in cfg's list is encoded
+// with the first enabled algorithm, in the order of GetEnabledAlgorithms,
+// that the request's Accept-Encoding header allows, and carries
+// Content-Encoding and Vary: Accept-Encoding. Pass nil to disable.
+//
+// Only gzip and deflate are encoded; Brotli and Zstandard are skipped as
+// the standard library has no encoder for them. Streamed and partial
+// (Range) responses, responses that already have a Content-Encoding, such
+// as precompressed static files, and already-compressed media such as
+// images and archives are sent as is.
+func (a *App) UseCompression(cfg *CompressionConfig) {
+	a.mu.Lock()
+	a.compression = cfg
+	a.mu.Unlock()
+}
+
+// compress encodes the buffered response of ctx if the policy applies to it
+func (c *CompressionConfig) compress(ctx *Context) error {
+	switch {
+	case ctx.streaming, ctx.responseStatus == 204, ctx.responseStatus == 206, ctx.responseStatus == 304:
+		return nil
+	case uint64(len(ctx.responseBody)) < uint64(c.minSizeBytes), ctx.responseHeaders["Content-Encoding"] != "":
+		return nil
+	case !c.ShouldCompress(ctx.contentType), alreadyCompressed(ctx.contentType):
+		return nil
+	}
+
+	ctx.addVary("Accept-Encoding")
+	acceptEncoding := ctx.requestHeader("Accept-Encoding")
+	for _, coding := range c.GetEnabledAlgorithms() {
+		if !acceptsEncoding(acceptEncoding, coding) {
+			continue
+		}
+		var buf bytes.Buffer
+		var w io.WriteCloser
+		var err error
+		switch coding {
+		case "gzip":
+			w, err = gzip.NewWriterLevel(&buf, int(c.compressionLevel))
+		case "deflate":
+			// HTTP deflate is the zlib format (RFC 9110), not raw DEFLATE
+			w, err = zlib.NewWriterLevel(&buf, int(c.compressionLevel))
+		default:
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(ctx.responseBody); err != nil {
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+
+		ctx.responseBody = buf.Bytes()
+		ctx.SetHeader("Content-Encoding", coding)
+		if _, ok := ctx.responseHeaders["Content-Length"]; ok {
+			ctx.SetHeader("Content-Length", strconv.Itoa(buf.Len()))
+		}
+		return nil
+	}
+	return nil
+}
+
+// alreadyCompressed reports whether content of the given type is already
+// compressed, so encoding it again would only cost time
+func alreadyCompressed(contentType string) bool {
+	mediaType := parseMediaType(contentType)
+	switch mediaType {
+	case "image/svg+xml":
+		return false
+	case "application/zip", "application/gzip", "application/x-gzip", "application/x-bzip2",
+		"application/x-7z-compressed", "application/x-rar-compressed", "application/zstd",
+		"font/woff", "font/woff2":
+		return true
+	}
+	for _, prefix := range []string{"image/", "video/", "audio/"} {
+		if strings.HasPrefix(mediaType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 // =============================================================================
 // Static Files Configuration
 // =============================================================================
@@ -1871,73 +7921,419 @@ func (c *StaticFilesConfig) CacheMaxAge(seconds uint32) *StaticFilesConfig {
 	return c
 }
 
-// Precompressed enables or disables serving precompressed files (.gz, .br).
-func (c *StaticFilesConfig) Precompressed(enable bool) *StaticFilesConfig {
-	c.enablePrecompressed = enable
-	return c
-}
+// Precompressed enables or disables serving precompressed files (.gz, .br).
+func (c *StaticFilesConfig) Precompressed(enable bool) *StaticFilesConfig {
+	c.enablePrecompressed = enable
+	return c
+}
+
+// Fallback sets a fallback file for SPA routing.
+func (c *StaticFilesConfig) Fallback(file string) *StaticFilesConfig {
+	c.fallbackFile = file
+	return c
+}
+
+// GetDirectory returns the directory path.
+func (c *StaticFilesConfig) GetDirectory() string {
+	return c.directory
+}
+
+// GetPrefix returns the URL prefix.
+func (c *StaticFilesConfig) GetPrefix() string {
+	return c.prefix
+}
+
+// GetIndex returns the index file name.
+func (c *StaticFilesConfig) GetIndex() string {
+	return c.indexFile
+}
+
+// GetCacheMaxAge returns the cache max age in seconds.
+func (c *StaticFilesConfig) GetCacheMaxAge() uint32 {
+	return c.cacheMaxAgeSeconds
+}
+
+// IsPrecompressedEnabled returns whether precompressed files are enabled.
+func (c *StaticFilesConfig) IsPrecompressedEnabled() bool {
+	return c.enablePrecompressed
+}
+
+// GetFallback returns the fallback file if set.
+func (c *StaticFilesConfig) GetFallback() string {
+	return c.fallbackFile
+}
+
+// ETag returns the weak ETag served for a static file, computed from its
+// size and modification time.
+func (c *StaticFilesConfig) ETag(info fs.FileInfo) string {
+	return fileETag(info)
+}
+
+// ResolvePath resolves a request path to a file path.
+// Returns empty string if the path doesn't match the prefix or is invalid.
+func (c *StaticFilesConfig) ResolvePath(requestPath string) string {
+	if len(requestPath) < len(c.prefix) || requestPath[:len(c.prefix)] != c.prefix {
+		return ""
+	}
+
+	relative := requestPath[len(c.prefix):]
+	for len(relative) > 0 && relative[0] == '/' {
+		relative = relative[1:]
+	}
+
+	// Prevent directory traversal
+	if len(relative) >= 2 {
+		for i := 0; i < len(relative)-1; i++ {
+			if relative[i] == '.' && relative[i+1] == '.' {
+				return ""
+			}
+		}
+	}
+
+	if relative == "" {
+		return c.directory + "/" + c.indexFile
+	}
+	return c.directory + "/" + relative
+}
+
+// precompressedEncodings lists the precompressed variants ServeStatic
+// looks for, in order of preference, with their file suffixes
+var precompressedEncodings = []struct{ coding, suffix string }{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// ServeStatic registers a Wildcard handler under cfg's prefix that serves
+// files from its directory for GET and HEAD requests. Responses carry the
+// Content-Type guessed from the file extension, Cache-Control with the
+// configured max age, and an ETag, so conditional and Range requests work
+// as in Context.SendFile.
+//
+// A request for a directory serves its index file. A request for a missing
+// file serves the fallback file when one is set, so client-side routes of
+// a single-page app load the app, and gets 404 Not Found otherwise. With
+// precompressed files enabled, a "name.br" or "name.gz" next to the
+// requested file is served instead when the Accept-Encoding header allows
+// it. Paths containing ".." are rejected as in ResolvePath.
+//
+//	app.ServeStatic(archimedes.NewStaticFilesConfig().
+//	    Directory("./dist").
+//	    Prefix("/").
+//	    Fallback("index.html"))
+func (a *App) ServeStatic(cfg *StaticFilesConfig) error {
+	if cfg == nil {
+		return &Error{Code: ErrInvalidConfig, Message: "static files config is nil"}
+	}
+	return a.Wildcard(cfg.prefix, cfg.serve)
+}
+
+// serve is the handler registered by ServeStatic
+func (c *StaticFilesConfig) serve(ctx *Context) error {
+	if ctx.Method != "GET" && ctx.Method != "HEAD" {
+		ctx.SetHeader("Allow", "GET, HEAD")
+		return ctx.Error(405, "METHOD_NOT_ALLOWED", "Static files only support GET and HEAD")
+	}
+
+	path := c.ResolvePath(ctx.Path)
+	if path == "" {
+		return ctx.Error(404, "NOT_FOUND", "File not found")
+	}
+	f, info, err := c.open(path)
+	if errors.Is(err, fs.ErrNotExist) && c.fallbackFile != "" {
+		path = c.directory + "/" + c.fallbackFile
+		f, info, err = c.open(path)
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return ctx.Error(404, "NOT_FOUND", "File not found")
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	contentType := guessMimeType(f.Name())
+	if c.enablePrecompressed {
+		ctx.addVary("Accept-Encoding")
+		acceptEncoding := ctx.requestHeader("Accept-Encoding")
+		for _, variant := range precompressedEncodings {
+			if !acceptsEncoding(acceptEncoding, variant.coding) {
+				continue
+			}
+			vf, vinfo, err := c.open(f.Name() + variant.suffix)
+			if err != nil {
+				continue
+			}
+			defer vf.Close()
+			f, info = vf, vinfo
+			ctx.SetHeader("Content-Encoding", variant.coding)
+			break
+		}
+	}
+
+	ctx.SetHeader("Cache-Control", fmt.Sprintf("max-age=%d", c.cacheMaxAgeSeconds))
+	if ctx.CheckNotModified(fileETag(info), info.ModTime()) {
+		return nil
+	}
+	return ctx.streamFile(f, info, contentType)
+}
+
+// open opens the regular file at path, or the index file when path is a
+// directory. A missing file or a directory without an index yields an
+// error matching fs.ErrNotExist.
+func (c *StaticFilesConfig) open(path string) (*os.File, fs.FileInfo, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if info.IsDir() {
+		path = strings.TrimRight(path, "/") + "/" + c.indexFile
+		if info, err = os.Stat(path); err != nil {
+			return nil, nil, err
+		}
+	}
+	if !info.Mode().IsRegular() {
+		return nil, nil, &fs.PathError{Op: "open", Path: path, Err: fs.ErrNotExist}
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, info, nil
+}
+
+// acceptsEncoding reports whether an Accept-Encoding header value allows
+// the content coding, either by name or through "*", with a nonzero
+// quality
+func acceptsEncoding(header, coding string) bool {
+	allowed := false
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != coding && name != "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, _ := strings.Cut(param, "=")
+			if strings.TrimSpace(key) == "q" {
+				if v, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if name == coding {
+			// An explicit entry overrides "*"
+			return q > 0
+		}
+		allowed = q > 0
+	}
+	return allowed
+}
+
+// =============================================================================
+// net/http Integration
+// =============================================================================
+
+// ServeHTTP implements http.Handler, so an app can be embedded in an
+// existing net/http server or tested with httptest.Server:
+//
+//	srv := httptest.NewServer(app)
+//	defer srv.Close()
+//
+// Requests are routed by the method and path of the app's contract
+// operations, run through the app's middleware and written to w. Streamed
+// responses are flushed to the client chunk by chunk. HEAD requests are
+// served by the path's GET operation, without the body. The request ID is
+// taken from the X-Request-Id header when present.
+func (a *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if resp := a.corsPreflight(r.Method, r.Header.Get); resp != nil {
+		writeTestResponse(w, r, resp)
+		return
+	}
+
+	op, params, handler, resp := a.route(r.Method, r.URL.Path)
+	if resp != nil {
+		if resp.err != nil {
+			resp = &TestResponse{statusCode: 500, headers: map[string]string{"Content-Type": "application/json"}, body: []byte(errorBody(resp.err))}
+		}
+		writeTestResponse(w, r, resp)
+		return
+	}
 
-// Fallback sets a fallback file for SPA routing.
-func (c *StaticFilesConfig) Fallback(file string) *StaticFilesConfig {
-	c.fallbackFile = file
-	return c
-}
+	// Reject an unmet expectation before the client sends the body. Reading
+	// the body below sends 100 Continue for Expect: 100-continue.
+	maxBodySize := a.operationConfig(op.id).MaxBodySize
+	if expectationFailed(r.Header.Get("Expect"), r.ContentLength, maxBodySize) {
+		writeTestResponse(w, r, newCodeTestResponse(417, "EXPECTATION_FAILED"))
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, int64(maxBodySize)))
+	if err != nil {
+		writeTestResponse(w, r, newCodeTestResponse(413, "PAYLOAD_TOO_LARGE"))
+		return
+	}
 
-// GetDirectory returns the directory path.
-func (c *StaticFilesConfig) GetDirectory() string {
-	return c.directory
-}
+	headers := make(map[string]string, len(r.Header))
+	headersMulti := make(map[string][]string, len(r.Header))
+	for name, values := range r.Header {
+		if len(values) > 0 {
+			headers[name] = values[0]
+		}
+		headersMulti[strings.ToLower(name)] = values
+	}
+	requestID := r.Header.Get("X-Request-Id")
+	if requestID == "" {
+		requestID = uuid.NewString()
+	}
+	ctx := &Context{
+		RequestID:       requestID,
+		OperationID:     op.id,
+		Method:          r.Method,
+		Path:            r.URL.Path,
+		Query:           r.URL.RawQuery,
+		PathParams:      params,
+		Headers:         headers,
+		headersMulti:    headersMulti,
+		body:            body,
+		responseStatus:  200,
+		responseHeaders: make(map[string]string),
+		app:             a,
+		tlsInfo:         httpTLSInfo(r.TLS),
+		RemoteAddr:      r.RemoteAddr,
+		ReceivedAt:      time.Now(),
+		continueSent:    true,
+	}
+	if r.URL.RawPath != "" {
+		ctx.rawPath = r.URL.RawPath
+	}
 
-// GetPrefix returns the URL prefix.
-func (c *StaticFilesConfig) GetPrefix() string {
-	return c.prefix
-}
+	// Stream chunks straight to the client, sending the headers first
+	wroteHeader := false
+	writeHeader := func() {
+		if !wroteHeader {
+			wroteHeader = true
+			writeContextHeaders(w, ctx)
+			w.WriteHeader(ctx.responseStatus)
+		}
+	}
+	flusher, _ := w.(http.Flusher)
+	ctx.chunkSink = func(chunk []byte) error {
+		writeHeader()
+		if r.Method == http.MethodHead {
+			return nil
+		}
+		if _, err := w.Write(chunk); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	}
 
-// GetIndex returns the index file name.
-func (c *StaticFilesConfig) GetIndex() string {
-	return c.indexFile
+	err = a.serve(ctx, handler)
+	if wroteHeader {
+		// The status was sent with the first chunk; a late error can only
+		// end the stream
+		return
+	}
+	if err != nil {
+		writeTestResponse(w, r, ctx.testResponse(err))
+		return
+	}
+	writeHeader()
+	if r.Method != http.MethodHead {
+		w.Write(ctx.responseBody)
+	}
 }
 
-// GetCacheMaxAge returns the cache max age in seconds.
-func (c *StaticFilesConfig) GetCacheMaxAge() uint32 {
-	return c.cacheMaxAgeSeconds
+// writeContextHeaders copies the response headers of ctx, including its
+// cookies and content type, to w
+func writeContextHeaders(w http.ResponseWriter, ctx *Context) {
+	headers, contentType := ctx.finalResponseHeaders()
+	for _, header := range headers {
+		w.Header().Add(header[0], header[1])
+	}
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
 }
 
-// IsPrecompressedEnabled returns whether precompressed files are enabled.
-func (c *StaticFilesConfig) IsPrecompressedEnabled() bool {
-	return c.enablePrecompressed
+// writeTestResponse writes a response built without a handler, or an
+// error response, to w for r
+func writeTestResponse(w http.ResponseWriter, r *http.Request, resp *TestResponse) {
+	for name, value := range resp.headers {
+		w.Header().Set(name, value)
+	}
+	w.WriteHeader(resp.statusCode)
+	if r.Method != http.MethodHead {
+		w.Write(resp.body)
+	}
 }
 
-// GetFallback returns the fallback file if set.
-func (c *StaticFilesConfig) GetFallback() string {
-	return c.fallbackFile
+// httpTLSInfo converts a net/http TLS connection state to the form the FFI
+// layer reports, or nil for plaintext connections
+func httpTLSInfo(state *tls.ConnectionState) *TLSConnectionState {
+	if state == nil {
+		return nil
+	}
+	info := &TLSConnectionState{
+		Version:            strings.Replace(tls.VersionName(state.Version), "TLS 1", "TLSv1", 1),
+		NegotiatedProtocol: state.NegotiatedProtocol,
+		CipherSuite:        tls.CipherSuiteName(state.CipherSuite),
+	}
+	if len(state.PeerCertificates) > 0 {
+		info.PeerSubject = state.PeerCertificates[0].Subject.String()
+	}
+	return info
 }
 
-// ResolvePath resolves a request path to a file path.
-// Returns empty string if the path doesn't match the prefix or is invalid.
-func (c *StaticFilesConfig) ResolvePath(requestPath string) string {
-	if len(requestPath) < len(c.prefix) || requestPath[:len(c.prefix)] != c.prefix {
-		return ""
+// route finds the contract operation and handler serving method and path.
+// For a request that reaches no handler it returns the response to send
+// instead: 404 for unknown paths, 405 for known paths with another method,
+// 501 for operations without a registered handler, and a response carrying
+// the error if the contract cannot be loaded.
+func (a *App) route(method, path string) (contractOperation, map[string]string, Handler, *TestResponse) {
+	contract, err := a.loadContract()
+	if err != nil {
+		return contractOperation{}, nil, nil, &TestResponse{
+			headers: make(map[string]string),
+			body:    []byte{},
+			err:     err,
+		}
 	}
-
-	relative := requestPath[len(c.prefix):]
-	for len(relative) > 0 && relative[0] == '/' {
-		relative = relative[1:]
+	op, params, pathMatched, ok := contract.route(method, path)
+	if !ok && method == http.MethodHead {
+		// HEAD requests are served by the GET operation, without a body
+		op, params, pathMatched, ok = contract.route(http.MethodGet, path)
 	}
-
-	// Prevent directory traversal
-	if len(relative) >= 2 {
-		for i := 0; i < len(relative)-1; i++ {
-			if relative[i] == '.' && relative[i+1] == '.' {
-				return ""
-			}
+	if !ok {
+		if pathMatched {
+			return op, nil, nil, newCodeTestResponse(405, "METHOD_NOT_ALLOWED")
+		}
+		if handler, rest, ok := a.matchWildcard(path); ok {
+			return contractOperation{}, map[string]string{wildcardParam: rest}, handler, nil
 		}
+		return op, nil, nil, newCodeTestResponse(404, "NOT_FOUND")
 	}
 
-	if relative == "" {
-		return c.directory + "/" + c.indexFile
+	a.mu.RLock()
+	handler, ok := a.handlers[op.id]
+	a.mu.RUnlock()
+	if !ok {
+		return op, nil, nil, newCodeTestResponse(501, "NOT_IMPLEMENTED")
+	}
+	return op, params, handler, nil
+}
+
+// newCodeTestResponse returns a JSON response with only an error code, as
+// sent for requests that reach no handler
+func newCodeTestResponse(status int, code string) *TestResponse {
+	return &TestResponse{
+		statusCode: status,
+		headers:    map[string]string{"Content-Type": "application/json"},
+		body:       []byte(fmt.Sprintf(`{"code":%q}`, code)),
 	}
-	return c.directory + "/" + relative
 }
 
 // =============================================================================
@@ -1945,7 +8341,9 @@ func (c *StaticFilesConfig) ResolvePath(requestPath string) string {
 // =============================================================================
 
 // TestClient provides an HTTP client for testing Archimedes handlers.
-// It simulates HTTP requests without starting a real server.
+// It simulates HTTP requests without starting a real server: requests go
+// through the FFI test client, which routes them by the method and path of
+// the app's contract operations and calls the registered handlers.
 //
 // Example usage:
 //
@@ -1959,6 +8357,11 @@ func (c *StaticFilesConfig) ResolvePath(requestPath string) string {
 type TestClient struct {
 	app            *App
 	defaultHeaders map[string]string
+	remoteAddr     string
+
+	// failNext is the error the next request fails with, set by FailNext
+	failMu   sync.Mutex
+	failNext error
 }
 
 // NewTestClient creates a test client for the given app.
@@ -1966,9 +8369,18 @@ func NewTestClient(app *App) *TestClient {
 	return &TestClient{
 		app:            app,
 		defaultHeaders: make(map[string]string),
+		remoteAddr:     "192.0.2.1:1234",
 	}
 }
 
+// WithRemoteAddr sets the peer address ("ip:port") requests appear to come
+// from, as seen by Context.RemoteAddr and ClientIP (default:
+// "192.0.2.1:1234").
+func (c *TestClient) WithRemoteAddr(addr string) *TestClient {
+	c.remoteAddr = addr
+	return c
+}
+
 // WithHeader adds a default header to all requests.
 func (c *TestClient) WithHeader(name, value string) *TestClient {
 	c.defaultHeaders[name] = value
@@ -2002,10 +8414,69 @@ func (c *TestClient) PostJSON(path string, data interface{}) *TestResponse {
 			err:        fmt.Errorf("failed to marshal JSON: %w", err),
 		}
 	}
-	c.defaultHeaders["Content-Type"] = "application/json"
-	resp := c.request("POST", path, body)
-	delete(c.defaultHeaders, "Content-Type")
-	return resp
+	return c.requestWithContentType("POST", path, "application/json", body)
+}
+
+// PostForm performs a POST request with values as a URL-encoded form
+// body and Content-Type application/x-www-form-urlencoded, which replaces
+// any default Content-Type header for this request.
+func (c *TestClient) PostForm(path string, values url.Values) *TestResponse {
+	return c.requestWithContentType("POST", path, "application/x-www-form-urlencoded", []byte(values.Encode()))
+}
+
+// PostFormMap is like PostForm for forms with one value per field.
+func (c *TestClient) PostFormMap(path string, fields map[string]string) *TestResponse {
+	values := make(url.Values, len(fields))
+	for name, value := range fields {
+		values.Set(name, value)
+	}
+	return c.PostForm(path, values)
+}
+
+// quoteEscaper escapes a multipart Content-Disposition parameter value
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// TestFile is a file uploaded by PostMultipart.
+type TestFile struct {
+	Filename    string
+	ContentType string // default: application/octet-stream
+	Data        []byte
+}
+
+// PostMultipart performs a POST request with a multipart/form-data body
+// holding fields and files, keyed by form field name, each in name order.
+// The boundary is random and set in the Content-Type header, which replaces
+// any default Content-Type header for this request.
+func (c *TestClient) PostMultipart(path string, fields map[string]string, files map[string]TestFile) *TestResponse {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, name := range slices.Sorted(maps.Keys(fields)) {
+		if err := mw.WriteField(name, fields[name]); err != nil {
+			return &TestResponse{headers: make(map[string]string), body: []byte{}, err: err}
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		file := files[name]
+		contentType := file.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, quoteEscaper.Replace(name), quoteEscaper.Replace(file.Filename)))
+		header.Set("Content-Type", contentType)
+		part, err := mw.CreatePart(header)
+		if err == nil {
+			_, err = part.Write(file.Data)
+		}
+		if err != nil {
+			return &TestResponse{headers: make(map[string]string), body: []byte{}, err: err}
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return &TestResponse{headers: make(map[string]string), body: []byte{}, err: err}
+	}
+
+	return c.requestWithContentType("POST", path, mw.FormDataContentType(), body.Bytes())
 }
 
 // Put performs a PUT request with a body.
@@ -2024,10 +8495,7 @@ func (c *TestClient) PutJSON(path string, data interface{}) *TestResponse {
 			err:        fmt.Errorf("failed to marshal JSON: %w", err),
 		}
 	}
-	c.defaultHeaders["Content-Type"] = "application/json"
-	resp := c.request("PUT", path, body)
-	delete(c.defaultHeaders, "Content-Type")
-	return resp
+	return c.requestWithContentType("PUT", path, "application/json", body)
 }
 
 // Patch performs a PATCH request with a body.
@@ -2046,10 +8514,7 @@ func (c *TestClient) PatchJSON(path string, data interface{}) *TestResponse {
 			err:        fmt.Errorf("failed to marshal JSON: %w", err),
 		}
 	}
-	c.defaultHeaders["Content-Type"] = "application/json"
-	resp := c.request("PATCH", path, body)
-	delete(c.defaultHeaders, "Content-Type")
-	return resp
+	return c.requestWithContentType("PATCH", path, "application/json", body)
 }
 
 // Delete performs a DELETE request.
@@ -2067,18 +8532,229 @@ func (c *TestClient) Head(path string) *TestResponse {
 	return c.request("HEAD", path, nil)
 }
 
-// request performs an HTTP request (mock implementation).
-// TODO: Integrate with actual FFI test_client when available
+// GetWithQuery performs a GET request with params appended to path as a
+// query string.
+func (c *TestClient) GetWithQuery(path string, params map[string]string) *TestResponse {
+	return c.request("GET", withQuery(path, params), nil)
+}
+
+// PostWithQuery performs a POST request with a body and params appended to
+// path as a query string.
+func (c *TestClient) PostWithQuery(path string, params map[string]string, body []byte) *TestResponse {
+	return c.request("POST", withQuery(path, params), body)
+}
+
+// PutWithQuery performs a PUT request with a body and params appended to
+// path as a query string.
+func (c *TestClient) PutWithQuery(path string, params map[string]string, body []byte) *TestResponse {
+	return c.request("PUT", withQuery(path, params), body)
+}
+
+// PatchWithQuery performs a PATCH request with a body and params appended
+// to path as a query string.
+func (c *TestClient) PatchWithQuery(path string, params map[string]string, body []byte) *TestResponse {
+	return c.request("PATCH", withQuery(path, params), body)
+}
+
+// DeleteWithQuery performs a DELETE request with params appended to path as
+// a query string.
+func (c *TestClient) DeleteWithQuery(path string, params map[string]string) *TestResponse {
+	return c.request("DELETE", withQuery(path, params), nil)
+}
+
+// withQuery appends params to path, sorted by key, after any query string
+// path already has
+func withQuery(path string, params map[string]string) string {
+	if len(params) == 0 {
+		return path
+	}
+	q := NewQueryBuilder()
+	for _, key := range slices.Sorted(maps.Keys(params)) {
+		q.Add(key, params[key])
+	}
+	if strings.Contains(path, "?") {
+		return path + "&" + q.Build()
+	}
+	return path + "?" + q.Build()
+}
+
+// QueryBuilder builds a URL-encoded query string, keeping parameters in
+// the order they were added. Add a key more than once for a multi-value
+// parameter.
+//
+//	query := archimedes.NewQueryBuilder().
+//	    Add("tag", "a b").
+//	    Add("tag", "c").
+//	    Build() // "tag=a+b&tag=c"
+type QueryBuilder struct {
+	params [][2]string
+}
+
+// NewQueryBuilder creates an empty query builder.
+func NewQueryBuilder() *QueryBuilder {
+	return &QueryBuilder{}
+}
+
+// Add appends a key/value pair.
+func (q *QueryBuilder) Add(key, value string) *QueryBuilder {
+	q.params = append(q.params, [2]string{key, value})
+	return q
+}
+
+// Build returns the query string, without a leading "?", with every key
+// and value escaped by url.QueryEscape.
+func (q *QueryBuilder) Build() string {
+	var b strings.Builder
+	for i, param := range q.params {
+		if i > 0 {
+			b.WriteByte('&')
+		}
+		b.WriteString(url.QueryEscape(param[0]))
+		b.WriteByte('=')
+		b.WriteString(url.QueryEscape(param[1]))
+	}
+	return b.String()
+}
+
+// request performs an HTTP request through the FFI test client, which routes
+// it by the contract and calls the registered handler. CORS preflights and
+// wildcard routes are served by the Go layer, as in ServeHTTP.
 func (c *TestClient) request(method, path string, body []byte) *TestResponse {
-	// This is a mock implementation until the FFI TestClient is integrated.
-	// For now, we return a placeholder response.
-	// In a real implementation, this would call the FFI functions:
-	// C.archimedes_test_client_request(...)
-	return &TestResponse{
-		statusCode: 200,
+	return c.requestWithContentType(method, path, "", body)
+}
+
+// requestWithContentType is like request, sending contentType (if set) in
+// place of any default Content-Type header. The client's default headers
+// are left unchanged, so concurrent requests do not interfere.
+func (c *TestClient) requestWithContentType(method, path, contentType string, body []byte) *TestResponse {
+	c.failMu.Lock()
+	failErr := c.failNext
+	c.failNext = nil
+	c.failMu.Unlock()
+	if failErr != nil {
+		return &TestResponse{
+			headers: make(map[string]string),
+			body:    []byte{},
+			err:     failErr,
+		}
+	}
+
+	headers := make(map[string]string, len(c.defaultHeaders)+1)
+	for name, value := range c.defaultHeaders {
+		if contentType == "" || !strings.EqualFold(name, "Content-Type") {
+			headers[name] = value
+		}
+	}
+	if contentType != "" {
+		headers["Content-Type"] = contentType
+	}
+	if resp := c.app.corsPreflight(method, (&Context{Headers: headers}).requestHeader); resp != nil {
+		return resp
+	}
+
+	resp := c.dispatch(method, path, headers, body)
+	if resp.statusCode == 404 {
+		routePath, query, _ := strings.Cut(path, "?")
+		if handler, rest, ok := c.app.matchWildcard(routePath); ok {
+			ctx := &Context{
+				RequestID:       uuid.NewString(),
+				Method:          method,
+				Path:            routePath,
+				Query:           query,
+				PathParams:      map[string]string{wildcardParam: rest},
+				Headers:         headers,
+				RemoteAddr:      c.remoteAddr,
+				body:            body,
+				responseStatus:  200,
+				responseHeaders: make(map[string]string),
+				app:             c.app,
+				ReceivedAt:      time.Now(),
+				continueSent:    true,
+			}
+			return ctx.testResponse(c.app.serve(ctx, handler))
+		}
+	}
+	return resp
+}
+
+// dispatch sends a request to the app through the FFI test client. The
+// first value of each response header is kept.
+func (c *TestClient) dispatch(method, path string, headers map[string]string, body []byte) *TestResponse {
+	client := C.archimedes_test_client_for_app(c.app.handle)
+	if client == nil {
+		return &TestResponse{
+			headers: make(map[string]string),
+			body:    []byte{},
+			err:     &Error{Code: ErrNullPointer, Message: C.GoString(C.archimedes_last_error())},
+		}
+	}
+	defer C.archimedes_test_client_free(client)
+
+	cRemoteAddr := C.CString(c.remoteAddr)
+	C.archimedes_test_client_with_remote_addr(client, cRemoteAddr)
+	C.free(unsafe.Pointer(cRemoteAddr))
+	for name, value := range headers {
+		cName := C.CString(name)
+		cValue := C.CString(value)
+		C.archimedes_test_client_with_header(client, cName, cValue)
+		C.free(unsafe.Pointer(cName))
+		C.free(unsafe.Pointer(cValue))
+	}
+
+	cMethod := C.CString(method)
+	defer C.free(unsafe.Pointer(cMethod))
+	cPath := C.CString(path)
+	defer C.free(unsafe.Pointer(cPath))
+	var cBody *C.uint8_t
+	if len(body) > 0 {
+		cBody = (*C.uint8_t)(C.CBytes(body))
+		defer C.free(unsafe.Pointer(cBody))
+	}
+
+	cResp := C.archimedes_test_client_request(client, cMethod, cPath, cBody, C.size_t(len(body)))
+	if cResp == nil {
+		return &TestResponse{
+			headers: make(map[string]string),
+			body:    []byte{},
+			err:     &Error{Code: ErrInternal, Message: C.GoString(C.archimedes_last_error())},
+		}
+	}
+	defer C.archimedes_test_response_free(cResp)
+
+	resp := &TestResponse{
+		statusCode: int(C.archimedes_test_response_status_code(cResp)),
 		headers:    make(map[string]string),
-		body:       []byte(`{"status":"mock_response"}`),
+		body:       []byte{},
+		chunks:     int(C.archimedes_test_response_chunk_count(cResp)),
+		continued:  bool(C.archimedes_test_response_continued(cResp)),
 	}
+	count := C.archimedes_test_response_header_count(cResp)
+	for i := C.size_t(0); i < count; i++ {
+		var name, value *C.uint8_t
+		var nameLen, valueLen C.size_t
+		if !C.archimedes_test_response_header_at(cResp, i, &name, &nameLen, &value, &valueLen) {
+			break
+		}
+		key := string(C.GoBytes(unsafe.Pointer(name), C.int(nameLen)))
+		if _, ok := resp.headers[key]; !ok {
+			resp.headers[key] = string(C.GoBytes(unsafe.Pointer(value), C.int(valueLen)))
+		}
+	}
+	var bodyLen C.size_t
+	if data := C.archimedes_test_response_body(cResp, &bodyLen); data != nil {
+		resp.body = C.GoBytes(unsafe.Pointer(data), C.int(bodyLen))
+	}
+	return resp
+}
+
+// FailNext makes the next request fail with err instead of reaching the
+// app, simulating a transport failure such as a refused connection. The
+// response has a zero status and Error returns err. Later requests are
+// dispatched normally.
+func (c *TestClient) FailNext(err error) {
+	c.failMu.Lock()
+	c.failNext = err
+	c.failMu.Unlock()
 }
 
 // Close releases resources associated with the test client.
@@ -2092,6 +8768,12 @@ type TestResponse struct {
 	headers    map[string]string
 	body       []byte
 	err        error
+
+	// chunks is the number of chunks a streamed body arrived in (0 if the
+	// handler's response was buffered)
+	chunks int
+	// continued records that 100 Continue preceded the response
+	continued bool
 }
 
 // StatusCode returns the HTTP status code.
@@ -2155,6 +8837,16 @@ func (r *TestResponse) Error() error {
 	return r.err
 }
 
+// AssertError asserts the request failed with an error matching target,
+// as reported by errors.Is.
+// Returns the response for chaining.
+func (r *TestResponse) AssertError(target error) *TestResponse {
+	if !errors.Is(r.err, target) {
+		panic(fmt.Sprintf("expected error %v, got %v", target, r.err))
+	}
+	return r
+}
+
 // AssertStatus asserts the response has the expected status code.
 // Returns the response for chaining.
 func (r *TestResponse) AssertStatus(expected int) *TestResponse {
@@ -2228,6 +8920,250 @@ func (r *TestResponse) AssertJSON(expected interface{}) *TestResponse {
 	return r
 }
 
+// MatchSnapshot compares the body against the snapshot file
+// testdata/snapshots/<name>.json, relative to the test's package
+// directory. The first run, or any run with UPDATE_SNAPSHOTS=true, writes
+// the snapshot instead. JSON bodies are compared re-indented with sorted
+// object keys, so key order does not matter; other bodies are compared
+// as is. A mismatch fails t with a go-cmp diff. Returns the response for
+// chaining.
+func (r *TestResponse) MatchSnapshot(t testing.TB, name string) *TestResponse {
+	t.Helper()
+	actual := normalizeSnapshot(r.body)
+	path := filepath.Join("testdata", "snapshots", name+".json")
+
+	expected, err := os.ReadFile(path)
+	if os.Getenv("UPDATE_SNAPSHOTS") == "true" || errors.Is(err, fs.ErrNotExist) {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("failed to create snapshot directory: %v", err)
+		}
+		if err := os.WriteFile(path, actual, 0o644); err != nil {
+			t.Fatalf("failed to write snapshot %s: %v", path, err)
+		}
+		t.Logf("wrote snapshot %s", path)
+		return r
+	}
+	if err != nil {
+		t.Fatalf("failed to read snapshot %s: %v", path, err)
+	}
+
+	if expected := normalizeSnapshot(expected); !bytes.Equal(expected, actual) {
+		t.Errorf("response does not match snapshot %s (-snapshot +response):\n%s\nrun with UPDATE_SNAPSHOTS=true to update it",
+			path, cmp.Diff(string(expected), string(actual)))
+	}
+	return r
+}
+
+// normalizeSnapshot re-indents a JSON body with sorted object keys and a
+// trailing newline; bodies that are not JSON are returned unchanged
+func normalizeSnapshot(body []byte) []byte {
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return body
+	}
+	normalized, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return body
+	}
+	return append(normalized, '\n')
+}
+
+// AssertJSONSchema asserts the JSON body conforms to a JSON Schema
+// (draft-07), to check response shapes in contract-first tests:
+//
+//	resp.AssertJSONSchema(`{
+//	    "type": "object",
+//	    "required": ["id", "email"],
+//	    "properties": {"id": {"type": "string", "minLength": 1}}
+//	}`)
+//
+// It supports type, enum, properties, required, additionalProperties,
+// items, minLength, maxLength, pattern, format, minimum and maximum, and
+// $ref to "#/definitions/...". Other keywords are ignored. On failure the panic
+// message lists every violation. Returns the response for chaining.
+func (r *TestResponse) AssertJSONSchema(schema string) *TestResponse {
+	var root map[string]any
+	if err := json.Unmarshal([]byte(schema), &root); err != nil {
+		panic(fmt.Sprintf("invalid JSON schema: %v", err))
+	}
+	var doc any
+	if err := json.Unmarshal(r.body, &doc); err != nil {
+		panic(fmt.Sprintf("failed to unmarshal actual JSON: %v", err))
+	}
+
+	definitions, _ := root["definitions"].(map[string]any)
+	spec := &contractSpec{schemas: definitions, refPrefix: "#/definitions/"}
+	var fields []FieldError
+	spec.validate(root, doc, "", &fields)
+	if len(fields) > 0 {
+		messages := make([]string, len(fields))
+		for i, f := range fields {
+			messages[i] = f.Message
+		}
+		panic(fmt.Sprintf("response does not match JSON schema:\n  %s\nbody: %s", strings.Join(messages, "\n  "), string(r.body)))
+	}
+	return r
+}
+
+// AssertJSONPath asserts the value at a JSONPath expression in the JSON
+// body equals expected, compared as JSON like AssertJSON:
+//
+//	resp.AssertJSONPath("$.total", 2).
+//	    AssertJSONPath("$.users[0].email", "alice@example.com").
+//	    AssertJSONPath("$.users[*].id", []string{"1", "2"})
+//
+// The path supports dot notation ($.a.b), bracketed keys ($['a b']),
+// array indexes ($.users[0]) and wildcards over array elements or object
+// values ($.users[*], $.*). A path with a wildcard matches a list, which
+// is compared against expected as a JSON array; object values are listed
+// in key order. Returns the response for chaining.
+func (r *TestResponse) AssertJSONPath(path string, expected any) *TestResponse {
+	var doc any
+	if err := json.Unmarshal(r.body, &doc); err != nil {
+		panic(fmt.Sprintf("failed to unmarshal actual JSON: %v", err))
+	}
+	segments, err := parseJSONPath(path)
+	if err != nil {
+		panic(err.Error())
+	}
+	matches := evalJSONPath(doc, segments)
+
+	var actual any = matches
+	if !hasJSONPathWildcard(segments) {
+		if len(matches) == 0 {
+			panic(fmt.Sprintf("no value at JSON path %s in %s", path, string(r.body)))
+		}
+		actual = matches[0]
+	}
+
+	expectedJSON, err := json.Marshal(expected)
+	if err != nil {
+		panic(fmt.Sprintf("failed to marshal expected JSON: %v", err))
+	}
+	var expectedVal any
+	if err := json.Unmarshal(expectedJSON, &expectedVal); err != nil {
+		panic(fmt.Sprintf("failed to unmarshal expected JSON: %v", err))
+	}
+	if !jsonEqual(expectedVal, actual) {
+		actualJSON, _ := json.Marshal(actual)
+		panic(fmt.Sprintf("expected JSON path %s to be %s, got %s", path, string(expectedJSON), string(actualJSON)))
+	}
+	return r
+}
+
+// jsonPathSegment is one step of a JSONPath: an object key, an array
+// index, or a wildcard
+type jsonPathSegment struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// parseJSONPath parses the subset of JSONPath AssertJSONPath supports
+func parseJSONPath(path string) ([]jsonPathSegment, error) {
+	rest, ok := strings.CutPrefix(path, "$")
+	if !ok {
+		return nil, fmt.Errorf("invalid JSON path %q: must start with $", path)
+	}
+
+	var segments []jsonPathSegment
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			name := rest[:end]
+			rest = rest[end:]
+			switch name {
+			case "":
+				return nil, fmt.Errorf("invalid JSON path %q: empty key", path)
+			case "*":
+				segments = append(segments, jsonPathSegment{wildcard: true})
+			default:
+				segments = append(segments, jsonPathSegment{key: name})
+			}
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid JSON path %q: unclosed [", path)
+			}
+			inner := rest[1:end]
+			rest = rest[end+1:]
+			switch {
+			case inner == "*":
+				segments = append(segments, jsonPathSegment{wildcard: true})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				segments = append(segments, jsonPathSegment{key: inner[1 : len(inner)-1]})
+			default:
+				index, err := strconv.Atoi(inner)
+				if err != nil || index < 0 {
+					return nil, fmt.Errorf("invalid JSON path %q: bad index [%s]", path, inner)
+				}
+				segments = append(segments, jsonPathSegment{index: index, isIndex: true})
+			}
+		default:
+			return nil, fmt.Errorf("invalid JSON path %q: unexpected %q", path, rest[0])
+		}
+	}
+	return segments, nil
+}
+
+// evalJSONPath returns the values in doc matched by segments
+func evalJSONPath(doc any, segments []jsonPathSegment) []any {
+	current := []any{doc}
+	for _, seg := range segments {
+		var next []any
+		for _, v := range current {
+			switch v := v.(type) {
+			case map[string]any:
+				if seg.wildcard {
+					for _, key := range slices.Sorted(maps.Keys(v)) {
+						next = append(next, v[key])
+					}
+				} else if val, ok := v[seg.key]; ok && !seg.isIndex {
+					next = append(next, val)
+				}
+			case []any:
+				if seg.wildcard {
+					next = append(next, v...)
+				} else if seg.isIndex && seg.index < len(v) {
+					next = append(next, v[seg.index])
+				}
+			}
+		}
+		current = next
+	}
+	return current
+}
+
+// hasJSONPathWildcard reports whether a path can match more than one value
+func hasJSONPathWildcard(segments []jsonPathSegment) bool {
+	return slices.ContainsFunc(segments, func(seg jsonPathSegment) bool { return seg.wildcard })
+}
+
+// CollectNDJSON decodes a newline-delimited JSON response body into a slice.
+// Blank lines are skipped.
+func CollectNDJSON[T any](resp *TestResponse) ([]T, error) {
+	if resp.err != nil {
+		return nil, resp.err
+	}
+	dec := json.NewDecoder(strings.NewReader(string(resp.body)))
+	var items []T
+	for {
+		var item T
+		if err := dec.Decode(&item); err == io.EOF {
+			return items, nil
+		} else if err != nil {
+			return items, fmt.Errorf("invalid NDJSON item %d: %w", len(items), err)
+		}
+		items = append(items, item)
+	}
+}
+
 // jsonEqual recursively compares two JSON values.
 func jsonEqual(a, b interface{}) bool {
 	switch aVal := a.(type) {
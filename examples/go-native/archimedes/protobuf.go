@@ -0,0 +1,47 @@
+//go:build protobuf
+
+package archimedes
+
+import (
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// =============================================================================
+// Protobuf
+// =============================================================================
+//
+// Protobuf support is optional; build with -tags protobuf to enable it.
+
+func init() {
+	defaultDecoders["application/protobuf"] = decodeProtobuf
+	defaultDecoders["application/x-protobuf"] = decodeProtobuf
+}
+
+// decodeProtobuf decodes a Protobuf body for Context.Bind
+func decodeProtobuf(data []byte, v any) error {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("cannot bind protobuf body into %T: not a proto.Message", v)
+	}
+	return proto.Unmarshal(data, msg)
+}
+
+// Protobuf sends a Protobuf-encoded response
+func (c *Context) Protobuf(status int, msg proto.Message) error {
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return c.Blob(status, "application/protobuf", data)
+}
+
+// BindProtobuf decodes the Protobuf request body into msg
+func (c *Context) BindProtobuf(msg proto.Message) error {
+	if len(c.body) == 0 {
+		return errors.New("empty request body")
+	}
+	return proto.Unmarshal(c.body, msg)
+}
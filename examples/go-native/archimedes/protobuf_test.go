@@ -0,0 +1,49 @@
+//go:build protobuf
+
+package archimedes
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestProtobufResponse(t *testing.T) {
+	ctx := &Context{}
+	if err := ctx.Protobuf(200, wrapperspb.String("hello")); err != nil {
+		t.Fatalf("Protobuf() error = %v", err)
+	}
+	if ctx.contentType != "application/protobuf" {
+		t.Errorf("contentType = %v, want application/protobuf", ctx.contentType)
+	}
+
+	var msg wrapperspb.StringValue
+	if err := proto.Unmarshal(ctx.responseBody, &msg); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if msg.GetValue() != "hello" {
+		t.Errorf("Value = %v, want hello", msg.GetValue())
+	}
+}
+
+func TestBindProtobuf(t *testing.T) {
+	body, err := proto.Marshal(wrapperspb.Int64(42))
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	ctx := &Context{body: body, Headers: map[string]string{"content-type": "application/protobuf"}}
+	var msg wrapperspb.Int64Value
+	if err := ctx.Bind(&msg); err != nil {
+		t.Fatalf("Bind() error = %v", err)
+	}
+	if msg.GetValue() != 42 {
+		t.Errorf("Value = %v, want 42", msg.GetValue())
+	}
+
+	var notProto struct{ Value int64 }
+	if err := ctx.Bind(&notProto); err == nil {
+		t.Error("expected error binding protobuf body into a non-proto value")
+	}
+}
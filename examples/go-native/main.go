@@ -11,8 +11,12 @@
 package main
 
 import (
+	"encoding/csv"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"sort"
 	"sync"
 	"time"
 
@@ -56,11 +60,19 @@ type UsersResponse struct {
 	Total int    `json:"total"`
 }
 
-// ErrorResponse is the error response format.
-type ErrorResponse struct {
-	Code      string `json:"code"`
-	Message   string `json:"message"`
-	RequestID string `json:"request_id,omitempty"`
+// bindErrorResponse renders a BindValid error: 422 with the failing fields
+// for schema violations, 400 for malformed bodies.
+func bindErrorResponse(ctx *archimedes.Context, err error) error {
+	var ve *archimedes.ValidationError
+	if errors.As(err, &ve) {
+		return ctx.JSON(422, archimedes.ErrorResponse{
+			Code:      "VALIDATION_FAILED",
+			Message:   ve.Message,
+			RequestID: ctx.RequestID,
+			Fields:    ve.Fields,
+		})
+	}
+	return ctx.Error(400, "INVALID_REQUEST", "Invalid request body")
 }
 
 // =============================================================================
@@ -98,6 +110,13 @@ func (s *userStore) List() []User {
 	for _, u := range s.users {
 		users = append(users, u)
 	}
+	// Order by creation so pages are stable
+	sort.Slice(users, func(i, j int) bool {
+		if len(users[i].ID) != len(users[j].ID) {
+			return len(users[i].ID) < len(users[j].ID)
+		}
+		return users[i].ID < users[j].ID
+	})
 	return users
 }
 
@@ -215,9 +234,9 @@ func main() {
 	// Register handlers
 	registerHandlers(app)
 
-	// Start server
+	// Start server; runs lifecycle hooks and stops on SIGINT/SIGTERM
 	log.Println("Server starting on :8003")
-	if err := app.Run(":8003"); err != nil {
+	if err := app.RunWithGracefulShutdown(); err != nil {
 		log.Fatalf("Server error: %v", err)
 	}
 }
@@ -232,11 +251,24 @@ func registerHandlers(app *archimedes.App) {
 		})
 	})
 
-	// List users
+	// List users, paged with ?limit=&offset=
 	app.Operation("listUsers", func(ctx *archimedes.Context) error {
 		users := store.List()
+		page := ctx.Pagination(20, 100)
+
+		start := min(page.Offset, len(users))
+		end := min(start+page.Limit, len(users))
+		var next, prev string
+		if end < len(users) {
+			next = fmt.Sprintf("/users?limit=%d&offset=%d", page.Limit, end)
+		}
+		if start > 0 {
+			prev = fmt.Sprintf("/users?limit=%d&offset=%d", page.Limit, max(start-page.Limit, 0))
+		}
+		ctx.LinkHeader(next, prev)
+
 		return ctx.JSON(200, UsersResponse{
-			Users: users,
+			Users: users[start:end],
 			Total: len(users),
 		})
 	})
@@ -245,20 +277,12 @@ func registerHandlers(app *archimedes.App) {
 	app.Operation("getUser", func(ctx *archimedes.Context) error {
 		userID := ctx.PathParam("userId")
 		if userID == "" {
-			return ctx.JSON(400, ErrorResponse{
-				Code:      "MISSING_USER_ID",
-				Message:   "User ID is required",
-				RequestID: ctx.RequestID,
-			})
+			return ctx.Error(400, "MISSING_USER_ID", "User ID is required")
 		}
 
 		user, ok := store.Get(userID)
 		if !ok {
-			return ctx.JSON(404, ErrorResponse{
-				Code:      "USER_NOT_FOUND",
-				Message:   fmt.Sprintf("User with ID %s not found", userID),
-				RequestID: ctx.RequestID,
-			})
+			return ctx.Errorf(404, "USER_NOT_FOUND", "User with ID %s not found", userID)
 		}
 
 		return ctx.JSON(200, user)
@@ -266,30 +290,18 @@ func registerHandlers(app *archimedes.App) {
 
 	// Create user
 	app.Operation("createUser", func(ctx *archimedes.Context) error {
-		var req CreateUserRequest
-		if err := ctx.Bind(&req); err != nil {
-			return ctx.JSON(400, ErrorResponse{
-				Code:      "INVALID_REQUEST",
-				Message:   "Invalid request body",
-				RequestID: ctx.RequestID,
-			})
+		if err := ctx.RequireAuth(); err != nil {
+			return err
 		}
 
-		if req.Name == "" || req.Email == "" {
-			return ctx.JSON(400, ErrorResponse{
-				Code:      "INVALID_REQUEST",
-				Message:   "Name and email are required",
-				RequestID: ctx.RequestID,
-			})
+		var req CreateUserRequest
+		if err := ctx.BindValid(&req); err != nil {
+			return bindErrorResponse(ctx, err)
 		}
 
 		// Check for duplicate email
 		if store.EmailExists(req.Email, "") {
-			return ctx.JSON(409, ErrorResponse{
-				Code:      "DUPLICATE_EMAIL",
-				Message:   fmt.Sprintf("User with email %s already exists", req.Email),
-				RequestID: ctx.RequestID,
-			})
+			return ctx.Errorf(409, "DUPLICATE_EMAIL", "User with email %s already exists", req.Email)
 		}
 
 		user := store.Create(req.Name, req.Email)
@@ -300,38 +312,22 @@ func registerHandlers(app *archimedes.App) {
 	app.Operation("updateUser", func(ctx *archimedes.Context) error {
 		userID := ctx.PathParam("userId")
 		if userID == "" {
-			return ctx.JSON(400, ErrorResponse{
-				Code:      "MISSING_USER_ID",
-				Message:   "User ID is required",
-				RequestID: ctx.RequestID,
-			})
+			return ctx.Error(400, "MISSING_USER_ID", "User ID is required")
 		}
 
 		var req UpdateUserRequest
-		if err := ctx.Bind(&req); err != nil {
-			return ctx.JSON(400, ErrorResponse{
-				Code:      "INVALID_REQUEST",
-				Message:   "Invalid request body",
-				RequestID: ctx.RequestID,
-			})
+		if err := ctx.BindValid(&req); err != nil {
+			return bindErrorResponse(ctx, err)
 		}
 
 		// Check for duplicate email
 		if req.Email != nil && store.EmailExists(*req.Email, userID) {
-			return ctx.JSON(409, ErrorResponse{
-				Code:      "DUPLICATE_EMAIL",
-				Message:   fmt.Sprintf("User with email %s already exists", *req.Email),
-				RequestID: ctx.RequestID,
-			})
+			return ctx.Errorf(409, "DUPLICATE_EMAIL", "User with email %s already exists", *req.Email)
 		}
 
 		user, ok := store.Update(userID, req.Name, req.Email)
 		if !ok {
-			return ctx.JSON(404, ErrorResponse{
-				Code:      "USER_NOT_FOUND",
-				Message:   fmt.Sprintf("User with ID %s not found", userID),
-				RequestID: ctx.RequestID,
-			})
+			return ctx.Errorf(404, "USER_NOT_FOUND", "User with ID %s not found", userID)
 		}
 
 		return ctx.JSON(200, user)
@@ -341,39 +337,62 @@ func registerHandlers(app *archimedes.App) {
 	app.Operation("deleteUser", func(ctx *archimedes.Context) error {
 		userID := ctx.PathParam("userId")
 		if userID == "" {
-			return ctx.JSON(400, ErrorResponse{
-				Code:      "MISSING_USER_ID",
-				Message:   "User ID is required",
-				RequestID: ctx.RequestID,
-			})
+			return ctx.Error(400, "MISSING_USER_ID", "User ID is required")
 		}
 
 		if !store.Delete(userID) {
-			return ctx.JSON(404, ErrorResponse{
-				Code:      "USER_NOT_FOUND",
-				Message:   fmt.Sprintf("User with ID %s not found", userID),
-				RequestID: ctx.RequestID,
-			})
+			return ctx.Errorf(404, "USER_NOT_FOUND", "User with ID %s not found", userID)
 		}
 
 		return ctx.NoContent()
 	})
 
+	// Export users as CSV, streamed in chunks rather than built in memory
+	app.Operation("exportUsers", func(ctx *archimedes.Context) error {
+		return ctx.Stream(200, "text/csv", func(w io.Writer) error {
+			out := csv.NewWriter(w)
+			if err := out.Write([]string{"id", "name", "email", "created_at"}); err != nil {
+				return err
+			}
+			for _, user := range store.List() {
+				if err := out.Write([]string{user.ID, user.Name, user.Email, user.CreatedAt}); err != nil {
+					return err
+				}
+			}
+			out.Flush()
+			return out.Error()
+		})
+	})
+
+	// Stream a counter as Server-Sent Events, one event per second
+	app.Operation("streamCounter", func(ctx *archimedes.Context) error {
+		stream, err := ctx.SSEStream()
+		if err != nil {
+			return err
+		}
+		defer stream.Close()
+
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for count := 1; count <= 10; count++ {
+			if err := stream.Send("counter", fmt.Sprint(count)); err != nil {
+				// Client disconnected
+				return nil
+			}
+			<-ticker.C
+		}
+		return nil
+	})
+
 	// =========================================================================
 	// Admin Router (sub-router example)
 	// =========================================================================
-	adminRouter := archimedes.NewRouter().
-		Prefix("/admin").
-		Tag("admin").
-		Tag("internal")
-
-	adminRouter.Operation("getStats", func(ctx *archimedes.Context) error {
-		users := store.List()
-		return ctx.JSON(200, map[string]any{
-			"total_users": len(users),
+	app.GroupWithTags("/admin", []string{"admin", "internal"}, func(r *archimedes.Router) {
+		r.Operation("getStats", func(ctx *archimedes.Context) error {
+			users := store.List()
+			return ctx.JSON(200, map[string]any{
+				"total_users": len(users),
+			})
 		})
 	})
-
-	// Merge admin router into main app
-	app.Merge(adminRouter)
 }
@@ -8,6 +8,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"strings"
@@ -77,6 +78,7 @@ type RequestContext struct {
 	RequestID   string
 	Caller      *CallerIdentity
 	OperationID string
+	Logger      *slog.Logger
 }
 
 // =============================================================================
@@ -127,10 +129,13 @@ func getRequestContext(r *http.Request) *RequestContext {
 		requestID = uuid.New().String()
 	}
 
+	operationID := r.Header.Get("X-Operation-Id")
+
 	return &RequestContext{
 		RequestID:   requestID,
 		Caller:      parseCallerIdentity(r.Header.Get("X-Caller-Identity")),
-		OperationID: r.Header.Get("X-Operation-Id"),
+		OperationID: operationID,
+		Logger:      slog.With("request_id", requestID, "operation_id", operationID),
 	}
 }
 
@@ -171,7 +176,7 @@ func healthHandler(w http.ResponseWriter, r *http.Request) {
 
 func listUsersHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := getRequestContext(r)
-	log.Printf("[%s] Listing users, caller: %+v", ctx.RequestID, ctx.Caller)
+	ctx.Logger.Info("Listing users", "caller", ctx.Caller)
 
 	store.mu.RLock()
 	users := make([]User, 0, len(store.users))
@@ -189,7 +194,7 @@ func listUsersHandler(w http.ResponseWriter, r *http.Request) {
 func getUserHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := getRequestContext(r)
 	userID := extractUserID(r.URL.Path)
-	log.Printf("[%s] Getting user %s, caller: %+v", ctx.RequestID, userID, ctx.Caller)
+	ctx.Logger.Info("Getting user", "user_id", userID, "caller", ctx.Caller)
 
 	store.mu.RLock()
 	user, exists := store.users[userID]
@@ -206,7 +211,7 @@ func getUserHandler(w http.ResponseWriter, r *http.Request) {
 
 func createUserHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := getRequestContext(r)
-	log.Printf("[%s] Creating user, caller: %+v", ctx.RequestID, ctx.Caller)
+	ctx.Logger.Info("Creating user", "caller", ctx.Caller)
 
 	var req CreateUserRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -235,14 +240,14 @@ func createUserHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	store.users[user.ID] = user
 
-	log.Printf("[%s] Created user %s", ctx.RequestID, user.ID)
+	ctx.Logger.Info("Created user", "user_id", user.ID)
 	writeJSON(w, http.StatusCreated, user)
 }
 
 func updateUserHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := getRequestContext(r)
 	userID := extractUserID(r.URL.Path)
-	log.Printf("[%s] Updating user %s, caller: %+v", ctx.RequestID, userID, ctx.Caller)
+	ctx.Logger.Info("Updating user", "user_id", userID, "caller", ctx.Caller)
 
 	var req UpdateUserRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -269,14 +274,14 @@ func updateUserHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	store.users[userID] = user
 
-	log.Printf("[%s] Updated user %s", ctx.RequestID, userID)
+	ctx.Logger.Info("Updated user", "user_id", userID)
 	writeJSON(w, http.StatusOK, user)
 }
 
 func deleteUserHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := getRequestContext(r)
 	userID := extractUserID(r.URL.Path)
-	log.Printf("[%s] Deleting user %s, caller: %+v", ctx.RequestID, userID, ctx.Caller)
+	ctx.Logger.Info("Deleting user", "user_id", userID, "caller", ctx.Caller)
 
 	store.mu.Lock()
 	defer store.mu.Unlock()
@@ -288,7 +293,7 @@ func deleteUserHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	delete(store.users, userID)
-	log.Printf("[%s] Deleted user %s", ctx.RequestID, userID)
+	ctx.Logger.Info("Deleted user", "user_id", userID)
 	w.WriteHeader(http.StatusNoContent)
 }
 